@@ -0,0 +1,123 @@
+package main
+
+import (
+    "context"
+    "flag"
+    "fmt"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/migrate"
+    "os"
+    "strconv"
+    "text/tabwriter"
+    "time"
+)
+
+const migrateUsage = `usage: api migrate <command>
+
+commands:
+  up [n]               apply all pending migrations, or the next n
+  down [n]             roll back the last migration, or the last n
+  status               list migrations and whether they are applied
+  new [-dir d] <name>  create empty up/down SQL files for every dialect`
+
+func runMigrate(config database.Config, args []string) error {
+    if len(args) == 0 {
+        return fmt.Errorf("missing command\n%s", migrateUsage)
+    }
+    if args[0] == "new" {
+        return newMigration(args[1:])
+    }
+
+    config.SkipMigrations = true
+    db, err := database.NewDatabase(config)
+    if err != nil {
+        return err
+    }
+    if err := db.Connect(); err != nil {
+        return err
+    }
+    defer db.Close()
+    migratable, ok := db.(database.Migratable)
+    if !ok {
+        return fmt.Errorf("database type %s does not use migrations", config.Type)
+    }
+    migrator := migratable.Migrator()
+    ctx := context.Background()
+
+    switch args[0] {
+    case "up":
+        limit, err := countArg(args[1:], 0)
+        if err != nil {
+            return err
+        }
+        applied, err := migrator.Up(ctx, limit)
+        fmt.Printf("Applied %d migration(s)\n", applied)
+        return err
+    case "down":
+        steps, err := countArg(args[1:], 1)
+        if err != nil {
+            return err
+        }
+        reverted, err := migrator.Down(ctx, steps)
+        fmt.Printf("Rolled back %d migration(s)\n", reverted)
+        return err
+    case "status":
+        statuses, err := migrator.Status(ctx)
+        if err != nil {
+            return err
+        }
+        printStatus(statuses)
+        return nil
+    }
+    return fmt.Errorf("unknown command %q\n%s", args[0], migrateUsage)
+}
+
+func newMigration(args []string) error {
+    flags := flag.NewFlagSet("new", flag.ContinueOnError)
+    dir := flags.String("dir", "internal/database/migrations", "migrations directory")
+    if err := flags.Parse(args); err != nil {
+        return err
+    }
+    if flags.NArg() != 1 {
+        return fmt.Errorf("expected a migration name\n%s", migrateUsage)
+    }
+    files, err := migrate.Create(*dir, flags.Arg(0), []string{"mysql", "postgres", "sqlite"})
+    if err != nil {
+        return err
+    }
+    for _, file := range files {
+        fmt.Println("Created", file)
+    }
+    return nil
+}
+
+func countArg(args []string, fallback int) (int, error) {
+    if len(args) == 0 {
+        return fallback, nil
+    }
+    n, err := strconv.Atoi(args[0])
+    if err != nil || n < 1 {
+        return 0, fmt.Errorf("invalid count %q", args[0])
+    }
+    return n, nil
+}
+
+func printStatus(statuses []migrate.Status) {
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+    fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+    for _, status := range statuses {
+        state, appliedAt := "pending", ""
+        if status.Applied {
+            state = "applied"
+            appliedAt = status.AppliedAt.Local().Format(time.RFC3339)
+        }
+        if status.Modified {
+            state = "modified"
+        }
+        if status.Missing {
+            state = "missing"
+        }
+        fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+    }
+    w.Flush()
+}
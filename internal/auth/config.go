@@ -0,0 +1,53 @@
+package auth
+
+import (
+    "time"
+)
+
+type Config struct {
+    Secret           []byte
+    TokenTTL         time.Duration
+    ImpersonationTTL time.Duration
+    AccountLockout   LockoutPolicy
+    IPLockout        LockoutPolicy
+}
+
+func DefaultConfig() Config {
+    return Config{
+        TokenTTL:         24 * time.Hour,
+        ImpersonationTTL: 15 * time.Minute,
+        AccountLockout: LockoutPolicy{
+            MaxFailures:     5,
+            BackoffBase:     time.Second,
+            LockoutDuration: 15 * time.Minute,
+            MaxLockout:      24 * time.Hour,
+            ResetAfter:      24 * time.Hour,
+        },
+        IPLockout: LockoutPolicy{
+            MaxFailures:     20,
+            BackoffBase:     100 * time.Millisecond,
+            LockoutDuration: 15 * time.Minute,
+            MaxLockout:      6 * time.Hour,
+            ResetAfter:      time.Hour,
+        },
+    }
+}
+
+// NewToken issues a signed token for the given subject that expires after TokenTTL
+func (c Config) NewToken(claims Claims) (string, error) {
+    return c.sign(claims, c.TokenTTL)
+}
+
+// NewImpersonationToken issues a short-lived token for the given subject that
+// records the admin acting on their behalf in the act claim
+func (c Config) NewImpersonationToken(claims Claims, actor Actor) (string, error) {
+    claims.Act = &actor
+    return c.sign(claims, c.ImpersonationTTL)
+}
+
+func (c Config) sign(claims Claims, ttl time.Duration) (string, error) {
+    now := time.Now()
+    claims.IssuedAt = now.Unix()
+    claims.ExpiresAt = now.Add(ttl).Unix()
+    return Sign(c.Secret, claims)
+}
@@ -0,0 +1,16 @@
+package auth
+
+import (
+    "context"
+)
+
+type claimsKey struct{}
+
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+    return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+    claims, ok := ctx.Value(claimsKey{}).(*Claims)
+    return claims, ok && claims != nil
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+    "time"
+)
+
+// LockoutPolicy controls how failed logins for a single identifier (an account
+// or a client IP) are throttled. Every failure blocks the identifier for an
+// exponentially growing back-off; once MaxFailures is reached the identifier is
+// locked for LockoutDuration, which also doubles with every further failure.
+type LockoutPolicy struct {
+    MaxFailures     int
+    BackoffBase     time.Duration
+    LockoutDuration time.Duration
+    MaxLockout      time.Duration
+    ResetAfter      time.Duration
+}
+
+func (p LockoutPolicy) Enabled() bool {
+    return p.MaxFailures > 0
+}
+
+// Delay returns how long an identifier stays blocked after its nth failure
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+    if !p.Enabled() || failures <= 0 {
+        return 0
+    }
+    if failures < p.MaxFailures {
+        return double(p.BackoffBase, failures-1, p.LockoutDuration)
+    }
+    return double(p.LockoutDuration, failures-p.MaxFailures, p.MaxLockout)
+}
+
+// ResetBefore returns the time before which an earlier failure no longer
+// counts, the zero time if failures never expire
+func (p LockoutPolicy) ResetBefore(now time.Time) time.Time {
+    if p.ResetAfter <= 0 {
+        return time.Time{}
+    }
+    return now.Add(-p.ResetAfter)
+}
+
+// Locks reports whether the nth failure is the one that locks the identifier
+func (p LockoutPolicy) Locks(failures int) bool {
+    return p.Enabled() && failures == p.MaxFailures
+}
+
+func double(base time.Duration, times int, max time.Duration) time.Duration {
+    d := base
+    for i := 0; i < times && (max <= 0 || d < max); i++ {
+        d *= 2
+    }
+    if max > 0 && d > max {
+        d = max
+    }
+    return d
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+    "testing"
+    "time"
+)
+
+func TestLockoutDelay(t *testing.T) {
+    account := DefaultConfig().AccountLockout
+    ip := DefaultConfig().IPLockout
+    tests := []struct {
+        name     string
+        policy   LockoutPolicy
+        failures int
+        want     time.Duration
+    }{
+        {"no failures", account, 0, 0},
+        {"first failure", account, 1, time.Second},
+        {"back-off doubles", account, 2, 2 * time.Second},
+        {"last back-off", account, 4, 8 * time.Second},
+        {"locks at MaxFailures", account, 5, 15 * time.Minute},
+        {"lockout doubles", account, 6, 30 * time.Minute},
+        {"lockout doubles again", account, 8, 2 * time.Hour},
+        {"lockout capped", account, 12, 24 * time.Hour},
+        {"far past the cap", account, 1000, 24 * time.Hour},
+        {"IP back-off", ip, 3, 400 * time.Millisecond},
+        {"IP back-off capped by the lockout", ip, 19, 15 * time.Minute},
+        {"IP lockout", ip, 20, 15 * time.Minute},
+        {"IP lockout capped", ip, 30, 6 * time.Hour},
+        {"disabled", LockoutPolicy{BackoffBase: time.Second}, 3, 0},
+        {"uncapped", LockoutPolicy{MaxFailures: 1, LockoutDuration: time.Minute}, 4, 8 * time.Minute},
+    }
+    for _, test := range tests {
+        if got := test.policy.Delay(test.failures); got != test.want {
+            t.Errorf("%s: Delay(%d) = %v, want %v", test.name, test.failures, got, test.want)
+        }
+    }
+}
+
+func TestLockoutLocks(t *testing.T) {
+    policy := DefaultConfig().AccountLockout
+    for failures := 0; failures <= 7; failures++ {
+        if got := policy.Locks(failures); got != (failures == 5) {
+            t.Errorf("Locks(%d) = %v", failures, got)
+        }
+    }
+    if (LockoutPolicy{}).Locks(0) {
+        t.Error("a disabled policy locks")
+    }
+}
+
+func TestLockoutResetBefore(t *testing.T) {
+    now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+    policy := DefaultConfig().IPLockout
+    if got := policy.ResetBefore(now); !got.Equal(now.Add(-time.Hour)) {
+        t.Errorf("ResetBefore = %v, want an hour before now", got)
+    }
+    policy.ResetAfter = 0
+    if got := policy.ResetBefore(now); !got.IsZero() {
+        t.Errorf("ResetBefore without ResetAfter = %v, want the zero time", got)
+    }
+}
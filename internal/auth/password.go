@@ -0,0 +1,25 @@
+package auth
+
+import (
+    "golang.org/x/crypto/bcrypt"
+)
+
+// dummyHash is compared against when no user matches, so unknown emails take
+// as long to reject as wrong passwords
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+func HashPassword(password string) (string, error) {
+    hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+    if err != nil {
+        return "", err
+    }
+    return string(hash), nil
+}
+
+func CheckPassword(hash, password string) bool {
+    if hash == "" {
+        bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+        return false
+    }
+    return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
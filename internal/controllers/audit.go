@@ -0,0 +1,104 @@
+package controllers
+
+import (
+    "github.com/gorilla/mux"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/auth"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/framework"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "net/http"
+    "strconv"
+)
+
+// GetUserHistory lists the audit entries of a user. Users can read their own
+// history and admins anyone's. It takes the query parameters of
+// ListAuditEntries.
+func GetUserHistory(app *framework.App) func(r *http.Request, res *framework.Response) {
+    return func(r *http.Request, res *framework.Response) {
+        vars := mux.Vars(r)
+        id, err := strconv.Atoi(vars["id"])
+        if err != nil {
+            res.Error(http.StatusBadRequest, "Invalid user ID")
+            return
+        }
+        if !canReadHistory(r, vars["id"]) {
+            res.Error(http.StatusForbidden, "Only admins can read the history of other users")
+            return
+        }
+        opts, err := app.ParseListOptions(r, database.AuditFields)
+        if err != nil {
+            res.Error(http.StatusBadRequest, err.Error())
+            return
+        }
+        opts.Filters = append(opts.Filters,
+            database.Filter{Field: "resource", Op: database.OpEq, Value: "users"},
+            database.Filter{Field: "resource_id", Op: database.OpEq, Value: strconv.Itoa(id)})
+        entries, total, err := app.RequestDB(r).ListAuditEntries(app.Context(), opts)
+        if err != nil {
+            res.DBError(err, "Audit entry", "Failed to fetch user history")
+            return
+        }
+        app.Paginate(res, r, "User history fetched successfully", entries, opts, total)
+    }
+}
+
+type userDiff struct {
+    From    uint                `json:"from"`
+    To      uint                `json:"to"`
+    Changes models.AuditChanges `json:"changes"`
+}
+
+// GetUserDiff returns the fields of a user that changed between the versions
+// given by from and to, rebuilt from the audit log. Like GetUserHistory, it is
+// for the user and admins.
+func GetUserDiff(app *framework.App) func(r *http.Request, res *framework.Response) {
+    return func(r *http.Request, res *framework.Response) {
+        vars := mux.Vars(r)
+        id, err := strconv.Atoi(vars["id"])
+        if err != nil {
+            res.Error(http.StatusBadRequest, "Invalid user ID")
+            return
+        }
+        if !canReadHistory(r, vars["id"]) {
+            res.Error(http.StatusForbidden, "Only admins can read the history of other users")
+            return
+        }
+        from, fromErr := strconv.ParseUint(r.URL.Query().Get("from"), 10, 32)
+        to, toErr := strconv.ParseUint(r.URL.Query().Get("to"), 10, 32)
+        if fromErr != nil || toErr != nil {
+            res.Error(http.StatusBadRequest, "from and to must be versions of the user")
+            return
+        }
+        changes, err := database.DiffUserVersions(app.Context(), app.RequestDB(r), uint(id), uint(from), uint(to))
+        if err != nil {
+            res.DBError(err, "User version", "Failed to compare user versions")
+            return
+        }
+        res.Success("User diff fetched successfully", userDiff{From: uint(from), To: uint(to), Changes: changes})
+    }
+}
+
+// canReadHistory tells whether the request may read the history of the user
+// with the given ID: its own, or anyone's for admins
+func canReadHistory(r *http.Request, id string) bool {
+    claims, ok := auth.ClaimsFromContext(r.Context())
+    return isAdmin(r) || ok && claims.Subject == id
+}
+
+// ListAuditEntries lists the audit log with the pagination, sorting and
+// filtering parameters of the user list, on the fields of database.AuditFields
+func ListAuditEntries(app *framework.App) func(r *http.Request, res *framework.Response) {
+    return func(r *http.Request, res *framework.Response) {
+        opts, err := app.ParseListOptions(r, database.AuditFields)
+        if err != nil {
+            res.Error(http.StatusBadRequest, err.Error())
+            return
+        }
+        entries, total, err := app.RequestDB(r).ListAuditEntries(app.Context(), opts)
+        if err != nil {
+            res.DBError(err, "Audit entry", "Failed to fetch audit entries")
+            return
+        }
+        app.Paginate(res, r, "Audit entries fetched successfully", entries, opts, total)
+    }
+}
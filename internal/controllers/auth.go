@@ -0,0 +1,213 @@
+package controllers
+
+import (
+    "errors"
+    "fmt"
+    "github.com/gorilla/mux"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/auth"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/framework"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/mailer"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/utils"
+    "log"
+    "math"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+type loginRequest struct {
+    Email    string `json:"email"`
+    Password string `json:"password"`
+}
+
+type loginResponse struct {
+    Token     string    `json:"token"`
+    ExpiresAt time.Time `json:"expires_at"`
+}
+
+func Login(app *framework.App) func(r *http.Request, res *framework.Response) {
+    return func(r *http.Request, res *framework.Response) {
+        var body loginRequest
+        if err := app.ParseBody(r, &body); err != nil || body.Email == "" || body.Password == "" {
+            res.Error(http.StatusBadRequest, "Email and password are required")
+            return
+        }
+        config := app.Auth()
+        email := strings.ToLower(strings.TrimSpace(body.Email))
+        now := time.Now()
+
+        ipAttempt, err := app.DB().GetLoginAttempt(app.Context(), models.LoginScopeIP, utils.ClientIP(r))
+        if err != nil {
+            res.DBError(err, "Login attempt", "Failed to check login attempts")
+            return
+        }
+        accountAttempt, err := app.DB().GetLoginAttempt(app.Context(), models.LoginScopeAccount, email)
+        if err != nil {
+            res.DBError(err, "Login attempt", "Failed to check login attempts")
+            return
+        }
+        wait := ipAttempt.RetryAfter(now)
+        if accountWait := accountAttempt.RetryAfter(now); accountWait > wait {
+            wait = accountWait
+        }
+        if wait > 0 {
+            res.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+            res.Error(http.StatusTooManyRequests, "Too many failed login attempts, try again later")
+            return
+        }
+
+        user, err := app.DB().GetUserByEmail(app.Context(), email)
+        if errors.Is(err, database.ErrNotFound) {
+            user = nil
+        } else if err != nil {
+            res.DBError(err, "User", "Failed to fetch user")
+            return
+        }
+        hash := ""
+        if user != nil {
+            hash = user.PasswordHash
+        }
+        if !auth.CheckPassword(hash, body.Password) {
+            recordLoginFailure(app, config.IPLockout, models.LoginScopeIP, utils.ClientIP(r), now)
+            failed := recordLoginFailure(app, config.AccountLockout, models.LoginScopeAccount, email, now)
+            if failed != nil && config.AccountLockout.Locks(failed.Failures) && user != nil {
+                notifyLockout(app, user, failed)
+            }
+            res.Error(http.StatusUnauthorized, "Invalid email or password")
+            return
+        }
+
+        resetLoginAttempt(app, accountAttempt)
+        resetLoginAttempt(app, ipAttempt)
+        respondWithToken(app, res, user)
+    }
+}
+
+// recordLoginFailure counts a failed login under the policy and returns the
+// updated attempt, nil if the policy is disabled or the count failed
+func recordLoginFailure(app *framework.App, policy auth.LockoutPolicy, scope, identifier string, now time.Time) *models.LoginAttempt {
+    if !policy.Enabled() {
+        return nil
+    }
+    attempt, err := app.DB().RecordLoginFailure(app.Context(), scope, identifier, now, policy.ResetBefore(now), policy.Delay)
+    if err != nil {
+        log.Printf("Error saving login attempt: %v", err)
+        return nil
+    }
+    return attempt
+}
+
+// resetLoginAttempt clears the failures counted against an identifier after
+// a successful login
+func resetLoginAttempt(app *framework.App, attempt *models.LoginAttempt) {
+    if attempt.Failures == 0 {
+        return
+    }
+    if err := app.DB().DeleteLoginAttempt(app.Context(), attempt.Scope, attempt.Identifier); err != nil {
+        log.Printf("Error resetting login attempts: %v", err)
+    }
+}
+
+func respondWithToken(app *framework.App, res *framework.Response, user *models.User) {
+    config := app.Auth()
+    token, err := config.NewToken(auth.Claims{
+        Subject: strconv.FormatUint(uint64(user.ID), 10),
+        Email:   user.Email,
+        Role:    user.Role,
+    })
+    if err != nil {
+        res.Error(http.StatusInternalServerError, "Failed to issue token")
+        return
+    }
+    res.Success("Login successful", loginResponse{Token: token, ExpiresAt: time.Now().Add(config.TokenTTL)})
+}
+
+func notifyLockout(app *framework.App, user *models.User, attempt *models.LoginAttempt) {
+    msg := mailer.Message{
+        To:      user.Email,
+        Subject: "Your account has been temporarily locked",
+        Body: fmt.Sprintf("Hi %s,\n\nWe locked your account after %d failed login attempts. "+
+            "You can try again after %s, or contact support to unlock it sooner.\n",
+            user.Name, attempt.Failures, attempt.LockedUntil.Format(time.RFC1123)),
+    }
+    if err := app.Mailer().Send(app.Context(), msg); err != nil {
+        log.Printf("Error sending lockout notification: %v", err)
+    }
+}
+
+func UnlockUser(app *framework.App) func(r *http.Request, res *framework.Response) {
+    return func(r *http.Request, res *framework.Response) {
+        vars := mux.Vars(r)
+        id, err := strconv.Atoi(vars["id"])
+        if err != nil {
+            res.Error(http.StatusBadRequest, "Invalid user ID")
+            return
+        }
+        user, err := app.DB().GetUserByID(app.Context(), uint(id))
+        if err != nil {
+            res.DBError(err, "User", "Failed to fetch user")
+            return
+        }
+        email := strings.ToLower(strings.TrimSpace(user.Email))
+        if err := app.DB().DeleteLoginAttempt(app.Context(), models.LoginScopeAccount, email); err != nil {
+            res.Error(http.StatusInternalServerError, "Failed to unlock user")
+            return
+        }
+        res.Success("User unlocked successfully", nil)
+    }
+}
+
+// Impersonate issues a short-lived token that lets an admin act as another user
+func Impersonate(app *framework.App) func(r *http.Request, res *framework.Response) {
+    return func(r *http.Request, res *framework.Response) {
+        admin, ok := auth.ClaimsFromContext(r.Context())
+        if !ok {
+            res.Error(http.StatusUnauthorized, "Authentication required")
+            return
+        }
+        vars := mux.Vars(r)
+        id, err := strconv.Atoi(vars["id"])
+        if err != nil {
+            res.Error(http.StatusBadRequest, "Invalid user ID")
+            return
+        }
+        user, err := app.DB().GetUserByID(app.Context(), uint(id))
+        if err != nil {
+            res.DBError(err, "User", "Failed to fetch user")
+            return
+        }
+        subject := strconv.FormatUint(uint64(user.ID), 10)
+        if subject == admin.Subject {
+            res.Error(http.StatusBadRequest, "Cannot impersonate yourself")
+            return
+        }
+        config := app.Auth()
+        token, err := config.NewImpersonationToken(auth.Claims{
+            Subject: subject,
+            Email:   user.Email,
+            Role:    user.Role,
+        }, auth.Actor{Subject: admin.Subject, Email: admin.Email})
+        if err != nil {
+            res.Error(http.StatusInternalServerError, "Failed to issue token")
+            return
+        }
+        entry := &models.AuditEntry{
+            Action:         models.AuditImpersonationStart,
+            ActorID:        subject,
+            ImpersonatorID: admin.Subject,
+            Resource:       "users",
+            ResourceID:     subject,
+            RequestID:      utils.RequestIDFromContext(r.Context()),
+            Details:        "impersonation token issued to " + admin.Email,
+        }
+        if err := app.DB().CreateAuditEntry(app.Context(), entry); err != nil {
+            res.Error(http.StatusInternalServerError, "Failed to record impersonation")
+            return
+        }
+        log.Printf("IMPERSONATION: admin %s started impersonating user %s", admin.Subject, subject)
+        res.Success("Impersonation token issued", loginResponse{Token: token, ExpiresAt: time.Now().Add(config.ImpersonationTTL)})
+    }
+}
\ No newline at end of file
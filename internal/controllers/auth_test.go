@@ -0,0 +1,148 @@
+package controllers
+
+import (
+    "context"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/auth"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/framework"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/mailer"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+)
+
+type loginTest struct {
+    app  *framework.App
+    user *models.User
+    sent []mailer.Message
+}
+
+// newLoginTest returns an app with ann@example.com, whose password is
+// password123, and lockout policies that lock after three failures
+func newLoginTest(t *testing.T, backoff time.Duration) *loginTest {
+    t.Helper()
+    l := &loginTest{app: newTestApp(t)}
+    config := l.app.Auth()
+    policy := auth.LockoutPolicy{MaxFailures: 3, BackoffBase: backoff, LockoutDuration: time.Hour, ResetAfter: time.Hour}
+    config.AccountLockout = policy
+    config.IPLockout = policy
+    l.app.SetAuth(config)
+    l.app.SetMailer(mailer.Func(func(ctx context.Context, msg mailer.Message) error {
+        l.sent = append(l.sent, msg)
+        return nil
+    }))
+    l.user = models.NewUser("Ann", "ann@example.com")
+    hash, err := auth.HashPassword("password123")
+    if err != nil {
+        t.Fatal(err)
+    }
+    l.user.PasswordHash = hash
+    if err := l.app.DB().CreateUser(context.Background(), l.user); err != nil {
+        t.Fatal(err)
+    }
+    return l
+}
+
+// login posts credentials from ip and returns the response
+func (l *loginTest) login(ip, email, password string) *httptest.ResponseRecorder {
+    request := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(`{"email":"`+email+`","password":"`+password+`"}`))
+    request.RemoteAddr = ip + ":40000"
+    return serve(Login(l.app), request, nil, nil)
+}
+
+func (l *loginTest) failures(t *testing.T, scope, identifier string) int {
+    t.Helper()
+    attempt, err := l.app.DB().GetLoginAttempt(context.Background(), scope, identifier)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return attempt.Failures
+}
+
+func TestLoginAccountLockout(t *testing.T) {
+    l := newLoginTest(t, 0)
+    // Failures from different IPs add up for the account, whatever the case
+    // of the email
+    for i, email := range []string{"ann@example.com", "ANN@example.com", " ann@example.com"} {
+        if code := l.login("10.0.0."+strconv.Itoa(i), email, "wrong").Code; code != http.StatusUnauthorized {
+            t.Fatalf("failure %d: status = %d, want 401", i+1, code)
+        }
+    }
+    if len(l.sent) != 1 || l.sent[0].To != "ann@example.com" {
+        t.Errorf("sent %+v, want one lockout notification to Ann", l.sent)
+    }
+    recorder := l.login("10.0.1.1", "ann@example.com", "password123")
+    if recorder.Code != http.StatusTooManyRequests {
+        t.Fatalf("locked account: status = %d, want 429", recorder.Code)
+    }
+    if retry, _ := strconv.Atoi(recorder.Header().Get("Retry-After")); retry < 3590 || retry > 3600 {
+        t.Errorf("Retry-After = %q, want about an hour", recorder.Header().Get("Retry-After"))
+    }
+
+    // An admin unlocks it
+    id := strconv.FormatUint(uint64(l.user.ID), 10)
+    unlock := httptest.NewRequest(http.MethodPost, "/users/"+id+"/unlock", nil)
+    if code := serve(UnlockUser(l.app), unlock, admin, map[string]string{"id": id}).Code; code != http.StatusOK {
+        t.Fatalf("unlock status = %d", code)
+    }
+    if code := l.login("10.0.1.1", "ann@example.com", "password123").Code; code != http.StatusOK {
+        t.Errorf("after unlock: status = %d, want 200", code)
+    }
+
+    // Unknown accounts are counted too, without a notification
+    for i := 0; i < 3; i++ {
+        l.login("10.0.2."+strconv.Itoa(i), "nobody@example.com", "wrong")
+    }
+    if code := l.login("10.0.3.1", "nobody@example.com", "wrong").Code; code != http.StatusTooManyRequests {
+        t.Errorf("unknown account: status = %d, want 429", code)
+    }
+    if len(l.sent) != 1 {
+        t.Errorf("sent %d notifications, want none for an unknown account", len(l.sent)-1)
+    }
+}
+
+func TestLoginIPLockout(t *testing.T) {
+    l := newLoginTest(t, 0)
+    for i := 0; i < 3; i++ {
+        l.login("10.0.0.1", "user"+strconv.Itoa(i)+"@example.com", "wrong")
+    }
+    if code := l.login("10.0.0.1", "ann@example.com", "password123").Code; code != http.StatusTooManyRequests {
+        t.Errorf("locked IP: status = %d, want 429", code)
+    }
+    if code := l.login("10.0.0.2", "ann@example.com", "password123").Code; code != http.StatusOK {
+        t.Errorf("other IP: status = %d, want 200", code)
+    }
+}
+
+func TestLoginBackoff(t *testing.T) {
+    l := newLoginTest(t, time.Minute)
+    l.login("10.0.0.1", "ann@example.com", "wrong")
+    recorder := l.login("10.0.0.2", "ann@example.com", "password123")
+    retry, _ := strconv.Atoi(recorder.Header().Get("Retry-After"))
+    if recorder.Code != http.StatusTooManyRequests || retry < 55 || retry > 60 {
+        t.Errorf("during back-off: status = %d, Retry-After %q, want 429 after a minute", recorder.Code, recorder.Header().Get("Retry-After"))
+    }
+}
+
+func TestLoginResetsFailures(t *testing.T) {
+    l := newLoginTest(t, 0)
+    for i := 0; i < 2; i++ {
+        l.login("10.0.0.1", "ann@example.com", "wrong")
+    }
+    if code := l.login("10.0.0.1", "ann@example.com", "password123").Code; code != http.StatusOK {
+        t.Fatalf("status = %d, want 200", code)
+    }
+    if account, ip := l.failures(t, models.LoginScopeAccount, "ann@example.com"), l.failures(t, models.LoginScopeIP, "10.0.0.1"); account != 0 || ip != 0 {
+        t.Fatalf("%d account and %d IP failures left after a successful login", account, ip)
+    }
+    // Counting starts over, so two more failures do not lock
+    for i := 0; i < 2; i++ {
+        l.login("10.0.0.1", "ann@example.com", "wrong")
+    }
+    if code := l.login("10.0.0.1", "ann@example.com", "password123").Code; code != http.StatusOK {
+        t.Errorf("status = %d, want 200", code)
+    }
+}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+    "crypto/subtle"
+    "errors"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/framework"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/oidc"
+    "log"
+    "net/http"
+    "strings"
+    "time"
+)
+
+const (
+    oidcFlowCookie = "oidc_flow"
+    oidcFlowTTL    = 10 * time.Minute
+)
+
+var errUnverifiedEmail = errors.New("provider did not return a verified email")
+
+// OIDCLogin starts the authorization code flow by redirecting to the provider
+func OIDCLogin(app *framework.App, provider *oidc.Provider) func(r *http.Request, res *framework.Response) {
+    return func(r *http.Request, res *framework.Response) {
+        flow, err := oidc.NewFlow(provider.Name(), oidcFlowTTL)
+        if err != nil {
+            res.Error(http.StatusInternalServerError, "Failed to start login")
+            return
+        }
+        value, err := flow.Encode(app.Auth().Secret)
+        if err != nil {
+            res.Error(http.StatusInternalServerError, "Failed to start login")
+            return
+        }
+        res.Cookie(flowCookie(r, value, int(oidcFlowTTL.Seconds())))
+        res.Redirect(http.StatusFound, provider.AuthCodeURL(flow.State, flow.Nonce, flow.Verifier))
+    }
+}
+
+// OIDCCallback completes the flow, links the provider identity to a user and
+// issues an API token
+func OIDCCallback(app *framework.App, provider *oidc.Provider) func(r *http.Request, res *framework.Response) {
+    return func(r *http.Request, res *framework.Response) {
+        res.Cookie(flowCookie(r, "", -1))
+        query := r.URL.Query()
+        if providerErr := query.Get("error"); providerErr != "" {
+            res.Error(http.StatusUnauthorized, "Login was rejected by the provider: "+providerErr)
+            return
+        }
+        cookie, err := r.Cookie(oidcFlowCookie)
+        if err != nil {
+            res.Error(http.StatusBadRequest, "Missing login flow, please start the login again")
+            return
+        }
+        flow, err := oidc.DecodeFlow(app.Auth().Secret, cookie.Value)
+        if err != nil || flow.Provider != provider.Name() {
+            res.Error(http.StatusBadRequest, "Invalid or expired login flow, please start the login again")
+            return
+        }
+        if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(flow.State)) != 1 {
+            res.Error(http.StatusBadRequest, "State mismatch")
+            return
+        }
+        code := query.Get("code")
+        if code == "" {
+            res.Error(http.StatusBadRequest, "Missing authorization code")
+            return
+        }
+        token, err := provider.Exchange(r.Context(), code, flow.Verifier)
+        if err != nil {
+            log.Printf("Error exchanging authorization code: %v", err)
+            res.Error(http.StatusBadGateway, "Failed to exchange authorization code")
+            return
+        }
+        claims, err := provider.VerifyIDToken(r.Context(), token.IDToken, flow.Nonce)
+        if err != nil {
+            log.Printf("Error verifying ID token: %v", err)
+            res.Error(http.StatusUnauthorized, "Invalid ID token")
+            return
+        }
+        user, err := linkIdentity(app, r, provider.Name(), claims)
+        if errors.Is(err, errUnverifiedEmail) {
+            res.Error(http.StatusForbidden, "The provider did not return a verified email")
+            return
+        }
+        if err != nil {
+            res.DBError(err, "Identity", "Failed to link identity")
+            return
+        }
+        respondWithToken(app, res, user)
+    }
+}
+
+// linkIdentity finds the user behind a provider identity. Unknown identities
+// are linked to the user with the same verified email, or to a new user. A
+// new user and its identity are written in one transaction, so a failed link
+// leaves no user behind to block the email.
+func linkIdentity(app *framework.App, r *http.Request, provider string, claims *oidc.IDTokenClaims) (*models.User, error) {
+    db := app.RequestDB(r)
+    if !database.SupportsTx(db) {
+        return linkIdentityIn(app, db, provider, claims)
+    }
+    var user *models.User
+    err := db.WithTx(r.Context(), func(tx database.Database) error {
+        var err error
+        user, err = linkIdentityIn(app, tx, provider, claims)
+        return err
+    })
+    return user, err
+}
+
+func linkIdentityIn(app *framework.App, db database.Database, provider string, claims *oidc.IDTokenClaims) (*models.User, error) {
+    identity, err := db.GetIdentity(app.Context(), provider, claims.Subject)
+    if err == nil {
+        return db.GetUserByID(app.Context(), identity.UserID)
+    }
+    if !errors.Is(err, database.ErrNotFound) {
+        return nil, err
+    }
+    if claims.Email == "" || !claims.EmailVerified {
+        return nil, errUnverifiedEmail
+    }
+    user, err := db.GetUserByEmail(app.Context(), claims.Email)
+    if err != nil && !errors.Is(err, database.ErrNotFound) {
+        return nil, err
+    }
+    if err != nil {
+        name := claims.Name
+        if len(name) < 2 {
+            name = strings.Split(claims.Email, "@")[0]
+        }
+        if len(name) < 2 {
+            name = claims.Email
+        }
+        user = models.NewUser(name, claims.Email)
+        if err := db.CreateUser(app.Context(), user); err != nil {
+            return nil, err
+        }
+    }
+    identity = &models.Identity{
+        UserID:   user.ID,
+        Provider: provider,
+        Subject:  claims.Subject,
+        Email:    claims.Email,
+    }
+    if err := db.CreateIdentity(app.Context(), identity); err != nil {
+        return nil, err
+    }
+    return user, nil
+}
+
+func flowCookie(r *http.Request, value string, maxAge int) *http.Cookie {
+    return &http.Cookie{
+        Name:     oidcFlowCookie,
+        Value:    value,
+        Path:     "/auth/oidc/",
+        MaxAge:   maxAge,
+        HttpOnly: true,
+        Secure:   r.TLS != nil,
+        SameSite: http.SameSiteLaxMode,
+    }
+}
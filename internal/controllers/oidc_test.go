@@ -0,0 +1,265 @@
+package controllers
+
+import (
+    "context"
+    "errors"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/framework"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/oidc"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/oidc/oidctest"
+    "github.com/glebarez/sqlite"
+    "gorm.io/gorm"
+    "gorm.io/gorm/logger"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+// newTestApp returns an app on a fresh SQLite database
+func newTestApp(t *testing.T) *framework.App {
+    t.Helper()
+    return newTestAppAt(t, filepath.Join(t.TempDir(), "test.db"))
+}
+
+// newTestAppAt returns an app on the SQLite database in path
+func newTestAppAt(t *testing.T, path string) *framework.App {
+    t.Helper()
+    app, err := framework.NewApp(database.Config{Type: "sqlite-pure", FilePath: path})
+    if err != nil {
+        t.Fatalf("NewApp: %v", err)
+    }
+    t.Cleanup(func() { app.DB().Close() })
+    config := app.Auth()
+    config.Secret = []byte("0123456789abcdef0123456789abcdef")
+    app.SetAuth(config)
+    return app
+}
+
+type oidcTest struct {
+    app      *framework.App
+    server   *oidctest.Server
+    provider *oidc.Provider
+}
+
+func newOIDCTest(t *testing.T) *oidcTest {
+    t.Helper()
+    return newOIDCTestAt(t, filepath.Join(t.TempDir(), "test.db"))
+}
+
+func newOIDCTestAt(t *testing.T, path string) *oidcTest {
+    t.Helper()
+    server := oidctest.NewServer(t)
+    provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+        Name:        "mock",
+        Issuer:      server.URL,
+        ClientID:    oidctest.ClientID,
+        RedirectURL: "http://app.test/auth/oidc/mock/callback",
+    })
+    if err != nil {
+        t.Fatalf("NewProvider: %v", err)
+    }
+    return &oidcTest{app: newTestAppAt(t, path), server: server, provider: provider}
+}
+
+// login starts a login, lets the mock provider authorize it and returns the
+// flow cookie and the query the provider redirected back with
+func (o *oidcTest) login(t *testing.T) (*http.Cookie, url.Values) {
+    t.Helper()
+    recorder := httptest.NewRecorder()
+    OIDCLogin(o.app, o.provider)(httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/login", nil), framework.NewResponse(recorder))
+    if recorder.Code != http.StatusFound {
+        t.Fatalf("login status = %d", recorder.Code)
+    }
+    cookies := recorder.Result().Cookies()
+    if len(cookies) != 1 || cookies[0].Name != oidcFlowCookie {
+        t.Fatalf("login set cookies %v", cookies)
+    }
+    client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+        return http.ErrUseLastResponse
+    }}
+    response, err := client.Get(recorder.Header().Get("Location"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    response.Body.Close()
+    location, err := response.Location()
+    if err != nil {
+        t.Fatalf("provider did not redirect back: %v", err)
+    }
+    return cookies[0], location.Query()
+}
+
+// callback completes a login and returns the response status
+func (o *oidcTest) callback(cookie *http.Cookie, query url.Values) int {
+    request := httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/callback?"+query.Encode(), nil)
+    if cookie != nil {
+        request.AddCookie(cookie)
+    }
+    recorder := httptest.NewRecorder()
+    OIDCCallback(o.app, o.provider)(request, framework.NewResponse(recorder))
+    return recorder.Code
+}
+
+func (o *oidcTest) identity(t *testing.T, subject string) *models.Identity {
+    t.Helper()
+    identity, err := o.app.DB().GetIdentity(context.Background(), "mock", subject)
+    if errors.Is(err, database.ErrNotFound) {
+        return nil
+    }
+    if err != nil {
+        t.Fatal(err)
+    }
+    return identity
+}
+
+func TestOIDCCallbackCreatesUser(t *testing.T) {
+    o := newOIDCTest(t)
+    o.server.User = oidctest.User{Subject: "sub-1", Email: "ann@example.com", EmailVerified: true, Name: "Ann"}
+    if status := o.callback(o.login(t)); status != http.StatusOK {
+        t.Fatalf("callback status = %d, want 200", status)
+    }
+    user, err := o.app.DB().GetUserByEmail(context.Background(), "ann@example.com")
+    if err != nil {
+        t.Fatalf("user was not created: %v", err)
+    }
+    identity := o.identity(t, "sub-1")
+    if identity == nil || identity.UserID != user.ID {
+        t.Fatalf("identity = %+v, want one linked to user %d", identity, user.ID)
+    }
+
+    // The identity is found by subject from then on, whatever the email
+    o.server.User = oidctest.User{Subject: "sub-1", Email: "ann@elsewhere.com"}
+    if status := o.callback(o.login(t)); status != http.StatusOK {
+        t.Fatalf("second callback status = %d, want 200", status)
+    }
+}
+
+func TestOIDCCallbackLinksVerifiedEmail(t *testing.T) {
+    o := newOIDCTest(t)
+    existing := models.NewUser("Ann", "ann@example.com")
+    if err := o.app.DB().CreateUser(context.Background(), existing); err != nil {
+        t.Fatal(err)
+    }
+
+    o.server.User = oidctest.User{Subject: "sub-1", Email: "ann@example.com"}
+    if status := o.callback(o.login(t)); status != http.StatusForbidden {
+        t.Fatalf("unverified email: callback status = %d, want 403", status)
+    }
+    if o.identity(t, "sub-1") != nil {
+        t.Fatal("an unverified email was linked")
+    }
+
+    o.server.User.EmailVerified = true
+    if status := o.callback(o.login(t)); status != http.StatusOK {
+        t.Fatalf("verified email: callback status = %d, want 200", status)
+    }
+    if identity := o.identity(t, "sub-1"); identity == nil || identity.UserID != existing.ID {
+        t.Fatalf("identity = %+v, want one linked to user %d", identity, existing.ID)
+    }
+}
+
+func TestOIDCCallbackLinksAtomically(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "test.db")
+    o := newOIDCTestAt(t, path)
+    o.server.User = oidctest.User{Subject: "sub-1", Email: "ann@example.com", EmailVerified: true}
+
+    // A second connection makes the identity insert fail after the user was
+    // created
+    db, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer func() {
+        if sqlDB, err := db.DB(); err == nil {
+            sqlDB.Close()
+        }
+    }()
+    if err := db.Exec("CREATE TRIGGER reject_identities BEFORE INSERT ON identities BEGIN SELECT RAISE(ABORT, 'rejected'); END").Error; err != nil {
+        t.Fatal(err)
+    }
+    if status := o.callback(o.login(t)); status != http.StatusInternalServerError {
+        t.Fatalf("callback status = %d, want 500", status)
+    }
+    if _, err := o.app.DB().GetUserByEmail(context.Background(), "ann@example.com"); !errors.Is(err, database.ErrNotFound) {
+        t.Fatalf("GetUserByEmail error = %v, want no user left by the failed link", err)
+    }
+
+    if err := db.Exec("DROP TRIGGER reject_identities").Error; err != nil {
+        t.Fatal(err)
+    }
+    if status := o.callback(o.login(t)); status != http.StatusOK {
+        t.Fatalf("callback status after the failure = %d, want 200", status)
+    }
+}
+
+func TestOIDCCallbackRejects(t *testing.T) {
+    o := newOIDCTest(t)
+    o.server.User = oidctest.User{Subject: "sub-1", Email: "ann@example.com", EmailVerified: true}
+
+    tests := []struct {
+        name   string
+        tamper func(claims map[string]interface{})
+        edit   func(cookie *http.Cookie, query url.Values) *http.Cookie
+        status int
+    }{
+        {name: "state mismatch", status: http.StatusBadRequest, edit: func(cookie *http.Cookie, query url.Values) *http.Cookie {
+            query.Set("state", "forged")
+            return cookie
+        }},
+        {name: "missing flow cookie", status: http.StatusBadRequest, edit: func(cookie *http.Cookie, query url.Values) *http.Cookie {
+            return nil
+        }},
+        {name: "flow of another login", status: http.StatusBadRequest, edit: func(cookie *http.Cookie, query url.Values) *http.Cookie {
+            other, _ := o.login(t)
+            return other
+        }},
+        {name: "wrong PKCE verifier", status: http.StatusBadGateway, edit: func(cookie *http.Cookie, query url.Values) *http.Cookie {
+            flow, err := oidc.DecodeFlow(o.app.Auth().Secret, cookie.Value)
+            if err != nil {
+                t.Fatal(err)
+            }
+            flow.Verifier = "guessed"
+            value, err := flow.Encode(o.app.Auth().Secret)
+            if err != nil {
+                t.Fatal(err)
+            }
+            return &http.Cookie{Name: cookie.Name, Value: value}
+        }},
+        {name: "nonce mismatch", status: http.StatusUnauthorized, tamper: func(claims map[string]interface{}) {
+            claims["nonce"] = "replayed"
+        }},
+        {name: "bad issuer", status: http.StatusUnauthorized, tamper: func(claims map[string]interface{}) {
+            claims["iss"] = "https://evil.example.com"
+        }},
+        {name: "bad audience", status: http.StatusUnauthorized, tamper: func(claims map[string]interface{}) {
+            claims["aud"] = "another-client"
+        }},
+        {name: "expired", status: http.StatusUnauthorized, tamper: func(claims map[string]interface{}) {
+            claims["exp"] = time.Now().Add(-time.Hour).Unix()
+        }},
+        {name: "provider error", status: http.StatusUnauthorized, edit: func(cookie *http.Cookie, query url.Values) *http.Cookie {
+            query.Set("error", "access_denied")
+            return cookie
+        }},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            o.server.Tamper = test.tamper
+            defer func() { o.server.Tamper = nil }()
+            cookie, query := o.login(t)
+            if test.edit != nil {
+                cookie = test.edit(cookie, query)
+            }
+            if status := o.callback(cookie, query); status != test.status {
+                t.Errorf("callback status = %d, want %d", status, test.status)
+            }
+        })
+    }
+    if o.identity(t, "sub-1") != nil {
+        t.Error("a rejected login linked an identity")
+    }
+}
@@ -1,11 +1,17 @@
 package controllers
 
 import (
+    "encoding/json"
+    "errors"
     "github.com/gorilla/mux"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/auth"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
     "github.com/Mohammad007/GoExpressRestAPI/internal/framework"
     "github.com/Mohammad007/GoExpressRestAPI/internal/models"
     "net/http"
     "strconv"
+    "strings"
+    "time"
 )
 
 func CreateUser(app *framework.App) func(r *http.Request, res *framework.Response) {
@@ -19,25 +25,115 @@ func CreateUser(app *framework.App) func(r *http.Request, res *framework.Respons
             res.Error(http.StatusBadRequest, "Validation failed: "+err.Error())
             return
         }
-        if err := app.DB().CreateUser(app.Context(), &user); err != nil {
-            res.Error(http.StatusInternalServerError, "Failed to create user")
+        if !isAdmin(r) || user.Role == "" {
+            user.Role = models.RoleUser
+        }
+        if err := hashPassword(&user); err != nil {
+            res.Error(http.StatusInternalServerError, "Failed to hash password")
+            return
+        }
+        if err := app.RequestDB(r).CreateUser(app.Context(), &user); err != nil {
+            res.DBError(err, "User", "Failed to create user")
             return
         }
+        res.ETag(uint64(user.Version))
         res.Status(http.StatusCreated).Success("User created successfully", user)
     }
 }
 
+// UpsertUserByEmail creates the user with the email in the path, answering
+// 201, or updates it if it exists, answering 200. The role and password of an
+// existing user are kept when the body leaves them out.
+func UpsertUserByEmail(app *framework.App) func(r *http.Request, res *framework.Response) {
+    return func(r *http.Request, res *framework.Response) {
+        email := mux.Vars(r)["email"]
+        var user models.User
+        if err := app.ParseBody(r, &user); err != nil {
+            res.Error(http.StatusBadRequest, "Invalid request payload")
+            return
+        }
+        if user.Email != "" && !strings.EqualFold(user.Email, email) {
+            res.Error(http.StatusBadRequest, "Email in the body does not match the URL")
+            return
+        }
+        user.UserSchema = models.UserSchema{
+            Name:     user.Name,
+            Email:    email,
+            Role:     user.Role,
+            Password: user.Password,
+        }
+        if err := user.Validate(); err != nil {
+            res.Error(http.StatusBadRequest, "Validation failed: "+err.Error())
+            return
+        }
+        if err := hashPassword(&user); err != nil {
+            res.Error(http.StatusInternalServerError, "Failed to hash password")
+            return
+        }
+        created, err := app.RequestDB(r).UpsertUserByEmail(app.Context(), &user)
+        if err != nil {
+            res.DBError(err, "User", "Failed to save user")
+            return
+        }
+        res.ETag(uint64(user.Version))
+        if created {
+            res.Status(http.StatusCreated).Success("User created successfully", user)
+            return
+        }
+        res.Success("User updated successfully", user)
+    }
+}
+
 func GetAllUsers(app *framework.App) func(r *http.Request, res *framework.Response) {
     return func(r *http.Request, res *framework.Response) {
-        users, err := app.DB().GetAllUsers(app.Context())
+        opts, err := app.ParseListOptions(r, database.UserFields)
+        if err != nil {
+            res.Error(http.StatusBadRequest, err.Error())
+            return
+        }
+        if opts.IncludeDeleted && !isAdmin(r) {
+            res.Error(http.StatusForbidden, "Only admins can list deleted users")
+            return
+        }
+        users, total, err := app.RequestDB(r).ListUsers(app.Context(), opts)
+        if err != nil {
+            res.DBError(err, "User", "Failed to fetch users")
+            return
+        }
+        app.Paginate(res, r, "Users fetched successfully", users, opts, total)
+    }
+}
+
+func SearchUsers(app *framework.App) func(r *http.Request, res *framework.Response) {
+    return func(r *http.Request, res *framework.Response) {
+        opts, err := app.ParseListOptions(r, database.UserFields)
+        if err != nil {
+            res.Error(http.StatusBadRequest, err.Error())
+            return
+        }
+        if opts.IncludeDeleted && !isAdmin(r) {
+            res.Error(http.StatusForbidden, "Only admins can list deleted users")
+            return
+        }
+        if opts.Cursor != nil {
+            res.Error(http.StatusBadRequest, "Search results cannot be paged with cursors")
+            return
+        }
+        users, total, err := app.RequestDB(r).SearchUsers(app.Context(), r.URL.Query().Get("q"), opts)
+        if errors.Is(err, database.ErrEmptySearch) {
+            res.Error(http.StatusBadRequest, "Search query is required")
+            return
+        }
         if err != nil {
-            res.Error(http.StatusInternalServerError, "Failed to fetch users")
+            res.DBError(err, "User", "Failed to search users")
             return
         }
-        res.Success("Users fetched successfully", users)
+        app.PaginateOffset(res, r, "Users fetched successfully", users, opts, total)
     }
 }
 
+// GetUserByID returns a user. With as_of, an RFC 3339 time, it returns the user
+// as it was then, rebuilt from the audit log, to the user and admins.
 func GetUserByID(app *framework.App) func(r *http.Request, res *framework.Response) {
     return func(r *http.Request, res *framework.Response) {
         vars := mux.Vars(r)
@@ -46,15 +142,46 @@ func GetUserByID(app *framework.App) func(r *http.Request, res *framework.Respon
             res.Error(http.StatusBadRequest, "Invalid user ID")
             return
         }
-        user, err := app.DB().GetUserByID(app.Context(), uint(id))
+        if asOf := r.URL.Query().Get("as_of"); asOf != "" {
+            getUserAsOf(app, r, res, uint(id), asOf)
+            return
+        }
+        user, err := app.RequestDB(r).GetUserByID(app.Context(), uint(id))
         if err != nil {
-            res.Error(http.StatusNotFound, "User not found")
+            res.DBError(err, "User", "Failed to fetch user")
             return
         }
+        res.ETag(uint64(user.Version))
         res.Success("User fetched successfully", user)
     }
 }
 
+func getUserAsOf(app *framework.App, r *http.Request, res *framework.Response, id uint, asOf string) {
+    at, err := time.Parse(time.RFC3339, asOf)
+    if err != nil {
+        res.Error(http.StatusBadRequest, "as_of must be an RFC 3339 time")
+        return
+    }
+    if !canReadHistory(r, mux.Vars(r)["id"]) {
+        res.Error(http.StatusForbidden, "Only admins can read the history of other users")
+        return
+    }
+    history, err := database.LoadUserHistory(app.Context(), app.RequestDB(r), id, at)
+    if err != nil {
+        res.DBError(err, "User", "Failed to fetch user history")
+        return
+    }
+    user, err := history.AsOf(at)
+    if err != nil {
+        res.DBError(err, "User", "Failed to fetch user")
+        return
+    }
+    res.Success("User fetched successfully", user)
+}
+
+// UpdateUser replaces the fields a client may change. The ID, timestamps,
+// version and password hash are kept, and only the columns that differ are
+// written.
 func UpdateUser(app *framework.App) func(r *http.Request, res *framework.Response) {
     return func(r *http.Request, res *framework.Response) {
         vars := mux.Vars(r)
@@ -63,24 +190,126 @@ func UpdateUser(app *framework.App) func(r *http.Request, res *framework.Respons
             res.Error(http.StatusBadRequest, "Invalid user ID")
             return
         }
+        if !canModifyUser(r, vars["id"]) {
+            res.Error(http.StatusForbidden, "Only admins can modify other users")
+            return
+        }
         var user models.User
         if err := app.ParseBody(r, &user); err != nil {
             res.Error(http.StatusBadRequest, "Invalid request payload")
             return
         }
-        if err := user.Validate(); err != nil {
-            res.Error(http.StatusBadRequest, "Validation failed: "+err.Error())
+        existing, err := app.RequestDB(r).GetUserByID(app.Context(), uint(id))
+        if err != nil {
+            res.DBError(err, "User", "Failed to fetch user")
             return
         }
-        user.ID = uint(id)
-        if err := app.DB().UpdateUser(app.Context(), &user); err != nil {
-            res.Error(http.StatusInternalServerError, "Failed to update user")
+        if !app.CheckPrecondition(r, res, uint64(existing.Version)) {
             return
         }
-        res.Success("User updated successfully", user)
+        saveUser(app, r, res, existing, &user)
     }
 }
 
+// PatchUser applies a JSON merge patch or a JSON patch to a user, see
+// framework.ApplyPatch
+func PatchUser(app *framework.App) func(r *http.Request, res *framework.Response) {
+    return func(r *http.Request, res *framework.Response) {
+        vars := mux.Vars(r)
+        id, err := strconv.Atoi(vars["id"])
+        if err != nil {
+            res.Error(http.StatusBadRequest, "Invalid user ID")
+            return
+        }
+        if !canModifyUser(r, vars["id"]) {
+            res.Error(http.StatusForbidden, "Only admins can modify other users")
+            return
+        }
+        existing, err := app.RequestDB(r).GetUserByID(app.Context(), uint(id))
+        if err != nil {
+            res.DBError(err, "User", "Failed to fetch user")
+            return
+        }
+        if !app.CheckPrecondition(r, res, uint64(existing.Version)) {
+            return
+        }
+        doc, err := json.Marshal(existing)
+        if err != nil {
+            res.Error(http.StatusInternalServerError, "Failed to encode user")
+            return
+        }
+        patched, err := framework.ApplyPatch(r, doc)
+        if err != nil {
+            res.PatchFailed(err)
+            return
+        }
+        var user models.User
+        if err := json.Unmarshal(patched, &user); err != nil {
+            res.Error(http.StatusBadRequest, "Invalid patch: "+err.Error())
+            return
+        }
+        saveUser(app, r, res, existing, &user)
+    }
+}
+
+// saveUser validates the new state of existing and writes the columns that
+// changed. The write fails with a 412 if the user changed since existing was
+// read.
+func saveUser(app *framework.App, r *http.Request, res *framework.Response, existing, user *models.User) {
+    changes, httpErr := userChanges(r, existing, user)
+    if httpErr != nil {
+        res.Error(httpErr.Status, httpErr.Message)
+        return
+    }
+    if len(changes) > 0 {
+        if err := app.RequestDB(r).PatchUser(app.Context(), existing.ID, changes); err != nil {
+            res.DBError(err, "User", "Failed to update user")
+            return
+        }
+    }
+    updated, err := app.RequestDB(r).GetUserByID(app.Context(), existing.ID)
+    if err != nil {
+        res.DBError(err, "User", "Failed to fetch user")
+        return
+    }
+    res.ETag(uint64(updated.Version))
+    res.Success("User updated successfully", updated)
+}
+
+// userChanges checks the new state of existing and returns the columns to
+// write, or the error to answer with. Clients cannot change the ID, the
+// timestamps, the version or the password hash directly, and only admins can
+// change roles. A new password is only taken from the user itself, along with
+// its current password.
+func userChanges(r *http.Request, existing, user *models.User) (map[string]interface{}, *framework.HTTPError) {
+    if user.Password != "" {
+        if httpErr := checkPasswordChange(r, existing, user.CurrentPassword); httpErr != nil {
+            return nil, httpErr
+        }
+    }
+    user.CurrentPassword = ""
+    user.ID = existing.ID
+    user.CreatedAt = existing.CreatedAt
+    user.UpdatedAt = existing.UpdatedAt
+    user.DeletedAt = existing.DeletedAt
+    user.Version = existing.Version
+    user.PasswordHash = existing.PasswordHash
+    if !isAdmin(r) || user.Role == "" {
+        user.Role = existing.Role
+    }
+    if err := user.Validate(); err != nil {
+        return nil, &framework.HTTPError{Status: http.StatusBadRequest, Message: "Validation failed: " + err.Error()}
+    }
+    if err := hashPassword(user); err != nil {
+        return nil, &framework.HTTPError{Status: http.StatusInternalServerError, Message: "Failed to hash password"}
+    }
+    changes, err := database.Changes(existing, user)
+    if err != nil {
+        return nil, &framework.HTTPError{Status: http.StatusInternalServerError, Message: "Failed to update user"}
+    }
+    return changes, nil
+}
+
 func DeleteUser(app *framework.App) func(r *http.Request, res *framework.Response) {
     return func(r *http.Request, res *framework.Response) {
         vars := mux.Vars(r)
@@ -89,10 +318,122 @@ func DeleteUser(app *framework.App) func(r *http.Request, res *framework.Respons
             res.Error(http.StatusBadRequest, "Invalid user ID")
             return
         }
-        if err := app.DB().DeleteUser(app.Context(), uint(id)); err != nil {
-            res.Error(http.StatusInternalServerError, "Failed to delete user")
+        if !canModifyUser(r, vars["id"]) {
+            res.Error(http.StatusForbidden, "Only admins can delete other users")
+            return
+        }
+        if r.URL.Query().Get("purge") == "true" {
+            if !isAdmin(r) {
+                res.Error(http.StatusForbidden, "Only admins can purge users")
+                return
+            }
+            existing, err := getUserWithDeleted(app, r, uint(id))
+            if err != nil {
+                res.DBError(err, "User", "Failed to fetch user")
+                return
+            }
+            if !app.CheckPrecondition(r, res, uint64(existing.Version)) {
+                return
+            }
+            if err := app.RequestDB(r).PurgeUser(app.Context(), uint(id), existing.Version); err != nil {
+                res.DBError(err, "User", "Failed to purge user")
+                return
+            }
+            res.Success("User purged successfully", nil)
+            return
+        }
+        existing, err := app.RequestDB(r).GetUserByID(app.Context(), uint(id))
+        if err != nil {
+            res.DBError(err, "User", "Failed to fetch user")
+            return
+        }
+        if !app.CheckPrecondition(r, res, uint64(existing.Version)) {
+            return
+        }
+        // The version read is the one deleted, so a write in between fails
+        // the delete rather than being lost
+        if err := app.RequestDB(r).DeleteUser(app.Context(), uint(id), existing.Version); err != nil {
+            res.DBError(err, "User", "Failed to delete user")
             return
         }
         res.Success("User deleted successfully", nil)
     }
+}
+
+// getUserWithDeleted returns the user with the ID whether it is soft deleted
+// or not
+func getUserWithDeleted(app *framework.App, r *http.Request, id uint) (*models.User, error) {
+    users, _, err := app.RequestDB(r).ListUsers(app.Context(), database.ListOptions{
+        Where:          database.Filter{Field: "id", Op: database.OpEq, Value: id},
+        Limit:          1,
+        IncludeDeleted: true,
+    })
+    if err != nil {
+        return nil, err
+    }
+    if len(users) == 0 {
+        return nil, database.ErrNotFound
+    }
+    return &users[0], nil
+}
+
+func RestoreUser(app *framework.App) func(r *http.Request, res *framework.Response) {
+    return func(r *http.Request, res *framework.Response) {
+        vars := mux.Vars(r)
+        id, err := strconv.Atoi(vars["id"])
+        if err != nil {
+            res.Error(http.StatusBadRequest, "Invalid user ID")
+            return
+        }
+        if err := app.RequestDB(r).RestoreUser(app.Context(), uint(id)); err != nil {
+            res.DBError(err, "Deleted user", "Failed to restore user")
+            return
+        }
+        user, err := app.RequestDB(r).GetUserByID(app.Context(), uint(id))
+        if err != nil {
+            res.DBError(err, "User", "Failed to fetch user")
+            return
+        }
+        res.ETag(uint64(user.Version))
+        res.Success("User restored successfully", user)
+    }
+}
+
+// hashPassword replaces a plain-text password sent by the client with its hash
+func hashPassword(user *models.User) error {
+    if user.Password == "" {
+        return nil
+    }
+    hash, err := auth.HashPassword(user.Password)
+    if err != nil {
+        return err
+    }
+    user.PasswordHash = hash
+    user.Password = ""
+    return nil
+}
+
+// canModifyUser tells whether the request may change the user with the given
+// ID: itself, or anyone for admins
+func canModifyUser(r *http.Request, id string) bool {
+    claims, ok := auth.ClaimsFromContext(r.Context())
+    return isAdmin(r) || ok && claims.Subject == id
+}
+
+// checkPasswordChange allows a password change only to the user itself, not
+// while impersonated, and only with its current password if it has one
+func checkPasswordChange(r *http.Request, existing *models.User, current string) *framework.HTTPError {
+    claims, ok := auth.ClaimsFromContext(r.Context())
+    if !ok || claims.Impersonating() || claims.Subject != strconv.FormatUint(uint64(existing.ID), 10) {
+        return &framework.HTTPError{Status: http.StatusForbidden, Message: "Only the user can change its password"}
+    }
+    if existing.PasswordHash != "" && !auth.CheckPassword(existing.PasswordHash, current) {
+        return &framework.HTTPError{Status: http.StatusForbidden, Message: "Current password is incorrect"}
+    }
+    return nil
+}
+
+func isAdmin(r *http.Request) bool {
+    claims, ok := auth.ClaimsFromContext(r.Context())
+    return ok && claims.Role == models.RoleAdmin
 }
\ No newline at end of file
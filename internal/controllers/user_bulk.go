@@ -0,0 +1,278 @@
+package controllers
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/framework"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "net/http"
+    "runtime"
+    "sync"
+)
+
+// BulkCreateUsers creates up to framework.MaxBulkItems users from
+// {"items": [...]} with batched inserts
+func BulkCreateUsers(app *framework.App) func(r *http.Request, res *framework.Response) {
+    return func(r *http.Request, res *framework.Response) {
+        var body struct {
+            Items []models.User `json:"items"`
+        }
+        if err := app.ParseBody(r, &body); err != nil {
+            res.Error(http.StatusBadRequest, "Invalid request payload")
+            return
+        }
+        bulk, ok := framework.NewBulk(r, res, len(body.Items))
+        if !ok {
+            return
+        }
+        users := body.Items
+        for i := range users {
+            user := &users[i]
+            user.UserSchema = models.UserSchema{
+                Name:     user.Name,
+                Email:    user.Email,
+                Role:     user.Role,
+                Password: user.Password,
+            }
+            if user.Role == "" {
+                user.Role = models.RoleUser
+            }
+            if err := user.Validate(); err != nil {
+                bulk.Fail(i, http.StatusBadRequest, "Validation failed: "+err.Error())
+            }
+        }
+        for i, err := range hashPasswords(users, bulk.Pending()) {
+            if err != nil {
+                bulk.Fail(i, http.StatusInternalServerError, "Failed to hash password")
+            }
+        }
+        err := bulk.Run(app, r, func(db database.Database) {
+            pending := bulk.Pending()
+            batch := make([]*models.User, len(pending))
+            for j, i := range pending {
+                batch[j] = &users[i]
+            }
+            for j, err := range db.CreateUsers(app.Context(), batch) {
+                if err != nil {
+                    bulk.FailDB(pending[j], err, "User", "Failed to create user")
+                } else {
+                    bulk.Succeed(pending[j], http.StatusCreated, batch[j])
+                }
+            }
+        })
+        if err != nil {
+            res.DBError(err, "User", "Failed to create users")
+            return
+        }
+        bulk.Respond(res, http.StatusCreated, "Users created successfully")
+    }
+}
+
+// hashPasswords hashes the passwords of the given users on every CPU, since
+// bcrypt dominates the cost of a large import. It returns the errors by index.
+func hashPasswords(users []models.User, indexes []int) map[int]error {
+    errs := map[int]error{}
+    var mu sync.Mutex
+    var wg sync.WaitGroup
+    work := make(chan int)
+    for w := 0; w < runtime.NumCPU(); w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for i := range work {
+                if err := hashPassword(&users[i]); err != nil {
+                    mu.Lock()
+                    errs[i] = err
+                    mu.Unlock()
+                }
+            }
+        }()
+    }
+    for _, i := range indexes {
+        work <- i
+    }
+    close(work)
+    wg.Wait()
+    return errs
+}
+
+// bulkUserItem is one item of a bulk patch or delete. Version works like
+// If-Match for that user.
+type bulkUserItem struct {
+    ID      uint            `json:"id"`
+    Version *uint           `json:"version"`
+    Patch   json.RawMessage `json:"patch"`
+}
+
+// parseBulkItems reads {"items": [...]} and fails the items that name no
+// user or, in strict mode, no version
+func parseBulkItems(app *framework.App, r *http.Request, res *framework.Response) ([]bulkUserItem, *framework.Bulk, bool) {
+    var body struct {
+        Items []bulkUserItem `json:"items"`
+    }
+    if err := app.ParseBody(r, &body); err != nil {
+        res.Error(http.StatusBadRequest, "Invalid request payload")
+        return nil, nil, false
+    }
+    bulk, ok := framework.NewBulk(r, res, len(body.Items))
+    if !ok {
+        return nil, nil, false
+    }
+    for i, item := range body.Items {
+        switch {
+        case item.ID == 0:
+            bulk.Fail(i, http.StatusBadRequest, "Invalid user ID")
+        case item.Version == nil && app.StrictPreconditions():
+            bulk.Fail(i, http.StatusPreconditionRequired, "This request requires a version for every item")
+        }
+    }
+    return body.Items, bulk, true
+}
+
+// BulkPatchUsers applies a patch to each user of {"items": [{"id": 1,
+// "version": 3, "patch": ...}]}. A patch is a JSON merge patch object or a
+// JSON patch array, checked as PatchUser does.
+func BulkPatchUsers(app *framework.App) func(r *http.Request, res *framework.Response) {
+    return func(r *http.Request, res *framework.Response) {
+        items, bulk, ok := parseBulkItems(app, r, res)
+        if !ok {
+            return
+        }
+        ids := make([]uint, len(items))
+        for i, item := range items {
+            ids[i] = item.ID
+        }
+        stored, err := app.RequestDB(r).GetUsersByIDs(app.Context(), ids)
+        if err != nil {
+            res.DBError(err, "User", "Failed to fetch users")
+            return
+        }
+        existing := map[uint]*models.User{}
+        for i := range stored {
+            existing[stored[i].ID] = &stored[i]
+        }
+        patches := map[int]database.BulkItem{}
+        for _, i := range bulk.Pending() {
+            item := items[i]
+            user, found := existing[item.ID]
+            switch {
+            case !found:
+                bulk.Fail(i, http.StatusNotFound, "User not found")
+                continue
+            case item.Version != nil && *item.Version != user.Version:
+                bulk.Fail(i, http.StatusPreconditionFailed, "User was changed since it was read")
+                continue
+            }
+            patched, httpErr := patchUser(r, user, item.Patch)
+            if httpErr != nil {
+                bulk.Fail(i, httpErr.Status, httpErr.Message)
+                continue
+            }
+            changes, httpErr := userChanges(r, user, patched)
+            if httpErr != nil {
+                bulk.Fail(i, httpErr.Status, httpErr.Message)
+                continue
+            }
+            if len(changes) == 0 {
+                bulk.Succeed(i, http.StatusOK, user)
+                continue
+            }
+            patches[i] = database.BulkItem{ID: item.ID, Changes: changes}
+        }
+        err = bulk.Run(app, r, func(db database.Database) {
+            var indexes []int
+            var batch []database.BulkItem
+            var changed []uint
+            for _, i := range bulk.Pending() {
+                indexes = append(indexes, i)
+                batch = append(batch, patches[i])
+                changed = append(changed, items[i].ID)
+            }
+            if len(batch) == 0 {
+                return
+            }
+            for j, err := range db.PatchUsers(app.Context(), batch) {
+                if err != nil {
+                    bulk.FailDB(indexes[j], err, "User", "Failed to update user")
+                }
+            }
+            updated, err := db.GetUsersByIDs(app.Context(), changed)
+            byID := map[uint]*models.User{}
+            for k := range updated {
+                byID[updated[k].ID] = &updated[k]
+            }
+            for _, i := range bulk.Pending() {
+                if user, found := byID[items[i].ID]; err == nil && found {
+                    bulk.Succeed(i, http.StatusOK, user)
+                } else {
+                    bulk.Succeed(i, http.StatusOK, nil)
+                }
+            }
+        })
+        if err != nil {
+            res.DBError(err, "User", "Failed to update users")
+            return
+        }
+        bulk.Respond(res, http.StatusOK, "Users updated successfully")
+    }
+}
+
+// patchUser applies a merge patch or a JSON patch to a copy of user
+func patchUser(r *http.Request, user *models.User, patch json.RawMessage) (*models.User, *framework.HTTPError) {
+    doc, err := json.Marshal(user)
+    if err != nil {
+        return nil, &framework.HTTPError{Status: http.StatusInternalServerError, Message: "Failed to encode user"}
+    }
+    var patched []byte
+    if bytes.HasPrefix(bytes.TrimSpace(patch), []byte("[")) {
+        patched, err = framework.JSONPatch(doc, patch)
+    } else {
+        patched, err = framework.MergePatch(doc, patch)
+    }
+    switch {
+    case errors.Is(err, framework.ErrPatchTest):
+        return nil, &framework.HTTPError{Status: http.StatusConflict, Message: err.Error()}
+    case err != nil:
+        return nil, &framework.HTTPError{Status: http.StatusBadRequest, Message: "Invalid patch: " + err.Error()}
+    }
+    var result models.User
+    if err := json.Unmarshal(patched, &result); err != nil {
+        return nil, &framework.HTTPError{Status: http.StatusBadRequest, Message: "Invalid patch: " + err.Error()}
+    }
+    return &result, nil
+}
+
+// BulkDeleteUsers soft deletes each user of {"items": [{"id": 1, "version":
+// 3}]}
+func BulkDeleteUsers(app *framework.App) func(r *http.Request, res *framework.Response) {
+    return func(r *http.Request, res *framework.Response) {
+        items, bulk, ok := parseBulkItems(app, r, res)
+        if !ok {
+            return
+        }
+        err := bulk.Run(app, r, func(db database.Database) {
+            pending := bulk.Pending()
+            batch := make([]database.BulkItem, len(pending))
+            for j, i := range pending {
+                batch[j] = database.BulkItem{ID: items[i].ID}
+                if items[i].Version != nil {
+                    batch[j].Version = *items[i].Version
+                }
+            }
+            for j, err := range db.DeleteUsers(app.Context(), batch) {
+                if err != nil {
+                    bulk.FailDB(pending[j], err, "User", "Failed to delete user")
+                } else {
+                    bulk.Succeed(pending[j], http.StatusOK, nil)
+                }
+            }
+        })
+        if err != nil {
+            res.DBError(err, "User", "Failed to delete users")
+            return
+        }
+        bulk.Respond(res, http.StatusOK, "Users deleted successfully")
+    }
+}
@@ -0,0 +1,167 @@
+package controllers
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/framework"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+// bulkRequest sends body to a bulk handler as an admin and returns the
+// response status and the status of each item
+func bulkRequest(t *testing.T, handler func(r *http.Request, res *framework.Response), query, body string) (int, []int) {
+    t.Helper()
+    request := httptest.NewRequest(http.MethodPost, "/users/bulk"+query, strings.NewReader(body))
+    recorder := serve(handler, request, admin, nil)
+    var response struct {
+        Data framework.BulkResponse `json:"data"`
+    }
+    if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+        t.Fatalf("decoding %s: %v", recorder.Body, err)
+    }
+    statuses := make([]int, len(response.Data.Results))
+    for i, result := range response.Data.Results {
+        if result.Index != i {
+            t.Errorf("result %d has index %d", i, result.Index)
+        }
+        statuses[i] = result.Status
+    }
+    return recorder.Code, statuses
+}
+
+func TestBulkCreateUsers(t *testing.T) {
+    app := newTestApp(t)
+    createTestUser(t, app, "Ann", "ann@example.com")
+    items := `{"items": [
+        {"name": "Bob", "email": "bob@example.com", "password": "password123"},
+        {"name": "C", "email": "not an email"},
+        {"name": "Ann", "email": "ann@example.com"},
+        {"name": "Dee", "email": "dee@example.com"}
+    ]}`
+    tests := []struct {
+        name     string
+        query    string
+        status   int
+        statuses []int
+        created  []string
+    }{
+        // A failed check aborts an atomic request before anything is written
+        {"atomic", "?atomic=true", http.StatusUnprocessableEntity, []int{424, 400, 424, 424}, nil},
+        {"non-atomic", "", http.StatusMultiStatus, []int{201, 400, 409, 201}, []string{"bob@example.com", "dee@example.com"}},
+    }
+    for _, test := range tests {
+        status, statuses := bulkRequest(t, BulkCreateUsers(app), test.query, items)
+        if status != test.status || !reflect.DeepEqual(statuses, test.statuses) {
+            t.Errorf("%s: status %d with %v, want %d with %v", test.name, status, statuses, test.status, test.statuses)
+        }
+        for _, email := range test.created {
+            if _, err := app.DB().GetUserByEmail(context.Background(), email); err != nil {
+                t.Errorf("%s: %s was not created: %v", test.name, email, err)
+            }
+        }
+    }
+    bob, err := app.DB().GetUserByEmail(context.Background(), "bob@example.com")
+    if err != nil || bob.PasswordHash == "" || bob.Password != "" {
+        t.Errorf("Bob's password was not hashed: %+v, %v", bob, err)
+    }
+
+    // An item the database rejects rolls back the ones written before it
+    status, statuses := bulkRequest(t, BulkCreateUsers(app), "?atomic=true", `{"items": [
+        {"name": "Eve", "email": "eve@example.com"},
+        {"name": "Ann", "email": "ann@example.com"}
+    ]}`)
+    if status != http.StatusUnprocessableEntity || !reflect.DeepEqual(statuses, []int{424, 409}) {
+        t.Errorf("atomic conflict: status %d with %v, want 422 with [424 409]", status, statuses)
+    }
+    if _, err := app.DB().GetUserByEmail(context.Background(), "eve@example.com"); !errors.Is(err, database.ErrNotFound) {
+        t.Errorf("Eve after the rollback: %v, want ErrNotFound", err)
+    }
+}
+
+func TestBulkPatchUsers(t *testing.T) {
+    app := newTestApp(t)
+    ctx := context.Background()
+    ann := createTestUser(t, app, "Ann", "ann@example.com")
+    bob := createTestUser(t, app, "Bob", "bob@example.com")
+    createTestUser(t, app, "Cy", "cy@example.com")
+    id := func(id uint) string { return strconv.FormatUint(uint64(id), 10) }
+
+    status, statuses := bulkRequest(t, BulkPatchUsers(app), "", `{"items": [
+        {"id": `+id(ann.ID)+`, "version": 1, "patch": {"name": "Anna"}},
+        {"id": 999, "patch": {"name": "Nobody"}},
+        {"id": `+id(bob.ID)+`, "version": 7, "patch": {"name": "Bobby"}},
+        {"id": `+id(bob.ID)+`, "patch": [{"op": "test", "path": "/name", "value": "Rob"}]},
+        {"id": `+id(bob.ID)+`, "patch": {"email": "cy@example.com"}},
+        {"id": 0, "patch": {}}
+    ]}`)
+    if want := []int{200, 404, 412, 409, 409, 400}; status != http.StatusMultiStatus || !reflect.DeepEqual(statuses, want) {
+        t.Errorf("non-atomic: status %d with %v, want 207 with %v", status, statuses, want)
+    }
+    if user, err := app.DB().GetUserByID(ctx, ann.ID); err != nil || user.Name != "Anna" || user.Version != 2 {
+        t.Errorf("Ann after the patch: %+v, %v", user, err)
+    }
+
+    // The conflict on Bob's email rolls back Ann's rename
+    status, statuses = bulkRequest(t, BulkPatchUsers(app), "?atomic=true", `{"items": [
+        {"id": `+id(ann.ID)+`, "version": 2, "patch": {"name": "Annie"}},
+        {"id": `+id(bob.ID)+`, "patch": {"email": "cy@example.com"}}
+    ]}`)
+    if status != http.StatusUnprocessableEntity || !reflect.DeepEqual(statuses, []int{424, 409}) {
+        t.Errorf("atomic: status %d with %v, want 422 with [424 409]", status, statuses)
+    }
+    if user, err := app.DB().GetUserByID(ctx, ann.ID); err != nil || user.Name != "Anna" || user.Version != 2 {
+        t.Errorf("Ann after the rollback: %+v, %v, want the user unchanged", user, err)
+    }
+}
+
+func TestBulkDeleteUsers(t *testing.T) {
+    app := newTestApp(t)
+    ctx := context.Background()
+    ann := createTestUser(t, app, "Ann", "ann@example.com")
+    bob := createTestUser(t, app, "Bob", "bob@example.com")
+    cy := createTestUser(t, app, "Cy", "cy@example.com")
+    id := func(id uint) string { return strconv.FormatUint(uint64(id), 10) }
+
+    // Bob's stale version is only found when deleting, after Ann is gone
+    status, statuses := bulkRequest(t, BulkDeleteUsers(app), "?atomic=true", `{"items": [
+        {"id": `+id(ann.ID)+`},
+        {"id": `+id(bob.ID)+`, "version": 7}
+    ]}`)
+    if status != http.StatusUnprocessableEntity || !reflect.DeepEqual(statuses, []int{424, 412}) {
+        t.Errorf("atomic: status %d with %v, want 422 with [424 412]", status, statuses)
+    }
+    if _, err := app.DB().GetUserByID(ctx, ann.ID); err != nil {
+        t.Errorf("Ann after the rollback: %v, want the user kept", err)
+    }
+
+    status, statuses = bulkRequest(t, BulkDeleteUsers(app), "", `{"items": [
+        {"id": `+id(ann.ID)+`},
+        {"id": `+id(bob.ID)+`, "version": 7},
+        {"id": `+id(cy.ID)+`, "version": 1},
+        {"id": 999}
+    ]}`)
+    if want := []int{200, 412, 200, 404}; status != http.StatusMultiStatus || !reflect.DeepEqual(statuses, want) {
+        t.Errorf("non-atomic: status %d with %v, want 207 with %v", status, statuses, want)
+    }
+    for _, user := range []uint{ann.ID, cy.ID} {
+        if _, err := app.DB().GetUserByID(ctx, user); !errors.Is(err, database.ErrNotFound) {
+            t.Errorf("user %d after the delete: %v, want ErrNotFound", user, err)
+        }
+    }
+    if _, err := app.DB().GetUserByID(ctx, bob.ID); err != nil {
+        t.Errorf("Bob after a stale delete: %v, want the user kept", err)
+    }
+
+    app.SetStrictPreconditions(true)
+    status, statuses = bulkRequest(t, BulkDeleteUsers(app), "", `{"items": [{"id": `+id(bob.ID)+`}]}`)
+    if status != http.StatusMultiStatus || !reflect.DeepEqual(statuses, []int{428}) {
+        t.Errorf("strict: status %d with %v, want 207 with [428]", status, statuses)
+    }
+}
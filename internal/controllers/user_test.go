@@ -0,0 +1,175 @@
+package controllers
+
+import (
+    "context"
+    "errors"
+    "github.com/gorilla/mux"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/auth"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/framework"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+var admin = &auth.Claims{Subject: "1000", Role: models.RoleAdmin}
+
+// serve runs a handler for a request made with claims, with vars as the
+// route variables
+func serve(handler func(r *http.Request, res *framework.Response), request *http.Request, claims *auth.Claims, vars map[string]string) *httptest.ResponseRecorder {
+    if claims != nil {
+        request = request.WithContext(auth.WithClaims(request.Context(), claims))
+    }
+    request = mux.SetURLVars(request, vars)
+    recorder := httptest.NewRecorder()
+    handler(request, framework.NewResponse(recorder))
+    return recorder
+}
+
+func createTestUser(t *testing.T, app *framework.App, name, email string) *models.User {
+    t.Helper()
+    user := models.NewUser(name, email)
+    if err := app.DB().CreateUser(context.Background(), user); err != nil {
+        t.Fatal(err)
+    }
+    return user
+}
+
+func TestDeleteUserPreconditions(t *testing.T) {
+    app := newTestApp(t)
+    user := createTestUser(t, app, "Ann", "ann@example.com")
+    id := strconv.FormatUint(uint64(user.ID), 10)
+    del := func(query, ifMatch string) int {
+        request := httptest.NewRequest(http.MethodDelete, "/users/"+id+query, nil)
+        if ifMatch != "" {
+            request.Header.Set("If-Match", ifMatch)
+        }
+        return serve(DeleteUser(app), request, admin, map[string]string{"id": id}).Code
+    }
+
+    tests := []struct {
+        name, query, ifMatch string
+        strict               bool
+        status               int
+    }{
+        {"stale delete", "", framework.ETag(9), false, http.StatusPreconditionFailed},
+        {"stale purge", "?purge=true", framework.ETag(9), false, http.StatusPreconditionFailed},
+        {"strict delete", "", "", true, http.StatusPreconditionRequired},
+        {"strict purge", "?purge=true", "", true, http.StatusPreconditionRequired},
+        {"delete", "", framework.ETag(1), true, http.StatusOK},
+        {"delete again", "", framework.ETag(2), true, http.StatusNotFound},
+        // A purge finds soft-deleted users, which are at their next version
+        {"stale purge of a deleted user", "?purge=true", framework.ETag(1), true, http.StatusPreconditionFailed},
+        {"purge of a deleted user", "?purge=true", framework.ETag(2), true, http.StatusOK},
+        {"purge again", "?purge=true", "*", true, http.StatusNotFound},
+    }
+    for _, test := range tests {
+        app.SetStrictPreconditions(test.strict)
+        if status := del(test.query, test.ifMatch); status != test.status {
+            t.Errorf("%s: status = %d, want %d", test.name, status, test.status)
+        }
+    }
+}
+
+func TestDeleteUserVersion(t *testing.T) {
+    // A write between reading a user and deleting it fails the delete
+    app := newTestApp(t)
+    ctx := context.Background()
+    for _, purge := range []bool{false, true} {
+        user := createTestUser(t, app, "Ann", "ann"+strconv.FormatBool(purge)+"@example.com")
+        if err := app.DB().PatchUser(ctx, user.ID, map[string]interface{}{"name": "Anna"}); err != nil {
+            t.Fatal(err)
+        }
+        remove := app.DB().DeleteUser
+        if purge {
+            remove = app.DB().PurgeUser
+        }
+        if err := remove(ctx, user.ID, user.Version); !errors.Is(err, database.ErrStale) {
+            t.Errorf("purge %v: error = %v, want ErrStale", purge, err)
+        }
+        if _, err := app.DB().GetUserByID(ctx, user.ID); err != nil {
+            t.Errorf("purge %v: the user is gone after a stale write: %v", purge, err)
+        }
+        if err := remove(ctx, user.ID, user.Version+1); err != nil {
+            t.Errorf("purge %v: %v", purge, err)
+        }
+        if err := remove(ctx, user.ID+100, 1); !errors.Is(err, database.ErrNotFound) {
+            t.Errorf("purge %v: error for a missing user = %v, want ErrNotFound", purge, err)
+        }
+    }
+}
+
+func TestUpsertUserByEmail(t *testing.T) {
+    app := newTestApp(t)
+    ctx := context.Background()
+    upsert := func(email, body string) *httptest.ResponseRecorder {
+        request := httptest.NewRequest(http.MethodPut, "/users/by-email/"+email, strings.NewReader(body))
+        return serve(UpsertUserByEmail(app), request, admin, map[string]string{"email": email})
+    }
+    var id uint
+    tests := []struct {
+        name, email, body string
+        status            int
+        version           uint
+        role              string
+    }{
+        {"create", "ann@example.com", `{"name": "Ann", "role": "admin", "password": "password123"}`, http.StatusCreated, 1, models.RoleAdmin},
+        {"update", "ann@example.com", `{"name": "Anna"}`, http.StatusOK, 2, models.RoleAdmin},
+        {"other case", "ANN@example.com", `{"name": "Annie", "role": "user"}`, http.StatusOK, 3, models.RoleUser},
+        {"deleted", "ann@example.com", `{"name": "Ann"}`, http.StatusOK, 5, models.RoleUser},
+        {"other user", "bob@example.com", `{"name": "Bob"}`, http.StatusCreated, 1, models.RoleUser},
+        {"mismatched email", "ann@example.com", `{"name": "Ann", "email": "bob@example.com"}`, http.StatusBadRequest, 0, ""},
+        {"invalid", "ann@example.com", `{"name": "A"}`, http.StatusBadRequest, 0, ""},
+    }
+    for _, test := range tests {
+        if test.name == "deleted" {
+            if err := app.DB().DeleteUser(ctx, id, 0); err != nil {
+                t.Fatal(err)
+            }
+        }
+        recorder := upsert(test.email, test.body)
+        if recorder.Code != test.status {
+            t.Errorf("%s: status %d, want %d: %s", test.name, recorder.Code, test.status, recorder.Body)
+            continue
+        }
+        if test.version == 0 {
+            continue
+        }
+        if etag := recorder.Header().Get("ETag"); etag != framework.ETag(uint64(test.version)) {
+            t.Errorf("%s: ETag %s, want version %d", test.name, etag, test.version)
+        }
+        user, err := app.DB().GetUserByEmail(ctx, test.email)
+        if err != nil || user.Version != test.version || user.Role != test.role {
+            t.Errorf("%s: %+v, %v, want version %d with role %s", test.name, user, err, test.version, test.role)
+            continue
+        }
+        if test.email != "bob@example.com" {
+            if id != 0 && user.ID != id {
+                t.Errorf("%s: upserted user %d, want %d", test.name, user.ID, id)
+            }
+            id = user.ID
+            // The password is kept when none is given
+            if user.Email != "ann@example.com" || user.PasswordHash == "" {
+                t.Errorf("%s: email %s, password hash %q, want the stored ones", test.name, user.Email, user.PasswordHash)
+            }
+        }
+    }
+
+    // The audit log tells creates from updates
+    entries, _, err := app.DB().ListAuditEntries(ctx, database.ListOptions{Sort: []database.SortField{{Field: "id"}}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    var actions []string
+    for _, entry := range entries {
+        actions = append(actions, entry.Action)
+    }
+    want := []string{models.AuditUserCreate, models.AuditUserUpdate, models.AuditUserUpdate, models.AuditUserDelete, models.AuditUserUpdate, models.AuditUserCreate}
+    if !reflect.DeepEqual(actions, want) {
+        t.Errorf("audit actions = %v, want %v", actions, want)
+    }
+}
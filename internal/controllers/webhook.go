@@ -0,0 +1,225 @@
+package controllers
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "github.com/gorilla/mux"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/framework"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "net/http"
+    "strconv"
+    "time"
+)
+
+// WebhookDeliveryFields are the delivery fields admins may sort and filter on
+var WebhookDeliveryFields = database.FieldsOf(models.WebhookDelivery{})
+
+type redeliveryResult struct {
+    Requeued int `json:"requeued"`
+}
+
+// PrepareWebhook is the BeforeSave hook of the webhook resource. It generates
+// a secret for a webhook created without one and keeps the stored secret when
+// an update leaves it out.
+func PrepareWebhook(r *http.Request, webhook, existing *models.Webhook) error {
+    switch {
+    case webhook.Secret != "":
+    case existing != nil:
+        webhook.Secret = existing.Secret
+    default:
+        secret, err := newWebhookSecret()
+        if err != nil {
+            return &framework.HTTPError{Status: http.StatusInternalServerError, Message: "Failed to generate webhook secret"}
+        }
+        webhook.Secret = secret
+    }
+    return nil
+}
+
+// ShowWebhookSecret is the Created option of the webhook resource: the create
+// response is the only one that carries the secret, besides rotation
+func ShowWebhookSecret(webhook *models.Webhook) interface{} {
+    return models.WebhookWithSecret(*webhook)
+}
+
+// RotateWebhookSecret replaces the secret of a webhook with a generated one
+// and responds with it. Deliveries are signed with the new secret from then
+// on, including retries of earlier events.
+func RotateWebhookSecret(app *framework.App) func(r *http.Request, res *framework.Response) {
+    return func(r *http.Request, res *framework.Response) {
+        webhook, ok := findWebhook(app, r, res)
+        if !ok {
+            return
+        }
+        secret, err := newWebhookSecret()
+        if err != nil {
+            res.Error(http.StatusInternalServerError, "Failed to generate webhook secret")
+            return
+        }
+        webhooks, err := database.NewRepository[models.Webhook](app.RequestDB(r))
+        if err != nil {
+            res.Error(http.StatusInternalServerError, "Failed to rotate webhook secret")
+            return
+        }
+        if err := webhooks.Patch(app.Context(), webhook.ID, map[string]interface{}{"secret": secret}); err != nil {
+            res.DBError(err, "Webhook", "Failed to rotate webhook secret")
+            return
+        }
+        if webhook, err = webhooks.Get(app.Context(), webhook.ID); err != nil {
+            res.DBError(err, "Webhook", "Failed to fetch webhook")
+            return
+        }
+        res.Success("Webhook secret rotated successfully", models.WebhookWithSecret(*webhook))
+    }
+}
+
+func newWebhookSecret() (string, error) {
+    secret := make([]byte, 32)
+    if _, err := rand.Read(secret); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(secret), nil
+}
+
+// ListWebhookDeliveries lists the deliveries of a webhook with the pagination,
+// sorting and filtering parameters of the user list, e.g. status=dead for the
+// dead letters
+func ListWebhookDeliveries(app *framework.App) func(r *http.Request, res *framework.Response) {
+    return func(r *http.Request, res *framework.Response) {
+        webhook, ok := findWebhook(app, r, res)
+        if !ok {
+            return
+        }
+        opts, err := app.ParseListOptions(r, WebhookDeliveryFields)
+        if err != nil {
+            res.Error(http.StatusBadRequest, err.Error())
+            return
+        }
+        opts.Filters = append(opts.Filters, database.Filter{Field: "webhook_id", Op: database.OpEq, Value: webhook.ID})
+        deliveries, err := database.NewRepository[models.WebhookDelivery](app.RequestDB(r))
+        if err != nil {
+            res.Error(http.StatusInternalServerError, "Failed to fetch webhook deliveries")
+            return
+        }
+        list, total, err := deliveries.List(app.Context(), opts)
+        if err != nil {
+            res.DBError(err, "Webhook delivery", "Failed to fetch webhook deliveries")
+            return
+        }
+        app.Paginate(res, r, "Webhook deliveries fetched successfully", list, opts, total)
+    }
+}
+
+// RedeliverWebhook queues a delivered or dead delivery to be sent again with a
+// fresh set of attempts
+func RedeliverWebhook(app *framework.App) func(r *http.Request, res *framework.Response) {
+    return func(r *http.Request, res *framework.Response) {
+        webhook, ok := findWebhook(app, r, res)
+        if !ok {
+            return
+        }
+        id, err := strconv.Atoi(mux.Vars(r)["delivery"])
+        if err != nil {
+            res.Error(http.StatusBadRequest, "Invalid delivery ID")
+            return
+        }
+        deliveries, err := database.NewRepository[models.WebhookDelivery](app.RequestDB(r))
+        if err != nil {
+            res.Error(http.StatusInternalServerError, "Failed to redeliver webhook delivery")
+            return
+        }
+        delivery, err := deliveries.Get(app.Context(), uint(id))
+        if err == nil && delivery.WebhookID != webhook.ID {
+            err = database.ErrNotFound
+        }
+        if err != nil {
+            res.DBError(err, "Webhook delivery", "Failed to fetch webhook delivery")
+            return
+        }
+        if delivery.Status == models.DeliveryPending {
+            res.Error(http.StatusConflict, "Webhook delivery is still pending")
+            return
+        }
+        if err := deliveries.Patch(app.Context(), delivery.ID, redelivery(delivery)); err != nil {
+            res.DBError(err, "Webhook delivery", "Failed to redeliver webhook delivery")
+            return
+        }
+        delivery, err = deliveries.Get(app.Context(), delivery.ID)
+        if err != nil {
+            res.DBError(err, "Webhook delivery", "Failed to fetch webhook delivery")
+            return
+        }
+        res.Success("Webhook delivery queued for redelivery", delivery)
+    }
+}
+
+// RedeliverDeadWebhooks queues every dead delivery of a webhook to be sent
+// again, typically once the endpoint is fixed
+func RedeliverDeadWebhooks(app *framework.App) func(r *http.Request, res *framework.Response) {
+    return func(r *http.Request, res *framework.Response) {
+        webhook, ok := findWebhook(app, r, res)
+        if !ok {
+            return
+        }
+        deliveries, err := database.NewRepository[models.WebhookDelivery](app.RequestDB(r))
+        if err != nil {
+            res.Error(http.StatusInternalServerError, "Failed to redeliver webhook deliveries")
+            return
+        }
+        dead, _, err := deliveries.List(app.Context(), database.ListOptions{Filters: []database.Filter{
+            {Field: "webhook_id", Op: database.OpEq, Value: webhook.ID},
+            {Field: "status", Op: database.OpEq, Value: models.DeliveryDead},
+        }})
+        if err != nil {
+            res.DBError(err, "Webhook delivery", "Failed to fetch webhook deliveries")
+            return
+        }
+        items := make([]database.BulkItem, len(dead))
+        for i := range dead {
+            items[i] = database.BulkItem{ID: dead[i].ID, Changes: redelivery(&dead[i])}
+        }
+        requeued := 0
+        for _, err := range deliveries.PatchMany(app.Context(), items) {
+            if err == nil {
+                requeued++
+            }
+        }
+        res.Success("Dead webhook deliveries queued for redelivery", redeliveryResult{Requeued: requeued})
+    }
+}
+
+// redelivery returns the columns that make a delivery pending again, expecting
+// its current version
+func redelivery(delivery *models.WebhookDelivery) map[string]interface{} {
+    return map[string]interface{}{
+        "status":          models.DeliveryPending,
+        "attempts":        0,
+        "next_attempt_at": time.Now(),
+        "response_status": 0,
+        "last_error":      "",
+        "delivered_at":    nil,
+        "version":         delivery.Version,
+    }
+}
+
+// findWebhook returns the webhook named by the {id} path variable, responding
+// and returning false if there is none
+func findWebhook(app *framework.App, r *http.Request, res *framework.Response) (*models.Webhook, bool) {
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        res.Error(http.StatusBadRequest, "Invalid webhook ID")
+        return nil, false
+    }
+    webhooks, err := database.NewRepository[models.Webhook](app.RequestDB(r))
+    if err != nil {
+        res.Error(http.StatusInternalServerError, "Failed to fetch webhook")
+        return nil, false
+    }
+    webhook, err := webhooks.Get(app.Context(), uint(id))
+    if err != nil {
+        res.DBError(err, "Webhook", "Failed to fetch webhook")
+        return nil, false
+    }
+    return webhook, true
+}
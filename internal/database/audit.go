@@ -0,0 +1,429 @@
+package database
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "reflect"
+    "strconv"
+    "time"
+)
+
+// AuditFields are the audit entry fields admins may sort and filter on
+var AuditFields = FieldsOf(models.AuditEntry{})
+
+// Actor is who writes are recorded as in the audit log, see Audited
+type Actor struct {
+    ID             string
+    ImpersonatorID string
+    RequestID      string
+}
+
+// Audited returns db with every create, update and delete of a user recorded
+// as an AuditEntry made by actor, with the fields it changed, and announced to
+// webhooks by an OutboxEvent. Each write runs in a transaction with its entries
+// and events, or in the one of WithTx, so that none is kept without the
+// others.
+func Audited(db Database, actor Actor) Database {
+    if audited, ok := db.(*auditedDatabase); ok {
+        return &auditedDatabase{Database: audited.Database, actor: actor, inTx: audited.inTx}
+    }
+    return &auditedDatabase{Database: db, actor: actor}
+}
+
+type auditedDatabase struct {
+    Database
+    actor Actor
+    inTx  bool
+}
+
+// userSnapshots reads users whether they are soft deleted or not, for the
+// states before and after an audited write. Backends that do not implement
+// it have deleted users left out of the diffs.
+type userSnapshots interface {
+    snapshotUsers(ctx context.Context, ids []uint) ([]models.User, error)
+    // snapshotUserByEmail returns nil if there is no user with the email
+    snapshotUserByEmail(ctx context.Context, email string) (*models.User, error)
+}
+
+func (a *auditedDatabase) WithTx(ctx context.Context, fn func(tx Database) error) error {
+    return a.Database.WithTx(ctx, func(tx Database) error {
+        return fn(&auditedDatabase{Database: tx, actor: a.actor, inTx: true})
+    })
+}
+
+// atomically runs fn in a transaction unless a already is one, so that a
+// write commits together with its audit entries and events. On a backend
+// without transactions the write is made first and its entries after it.
+func (a *auditedDatabase) atomically(ctx context.Context, fn func(tx *auditedDatabase) error) error {
+    if a.inTx || !SupportsTx(a.Database) {
+        return fn(a)
+    }
+    return a.WithTx(ctx, func(tx Database) error {
+        return fn(tx.(*auditedDatabase))
+    })
+}
+
+func (a *auditedDatabase) CreateUser(ctx context.Context, user *models.User) error {
+    return a.atomically(ctx, func(tx *auditedDatabase) error {
+        if err := tx.Database.CreateUser(ctx, user); err != nil {
+            return err
+        }
+        return tx.record(ctx, models.AuditUserCreate, nil, []uint{user.ID})
+    })
+}
+
+func (a *auditedDatabase) UpdateUser(ctx context.Context, user *models.User) error {
+    return a.audit(ctx, models.AuditUserUpdate, []uint{user.ID}, func(tx Database) error {
+        return tx.UpdateUser(ctx, user)
+    })
+}
+
+func (a *auditedDatabase) PatchUser(ctx context.Context, id uint, changes map[string]interface{}) error {
+    return a.audit(ctx, models.AuditUserUpdate, []uint{id}, func(tx Database) error {
+        return tx.PatchUser(ctx, id, changes)
+    })
+}
+
+func (a *auditedDatabase) DeleteUser(ctx context.Context, id uint, version uint) error {
+    return a.audit(ctx, models.AuditUserDelete, []uint{id}, func(tx Database) error {
+        return tx.DeleteUser(ctx, id, version)
+    })
+}
+
+func (a *auditedDatabase) RestoreUser(ctx context.Context, id uint) error {
+    return a.audit(ctx, models.AuditUserRestore, []uint{id}, func(tx Database) error {
+        return tx.RestoreUser(ctx, id)
+    })
+}
+
+func (a *auditedDatabase) PurgeUser(ctx context.Context, id uint, version uint) error {
+    return a.audit(ctx, models.AuditUserPurge, []uint{id}, func(tx Database) error {
+        return tx.PurgeUser(ctx, id, version)
+    })
+}
+
+func (a *auditedDatabase) UpsertUserByEmail(ctx context.Context, user *models.User) (bool, error) {
+    var created bool
+    err := a.atomically(ctx, func(tx *auditedDatabase) error {
+        before := map[uint]models.User{}
+        if snapshots, ok := tx.Database.(userSnapshots); ok {
+            existing, err := snapshots.snapshotUserByEmail(ctx, user.Email)
+            if err != nil {
+                return err
+            }
+            if existing != nil {
+                before[existing.ID] = *existing
+            }
+        }
+        var err error
+        if created, err = tx.Database.UpsertUserByEmail(ctx, user); err != nil {
+            return err
+        }
+        action := models.AuditUserUpdate
+        if created {
+            action = models.AuditUserCreate
+        }
+        return tx.record(ctx, action, before, []uint{user.ID})
+    })
+    return created, err
+}
+
+func (a *auditedDatabase) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+    var purged int64
+    err := a.atomically(ctx, func(tx *auditedDatabase) error {
+        opts := ListOptions{IncludeDeleted: true, Filters: []Filter{{Field: "deleted_at", Op: OpLt, Value: before}}}
+        expired, _, err := tx.Database.ListUsers(ctx, opts)
+        if err != nil {
+            return err
+        }
+        snapshots := map[uint]models.User{}
+        ids := make([]uint, len(expired))
+        for i, user := range expired {
+            snapshots[user.ID] = user
+            ids[i] = user.ID
+        }
+        if purged, err = tx.Database.PurgeDeletedUsers(ctx, before); err != nil || purged == 0 {
+            return err
+        }
+        return tx.record(ctx, models.AuditUserPurge, snapshots, ids)
+    })
+    return purged, err
+}
+
+func (a *auditedDatabase) CreateUsers(ctx context.Context, users []*models.User) []error {
+    return a.atomicallyMany(ctx, len(users), func(tx *auditedDatabase) ([]error, error) {
+        errs := tx.Database.CreateUsers(ctx, users)
+        var ids []uint
+        for i, user := range users {
+            if errs[i] == nil {
+                ids = append(ids, user.ID)
+            }
+        }
+        return errs, tx.record(ctx, models.AuditUserCreate, nil, ids)
+    })
+}
+
+func (a *auditedDatabase) PatchUsers(ctx context.Context, items []BulkItem) []error {
+    return a.auditMany(ctx, models.AuditUserUpdate, items, func(tx Database) []error {
+        return tx.PatchUsers(ctx, items)
+    })
+}
+
+func (a *auditedDatabase) DeleteUsers(ctx context.Context, items []BulkItem) []error {
+    return a.auditMany(ctx, models.AuditUserDelete, items, func(tx Database) []error {
+        return tx.DeleteUsers(ctx, items)
+    })
+}
+
+// audit runs write on the users with the given IDs and records what it changed
+func (a *auditedDatabase) audit(ctx context.Context, action string, ids []uint, write func(tx Database) error) error {
+    return a.atomically(ctx, func(tx *auditedDatabase) error {
+        before, err := tx.snapshot(ctx, ids)
+        if err != nil {
+            return err
+        }
+        if err := write(tx.Database); err != nil {
+            return err
+        }
+        return tx.record(ctx, action, before, ids)
+    })
+}
+
+// auditMany is audit for the bulk methods, recording the items that succeeded
+func (a *auditedDatabase) auditMany(ctx context.Context, action string, items []BulkItem, write func(tx Database) []error) []error {
+    ids := make([]uint, 0, len(items))
+    for _, item := range items {
+        if id, ok := userID(item.ID); ok {
+            ids = append(ids, id)
+        }
+    }
+    return a.atomicallyMany(ctx, len(items), func(tx *auditedDatabase) ([]error, error) {
+        before, err := tx.snapshot(ctx, ids)
+        if err != nil {
+            return nil, err
+        }
+        errs := write(tx.Database)
+        written := make([]uint, 0, len(ids))
+        for i, item := range items {
+            if id, ok := userID(item.ID); ok && errs[i] == nil {
+                written = append(written, id)
+            }
+        }
+        return errs, tx.record(ctx, action, before, written)
+    })
+}
+
+// atomicallyMany is atomically for the bulk methods, where fn returns the
+// errors of the items and the error of recording the written ones. Items that
+// failed on their own do not roll the others back, but a failure to record
+// does, and is reported as the error of every item written.
+func (a *auditedDatabase) atomicallyMany(ctx context.Context, n int, fn func(tx *auditedDatabase) ([]error, error)) []error {
+    var errs []error
+    var err error
+    if a.inTx || !SupportsTx(a.Database) {
+        errs, err = fn(a)
+    } else {
+        err = a.WithTx(ctx, func(tx Database) error {
+            var recordErr error
+            errs, recordErr = fn(tx.(*auditedDatabase))
+            return recordErr
+        })
+    }
+    if errs == nil {
+        errs = make([]error, n)
+    }
+    if err != nil {
+        for i := range errs {
+            if errs[i] == nil {
+                errs[i] = err
+            }
+        }
+    }
+    return errs
+}
+
+// snapshot returns the stored users with the given IDs by ID
+func (a *auditedDatabase) snapshot(ctx context.Context, ids []uint) (map[uint]models.User, error) {
+    snapshots := map[uint]models.User{}
+    if len(ids) == 0 {
+        return snapshots, nil
+    }
+    var users []models.User
+    var err error
+    if reader, ok := a.Database.(userSnapshots); ok {
+        users, err = reader.snapshotUsers(ctx, ids)
+    } else {
+        users, err = a.Database.GetUsersByIDs(ctx, ids)
+    }
+    if err != nil {
+        return nil, err
+    }
+    for _, user := range users {
+        snapshots[user.ID] = user
+    }
+    return snapshots, nil
+}
+
+// record writes an entry for each of the users with the given IDs whose
+// stored state differs from before
+func (a *auditedDatabase) record(ctx context.Context, action string, before map[uint]models.User, ids []uint) error {
+    after, err := a.snapshot(ctx, ids)
+    if err != nil {
+        return err
+    }
+    var entries []*models.AuditEntry
+    var events []*models.OutboxEvent
+    for _, id := range ids {
+        old, user := snapshotOf(before, id), snapshotOf(after, id)
+        changes := diffUsers(old, user)
+        if len(changes) == 0 {
+            continue
+        }
+        if event := userEvent(action, old, user); event != nil {
+            events = append(events, event)
+        }
+        entries = append(entries, &models.AuditEntry{
+            Action:         action,
+            ActorID:        a.actor.ID,
+            ImpersonatorID: a.actor.ImpersonatorID,
+            Resource:       "users",
+            ResourceID:     strconv.FormatUint(uint64(id), 10),
+            RequestID:      a.actor.RequestID,
+            Changes:        changes,
+        })
+    }
+    if len(entries) == 0 {
+        return nil
+    }
+    if err := a.createAuditEntries(ctx, entries); err != nil {
+        return err
+    }
+    if len(events) == 0 {
+        return nil
+    }
+    // Backends without repositories have no outbox
+    outbox, err := NewRepository[models.OutboxEvent](a.Database)
+    if errors.Is(err, ErrNoRepositories) {
+        return nil
+    } else if err != nil {
+        return err
+    }
+    return firstError(outbox.CreateMany(ctx, events))
+}
+
+func (a *auditedDatabase) createAuditEntries(ctx context.Context, entries []*models.AuditEntry) error {
+    repo, err := NewRepository[models.AuditEntry](a.Database)
+    if err == nil {
+        return firstError(repo.CreateMany(ctx, entries))
+    } else if !errors.Is(err, ErrNoRepositories) {
+        return err
+    }
+    for _, entry := range entries {
+        if err := a.Database.CreateAuditEntry(ctx, entry); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// userEvent returns the event announcing an audited write to a user, nil for
+// writes webhooks are not told about: the purge of a user whose deletion was
+// announced already
+func userEvent(action string, before, after *models.User) *models.OutboxEvent {
+    var eventType string
+    switch action {
+    case models.AuditUserCreate:
+        eventType = models.EventUserCreated
+    case models.AuditUserUpdate, models.AuditUserRestore:
+        eventType = models.EventUserUpdated
+    case models.AuditUserDelete:
+        eventType = models.EventUserDeleted
+    case models.AuditUserPurge:
+        if before == nil || before.DeletedAt != nil {
+            return nil
+        }
+        eventType = models.EventUserDeleted
+    default:
+        return nil
+    }
+    user := after
+    if user == nil {
+        user = before
+    }
+    data, _ := json.Marshal(user)
+    return &models.OutboxEvent{Type: eventType, ResourceID: strconv.FormatUint(uint64(user.ID), 10), Data: string(data)}
+}
+
+func firstError(errs []error) error {
+    for _, err := range errs {
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func snapshotOf(snapshots map[uint]models.User, id uint) *models.User {
+    if user, ok := snapshots[id]; ok {
+        return &user
+    }
+    return nil
+}
+
+// redacted stands in for password hashes in audit entries
+const redacted = "[redacted]"
+
+// diffUsers compares two states of a user by their JSON fields, a nil user
+// being one that does not exist and a missing field null. A changed password
+// hash is recorded as "password" without its values.
+func diffUsers(before, after *models.User) models.AuditChanges {
+    beforeFields, afterFields := jsonFields(before), jsonFields(after)
+    changes := models.AuditChanges{}
+    for _, fields := range []map[string]interface{}{beforeFields, afterFields} {
+        for name := range fields {
+            old, value := beforeFields[name], afterFields[name]
+            if !reflect.DeepEqual(old, value) {
+                changes[name] = models.AuditChange{Before: old, After: value}
+            }
+        }
+    }
+    beforeHash, afterHash := passwordHash(before), passwordHash(after)
+    if beforeHash != afterHash {
+        changes["password"] = models.AuditChange{Before: redactedValue(beforeHash), After: redactedValue(afterHash)}
+    }
+    return changes
+}
+
+func jsonFields(user *models.User) map[string]interface{} {
+    fields := map[string]interface{}{}
+    if user == nil {
+        return fields
+    }
+    data, err := json.Marshal(user)
+    if err == nil {
+        json.Unmarshal(data, &fields)
+    }
+    return fields
+}
+
+func passwordHash(user *models.User) string {
+    if user == nil {
+        return ""
+    }
+    return user.PasswordHash
+}
+
+func redactedValue(hash string) interface{} {
+    if hash == "" {
+        return nil
+    }
+    return redacted
+}
+
+// userID converts a BulkItem ID of a user
+func userID(id interface{}) (uint, bool) {
+    parsed, err := strconv.ParseUint(keyOf(id), 10, 64)
+    return uint(parsed), err == nil
+}
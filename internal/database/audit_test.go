@@ -0,0 +1,93 @@
+package database
+
+import (
+    "context"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+// createUserHistory writes a user through the audit log: created without a
+// password, renamed, given a password, soft deleted and purged. It returns the
+// user's ID and its audit entries, oldest first.
+func createUserHistory(t *testing.T, db Database) (uint, []models.AuditEntry) {
+    t.Helper()
+    ctx := context.Background()
+    audited := Audited(db, Actor{ID: "1000", RequestID: "req-1"})
+    user := models.NewUser("Ann", "ann@example.com")
+    if err := audited.CreateUser(ctx, user); err != nil {
+        t.Fatal(err)
+    }
+    writes := []func() error{
+        func() error { return audited.PatchUser(ctx, user.ID, map[string]interface{}{"name": "Anna"}) },
+        func() error {
+            return audited.PatchUser(ctx, user.ID, map[string]interface{}{"password_hash": "$2a$10$secrethash"})
+        },
+        func() error { return audited.DeleteUser(ctx, user.ID, 3) },
+        func() error { return audited.PurgeUser(ctx, user.ID, 4) },
+    }
+    for i, write := range writes {
+        if err := write(); err != nil {
+            t.Fatalf("write %d: %v", i+1, err)
+        }
+    }
+    entries, _, err := db.ListAuditEntries(ctx, ListOptions{
+        Sort:    []SortField{{Field: "id"}},
+        Filters: []Filter{{Field: "resource_id", Op: OpEq, Value: strconv.FormatUint(uint64(user.ID), 10)}},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    return user.ID, entries
+}
+
+func TestAuditedUserWrites(t *testing.T) {
+    db := newTestDatabase(t)
+    _, entries := createUserHistory(t, db)
+    actions := []string{models.AuditUserCreate, models.AuditUserUpdate, models.AuditUserUpdate, models.AuditUserDelete, models.AuditUserPurge}
+    if len(entries) != len(actions) {
+        t.Fatalf("%d audit entries, want %d", len(entries), len(actions))
+    }
+    for i, entry := range entries {
+        if entry.Action != actions[i] || entry.ActorID != "1000" || entry.RequestID != "req-1" || entry.Resource != "users" {
+            t.Errorf("entry %d = %+v, want %s by 1000", i, entry, actions[i])
+        }
+        for name, change := range entry.Changes {
+            if strings.Contains(name, "hash") || strings.Contains(toString(change.Before)+toString(change.After), "secrethash") {
+                t.Errorf("entry %d records the password hash in %s: %+v", i, name, change)
+            }
+        }
+    }
+
+    tests := []struct {
+        entry         int
+        field         string
+        before, after interface{}
+    }{
+        {0, "name", nil, "Ann"},
+        {0, "version", nil, float64(1)},
+        {1, "name", "Ann", "Anna"},
+        {2, "password", nil, redacted},
+        {3, "version", float64(3), float64(4)},
+        {4, "name", "Anna", nil},
+        {4, "password", redacted, nil},
+    }
+    for _, test := range tests {
+        change, ok := entries[test.entry].Changes[test.field]
+        if !ok || change.Before != test.before || change.After != test.after {
+            t.Errorf("entry %d %s = %+v, want %v to %v", test.entry, test.field, change, test.before, test.after)
+        }
+    }
+    if _, ok := entries[1].Changes["password"]; ok {
+        t.Error("a rename records a password change")
+    }
+    if deleted := entries[3].Changes["deleted_at"]; deleted.Before != nil || deleted.After == nil {
+        t.Errorf("soft delete deleted_at = %+v, want it set", deleted)
+    }
+}
+
+func toString(v interface{}) string {
+    s, _ := v.(string)
+    return s
+}
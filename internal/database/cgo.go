@@ -0,0 +1,21 @@
+//go:build cgo
+
+package database
+
+import (
+    "errors"
+    "github.com/mattn/go-sqlite3"
+)
+
+// cgoEnabled reports whether the cgo SQLite driver works in this build
+const cgoEnabled = true
+
+// cgoSQLiteCode returns the extended result code of an error from the cgo
+// SQLite driver
+func cgoSQLiteCode(err error) (int, bool) {
+    var sqliteErr sqlite3.Error
+    if errors.As(err, &sqliteErr) {
+        return int(sqliteErr.ExtendedCode), true
+    }
+    return 0, false
+}
@@ -0,0 +1,204 @@
+package database
+
+import (
+    "context"
+    "fmt"
+    mysqldriver "github.com/go-sql-driver/mysql"
+    "gorm.io/gorm"
+    "net"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// openGorm opens a gorm connection with the shared configuration, making
+// gorm's timestamps use the configured time zone, and sizes the pool. SQLite
+// gets the client side statement timeout.
+func openGorm(dialector gorm.Dialector, config Config) (*gorm.DB, error) {
+    loc, err := timeLocation(config)
+    if err != nil {
+        return nil, err
+    }
+    gormCfg := gormConfig()
+    gormCfg.NowFunc = func() time.Time {
+        return time.Now().In(loc)
+    }
+    db, err := gorm.Open(dialector, gormCfg)
+    if err != nil {
+        return nil, err
+    }
+    if config.StatementTimeout > 0 && dialector.Name() == "sqlite" {
+        if err := db.Use(statementTimeout(config.StatementTimeout)); err != nil {
+            return nil, err
+        }
+    }
+    sqlDB, err := db.DB()
+    if err != nil {
+        return nil, err
+    }
+    if config.MaxOpenConns > 0 {
+        sqlDB.SetMaxOpenConns(config.MaxOpenConns)
+    }
+    if config.MaxIdleConns > 0 {
+        sqlDB.SetMaxIdleConns(config.MaxIdleConns)
+    }
+    if config.ConnMaxLifetime > 0 {
+        sqlDB.SetConnMaxLifetime(config.ConnMaxLifetime)
+    }
+    if config.ConnMaxIdleTime > 0 {
+        sqlDB.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+    }
+    return db, nil
+}
+
+func timeLocation(config Config) (*time.Location, error) {
+    if config.TimeZone == "" {
+        return time.Local, nil
+    }
+    loc, err := time.LoadLocation(config.TimeZone)
+    if err != nil {
+        return nil, fmt.Errorf("invalid time zone %q: %w", config.TimeZone, err)
+    }
+    return loc, nil
+}
+
+func mysqlDSN(config Config) (string, error) {
+    if config.DSN != "" {
+        return config.DSN, nil
+    }
+    loc, err := timeLocation(config)
+    if err != nil {
+        return "", err
+    }
+    cfg := mysqldriver.NewConfig()
+    cfg.User = config.User
+    cfg.Passwd = config.Password
+    cfg.Net = "tcp"
+    cfg.Addr = net.JoinHostPort(config.Host, config.Port)
+    cfg.DBName = config.DBName
+    cfg.Params = map[string]string{"charset": "utf8mb4"}
+    cfg.ParseTime = true
+    cfg.Loc = loc
+    cfg.Timeout = config.ConnectTimeout
+    if config.StatementTimeout > 0 {
+        cfg.Params["max_execution_time"] = strconv.FormatInt(config.StatementTimeout.Milliseconds(), 10)
+    }
+    switch mode := config.TLS.EffectiveMode(); {
+    case mode == TLSDisable:
+    case mode == TLSRequire && config.TLS.CAFile == "" && config.TLS.CertFile == "":
+        cfg.TLSConfig = "skip-verify"
+    default:
+        tlsConfig, err := config.TLS.Build()
+        if err != nil {
+            return "", err
+        }
+        if tlsConfig.ServerName == "" {
+            tlsConfig.ServerName = config.Host
+        }
+        // The driver looks TLS configurations up by name
+        name := "database-" + cfg.Addr + "-" + cfg.DBName
+        if err := mysqldriver.RegisterTLSConfig(name, tlsConfig); err != nil {
+            return "", err
+        }
+        cfg.TLSConfig = name
+    }
+    return cfg.FormatDSN(), nil
+}
+
+func postgresDSN(config Config) string {
+    if config.DSN != "" {
+        return config.DSN
+    }
+    params := [][2]string{
+        {"host", config.Host},
+        {"port", config.Port},
+        {"user", config.User},
+        {"password", config.Password},
+        {"dbname", config.DBName},
+        {"sslmode", config.TLS.EffectiveMode()},
+        {"sslrootcert", config.TLS.CAFile},
+        {"sslcert", config.TLS.CertFile},
+        {"sslkey", config.TLS.KeyFile},
+        {"TimeZone", config.TimeZone},
+    }
+    if config.ConnectTimeout > 0 {
+        params = append(params, [2]string{"connect_timeout", strconv.Itoa(int(config.ConnectTimeout.Seconds()))})
+    }
+    if config.StatementTimeout > 0 {
+        params = append(params, [2]string{"statement_timeout", strconv.FormatInt(config.StatementTimeout.Milliseconds(), 10)})
+    }
+    var parts []string
+    for _, param := range params {
+        if param[1] != "" {
+            parts = append(parts, param[0]+"="+pgValue(param[1]))
+        }
+    }
+    return strings.Join(parts, " ")
+}
+
+// pgValue quotes a keyword/value connection string value
+func pgValue(value string) string {
+    if value != "" && !strings.ContainsAny(value, ` '\`) {
+        return value
+    }
+    return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// sqliteDSN adds the time zone to the file path for mattn/go-sqlite3. The
+// pure Go driver has no such option and always reads times as stored.
+func sqliteDSN(config Config, cgo bool) string {
+    if config.DSN != "" {
+        return config.DSN
+    }
+    if !cgo || config.TimeZone == "" {
+        return config.FilePath
+    }
+    separator := "?"
+    if strings.Contains(config.FilePath, "?") {
+        separator = "&"
+    }
+    return config.FilePath + separator + "_loc=" + url.QueryEscape(config.TimeZone)
+}
+
+const cancelTimeoutKey = "database:cancel_timeout"
+
+// statementTimeout is a gorm plugin that gives every statement a context
+// deadline, for SQLite which has no server side statement timeout. Row and
+// Rows are left out since their results are read after the callbacks run.
+type statementTimeout time.Duration
+
+func (statementTimeout) Name() string {
+    return "database:statement_timeout"
+}
+
+func (t statementTimeout) Initialize(db *gorm.DB) error {
+    start := func(db *gorm.DB) {
+        ctx, cancel := context.WithTimeout(db.Statement.Context, time.Duration(t))
+        db.Statement.Context = ctx
+        db.InstanceSet(cancelTimeoutKey, cancel)
+    }
+    end := func(db *gorm.DB) {
+        if cancel, ok := db.InstanceGet(cancelTimeoutKey); ok {
+            cancel.(context.CancelFunc)()
+        }
+    }
+    callbacks := db.Callback()
+    for _, err := range []error{
+        callbacks.Create().Before("*").Register(t.Name()+"_start", start),
+        callbacks.Query().Before("*").Register(t.Name()+"_start", start),
+        callbacks.Update().Before("*").Register(t.Name()+"_start", start),
+        callbacks.Delete().Before("*").Register(t.Name()+"_start", start),
+        callbacks.Raw().Before("*").Register(t.Name()+"_start", start),
+        callbacks.Create().After("*").Register(t.Name()+"_end", end),
+        callbacks.Query().After("*").Register(t.Name()+"_end", end),
+        callbacks.Update().After("*").Register(t.Name()+"_end", end),
+        callbacks.Delete().After("*").Register(t.Name()+"_end", end),
+        callbacks.Raw().After("*").Register(t.Name()+"_end", end),
+    } {
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -2,18 +2,79 @@ package database
 
 import (
     "context"
-    "fmt"
     "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "time"
 )
 
 type Database interface {
     Connect() error
     Close() error
+    // WithTx runs fn in a transaction, committing if it returns nil and rolling
+    // back otherwise. The Database passed to fn must be used for every
+    // operation that belongs to the transaction. It returns ErrTxUnsupported,
+    // without calling fn, if the deployment cannot run transactions.
+    WithTx(ctx context.Context, fn func(tx Database) error) error
     CreateUser(ctx context.Context, user *models.User) error
     GetUserByID(ctx context.Context, id uint) (*models.User, error)
     GetAllUsers(ctx context.Context) ([]models.User, error)
+    // ListUsers returns a page of users and the number of users matching the filters
+    ListUsers(ctx context.Context, opts ListOptions) ([]models.User, int64, error)
+    // SearchUsers returns a page of users whose name or email matches the words
+    // of query, best matches first, and the number of matches
+    SearchUsers(ctx context.Context, query string, opts ListOptions) ([]models.User, int64, error)
     UpdateUser(ctx context.Context, user *models.User) error
-    DeleteUser(ctx context.Context, id uint) error
+    // PatchUser writes only the given columns of a user, see Changes
+    PatchUser(ctx context.Context, id uint, changes map[string]interface{}) error
+    // DeleteUser soft deletes a user. Deleted users are left out of every
+    // query unless ListOptions.IncludeDeleted is set. A version other than 0
+    // is the version the user must be at, or it fails with ErrStale.
+    DeleteUser(ctx context.Context, id uint, version uint) error
+    RestoreUser(ctx context.Context, id uint) error
+    // UpsertUserByEmail inserts user, or updates the user with the same email
+    // (compared case-insensitively) in one statement, and reports whether it
+    // was inserted. An update sets the name, and the role and password hash
+    // only when they are not empty, and restores a soft-deleted user. user is
+    // filled with the stored user.
+    UpsertUserByEmail(ctx context.Context, user *models.User) (bool, error)
+    // GetUsersByIDs returns the users with the given IDs that exist, in no
+    // particular order
+    GetUsersByIDs(ctx context.Context, ids []uint) ([]models.User, error)
+    // CreateUsers, PatchUsers and DeleteUsers write many users at once and
+    // return an error per user, see Repository.CreateMany
+    CreateUsers(ctx context.Context, users []*models.User) []error
+    PatchUsers(ctx context.Context, items []BulkItem) []error
+    DeleteUsers(ctx context.Context, items []BulkItem) []error
+    // PurgeUser removes a user for good, whether it is soft deleted or not.
+    // version is checked as by DeleteUser.
+    PurgeUser(ctx context.Context, id uint, version uint) error
+    // PurgeDeletedUsers removes the users soft deleted before the given time and
+    // returns how many were removed
+    PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error)
+    GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+    // GetLoginAttempt returns the failed-login record for the identifier, or an
+    // empty one if none has been stored yet
+    GetLoginAttempt(ctx context.Context, scope, identifier string) (*models.LoginAttempt, error)
+    // RecordLoginFailure atomically counts a failed login for the identifier,
+    // starting over when its last failure was before resetBefore, and blocks
+    // it until now plus lock of the new count. Concurrent failures each get
+    // their own count.
+    RecordLoginFailure(ctx context.Context, scope, identifier string, now, resetBefore time.Time, lock func(failures int) time.Duration) (*models.LoginAttempt, error)
+    DeleteLoginAttempt(ctx context.Context, scope, identifier string) error
+    // CreateIdempotencyRecord fails with ErrConflict when the scope already
+    // has a record for the key
+    CreateIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error
+    GetIdempotencyRecord(ctx context.Context, scope, key string) (*models.IdempotencyRecord, error)
+    SaveIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error
+    DeleteIdempotencyRecord(ctx context.Context, scope, key string) error
+    // PurgeIdempotencyRecords removes the records that expired before the
+    // given time and returns how many were removed
+    PurgeIdempotencyRecords(ctx context.Context, before time.Time) (int64, error)
+    GetIdentity(ctx context.Context, provider, subject string) (*models.Identity, error)
+    CreateIdentity(ctx context.Context, identity *models.Identity) error
+    CreateAuditEntry(ctx context.Context, entry *models.AuditEntry) error
+    // ListAuditEntries returns a page of audit entries and the number matching
+    // the filters, see AuditFields
+    ListAuditEntries(ctx context.Context, opts ListOptions) ([]models.AuditEntry, int64, error)
 }
 
 type Config struct {
@@ -24,53 +85,83 @@ type Config struct {
     Password string
     DBName   string
     FilePath string
+    // SkipMigrations stops Connect from applying pending schema migrations
+    SkipMigrations bool
+    // CGOFallback decides what the sqlite type does in a binary built without
+    // cgo: CGOFallbackPure (the default) switches to the pure Go driver and
+    // logs it, CGOFallbackError fails with ErrCGORequired
+    CGOFallback string
+
+    // URI is a full MongoDB connection string. Host, Port, User and Password
+    // are ignored when it is set; the options below override the URI's.
+    URI string
+    // AuthSource is the database the MongoDB user is defined in (admin by default)
+    AuthSource string
+    // AuthMechanism such as SCRAM-SHA-256 or MONGODB-X509; the driver picks
+    // one when empty
+    AuthMechanism string
+    ReplicaSet    string
+    TLS           TLSConfig
+    // ReadPreference is a MongoDB read preference mode: primary,
+    // primaryPreferred, secondary, secondaryPreferred or nearest
+    ReadPreference string
+    // WriteConcern is "majority" or the number of nodes that must acknowledge
+    // a write
+    WriteConcern string
+    MaxPoolSize  uint64
+    MinPoolSize  uint64
+    // ConnectTimeout bounds how long Connect waits for the server before
+    // giving up; it defaults to 10 seconds
+    ConnectTimeout time.Duration
+
+    // DSN is passed to the MySQL, PostgreSQL or SQLite driver as is, instead
+    // of one built from the fields above. TLS, TimeZone, StatementTimeout and
+    // ConnectTimeout then have to be part of it; the pool settings still apply.
+    DSN string
+    // MaxOpenConns and MaxIdleConns size the SQL connection pool; zero keeps
+    // the database/sql defaults
+    MaxOpenConns    int
+    MaxIdleConns    int
+    ConnMaxLifetime time.Duration
+    ConnMaxIdleTime time.Duration
+    // StatementTimeout cancels statements that run longer: statement_timeout
+    // on PostgreSQL, max_execution_time (SELECT only) on MySQL and a context
+    // deadline on SQLite
+    StatementTimeout time.Duration
+    // TimeZone is an IANA name such as UTC or Europe/Berlin. It sets the
+    // session time zone on PostgreSQL and the location times are read in on
+    // MySQL and SQLite. It defaults to the local time zone.
+    TimeZone string
+}
+
+// TLSConfig enables TLS for the database connection. CAFile verifies the
+// server against a private CA; CertFile and KeyFile present a client
+// certificate.
+type TLSConfig struct {
+    Enabled bool
+    // Mode is one of the TLS* modes; it implies Enabled unless it is disable
+    Mode               string
+    CAFile             string
+    CertFile           string
+    KeyFile            string
+    ServerName         string
+    InsecureSkipVerify bool
 }
 
-func NewDatabase(config Config) (Database, error) {
-    switch config.Type {
-    case "mysql":
-        return NewMySQL(config)
-    case "postgres":
-        return NewPostgres(config)
-    case "sqlite":
-        // Try to use the regular SQLite implementation first
-        db, err := NewSQLite(config)
-        if err != nil {
-            // If we get a CGO error, try the pure Go implementation
-            if err.Error() == "Binary was compiled with 'CGO_ENABLED=0', go-sqlite3 requires cgo to work. This is a stub" {
-                // Inform user we're falling back to pure Go implementation
-                fmt.Println("WARNING: CGO is disabled. Falling back to pure Go SQLite implementation.")
-                fmt.Println("To use standard SQLite, rebuild with CGO_ENABLED=1")
-                
-                // Try the pure Go implementation
-                pureDb, pureErr := NewSQLitePure(config)
-                if pureErr != nil {
-                    // If pure implementation also fails, provide comprehensive error
-                    return nil, fmt.Errorf("database error: SQLite requires CGO_ENABLED=1 to work.\n" +
-                        "Pure Go SQLite alternative also failed: %v\n" +
-                        "Please either:\n" +
-                        "1. Rebuild with CGO_ENABLED=1\n" +
-                        "2. Configure an alternative database like MySQL or PostgreSQL\n" +
-                        "3. Install the pure Go SQLite dependency with 'go get github.com/glebarez/sqlite'", pureErr)
-                }
-                return pureDb, nil
-            }
-            return nil, err
-        }
-        return db, nil
-    case "sqlite-pure":
-        // Explicitly use the pure Go implementation
-        db, err := NewSQLitePure(config)
-        if err != nil {
-            // Provide more helpful error for pure SQLite implementation
-            return nil, fmt.Errorf("failed to initialize pure Go SQLite: %v\n" +
-                "Make sure you have installed the required dependency with:\n" +
-                "go get github.com/glebarez/sqlite\ngo mod tidy", err)
-        }
-        return db, nil
-    case "mongodb":
-        return NewMongoDB(config)
-    default:
-        return nil, fmt.Errorf("unsupported database type: %s\nSupported types: sqlite, sqlite-pure, mysql, postgres, mongodb", config.Type)
+// DefaultConnectTimeout is used when Config.ConnectTimeout is not set
+const DefaultConnectTimeout = 10 * time.Second
+
+// txSupport is implemented by backends that run transactions on some
+// deployments only
+type txSupport interface {
+    supportsTx() bool
+}
+
+// SupportsTx reports whether WithTx can run transactions on db
+func SupportsTx(db Database) bool {
+    if audited, ok := db.(*auditedDatabase); ok {
+        db = audited.Database
     }
-}
\ No newline at end of file
+    support, ok := db.(txSupport)
+    return !ok || support.supportsTx()
+}
@@ -0,0 +1,174 @@
+package database
+
+import (
+    "context"
+    "database/sql"
+    "database/sql/driver"
+    "errors"
+    "github.com/go-sql-driver/mysql"
+    "github.com/jackc/pgconn"
+    "go.mongodb.org/mongo-driver/mongo"
+    "gorm.io/gorm"
+    "net"
+    "strings"
+    "syscall"
+)
+
+// Every backend reports failures as one of these errors when it can tell what
+// went wrong. The driver error stays available through errors.As.
+var (
+    ErrNotFound    = errors.New("record not found")
+    ErrConflict    = errors.New("record conflicts with an existing one")
+    ErrUnavailable = errors.New("database unavailable")
+    ErrTimeout     = errors.New("database operation timed out")
+    // ErrStale is returned for a write to a versioned record that was
+    // changed since the version the write expected
+    ErrStale = errors.New("record was changed since it was read")
+    // ErrTxUnsupported is returned by WithTx on a deployment that cannot run
+    // transactions, such as a standalone MongoDB server
+    ErrTxUnsupported = errors.New("database does not support transactions")
+)
+
+// Error wraps a driver error with the sentinel error it corresponds to
+type Error struct {
+    Kind error
+    Err  error
+}
+
+func (e *Error) Error() string {
+    return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+    return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+    return target == e.Kind
+}
+
+// wrapError translates a driver error into a sentinel error, keeping it as the
+// cause. Errors that are not recognized are returned unchanged.
+func wrapError(err error) error {
+    if err == nil {
+        return nil
+    }
+    var wrapped *Error
+    if errors.As(err, &wrapped) {
+        return err
+    }
+    if kind := classifyError(err); kind != nil {
+        return &Error{Kind: kind, Err: err}
+    }
+    return err
+}
+
+func classifyError(err error) error {
+    switch {
+    case errors.Is(err, ErrNotFound), errors.Is(err, ErrConflict), errors.Is(err, ErrUnavailable), errors.Is(err, ErrTimeout),
+        errors.Is(err, ErrStale):
+        return nil
+    case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, mongo.ErrNoDocuments), errors.Is(err, sql.ErrNoRows):
+        return ErrNotFound
+    case errors.Is(err, gorm.ErrDuplicatedKey), mongo.IsDuplicateKeyError(err):
+        return ErrConflict
+    case errors.Is(err, context.DeadlineExceeded), mongo.IsTimeout(err):
+        return ErrTimeout
+    case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone), errors.Is(err, mysql.ErrInvalidConn),
+        errors.Is(err, mongo.ErrClientDisconnected), mongo.IsNetworkError(err),
+        errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET):
+        return ErrUnavailable
+    }
+
+    var mysqlErr *mysql.MySQLError
+    if errors.As(err, &mysqlErr) {
+        switch mysqlErr.Number {
+        case 1062: // ER_DUP_ENTRY
+            return ErrConflict
+        case 1205, 3024: // lock wait timeout, max_execution_time exceeded
+            return ErrTimeout
+        case 1040, 1053: // too many connections, server shutdown
+            return ErrUnavailable
+        }
+        return nil
+    }
+    var pgErr *pgconn.PgError
+    if errors.As(err, &pgErr) {
+        switch {
+        case pgErr.Code == "23505": // unique_violation
+            return ErrConflict
+        case pgErr.Code == "57014", pgErr.Code == "55P03": // query_canceled, lock_not_available
+            return ErrTimeout
+        case strings.HasPrefix(pgErr.Code, "08"), strings.HasPrefix(pgErr.Code, "57P"), pgErr.Code == "53300":
+            return ErrUnavailable
+        }
+        return nil
+    }
+    if code, ok := cgoSQLiteCode(err); ok {
+        return classifySQLite(code)
+    }
+    // The pure Go SQLite drivers expose the extended result code through Code
+    var pureErr interface{ Code() int }
+    if errors.As(err, &pureErr) {
+        return classifySQLite(pureErr.Code())
+    }
+    var netErr net.Error
+    if errors.As(err, &netErr) {
+        if netErr.Timeout() {
+            return ErrTimeout
+        }
+        return ErrUnavailable
+    }
+    return nil
+}
+
+// classifySQLite maps an SQLite extended result code
+func classifySQLite(code int) error {
+    switch code {
+    case 1555, 2067: // SQLITE_CONSTRAINT_PRIMARYKEY, SQLITE_CONSTRAINT_UNIQUE
+        return ErrConflict
+    }
+    switch code & 0xff {
+    case 5, 6: // SQLITE_BUSY, SQLITE_LOCKED
+        return ErrTimeout
+    case 14: // SQLITE_CANTOPEN
+        return ErrUnavailable
+    }
+    return nil
+}
+
+// gormConfig is the configuration shared by the gorm backends
+func gormConfig() *gorm.Config {
+    translation := errorTranslation{}
+    return &gorm.Config{Plugins: map[string]gorm.Plugin{translation.Name(): translation}}
+}
+
+// errorTranslation is a gorm plugin that makes every operation report the
+// sentinel errors
+type errorTranslation struct{}
+
+func (errorTranslation) Name() string {
+    return "database:translate_errors"
+}
+
+func (t errorTranslation) Initialize(db *gorm.DB) error {
+    translate := func(tx *gorm.DB) {
+        if tx.Error != nil {
+            tx.Error = wrapError(tx.Error)
+        }
+    }
+    callbacks := db.Callback()
+    for _, err := range []error{
+        callbacks.Create().After("*").Register(t.Name(), translate),
+        callbacks.Query().After("*").Register(t.Name(), translate),
+        callbacks.Update().After("*").Register(t.Name(), translate),
+        callbacks.Delete().After("*").Register(t.Name(), translate),
+        callbacks.Row().After("*").Register(t.Name(), translate),
+        callbacks.Raw().After("*").Register(t.Name(), translate),
+    } {
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "github.com/go-sql-driver/mysql"
+    "github.com/jackc/pgconn"
+    "go.mongodb.org/mongo-driver/mongo"
+    "gorm.io/gorm"
+    "reflect"
+    "syscall"
+    "testing"
+)
+
+// sqliteError is an error of the pure Go SQLite driver
+type sqliteError int
+
+func (e sqliteError) Error() string { return fmt.Sprintf("sqlite error %d", int(e)) }
+func (e sqliteError) Code() int     { return int(e) }
+
+func TestWrapError(t *testing.T) {
+    tests := []struct {
+        name string
+        err  error
+        want error
+    }{
+        {"gorm not found", gorm.ErrRecordNotFound, ErrNotFound},
+        {"mongo not found", mongo.ErrNoDocuments, ErrNotFound},
+        {"sql not found", fmt.Errorf("scan: %w", sql.ErrNoRows), ErrNotFound},
+        {"gorm duplicate", gorm.ErrDuplicatedKey, ErrConflict},
+        {"mongo duplicate", mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}, ErrConflict},
+        {"MySQL duplicate", &mysql.MySQLError{Number: 1062}, ErrConflict},
+        {"MySQL lock wait", &mysql.MySQLError{Number: 1205}, ErrTimeout},
+        {"MySQL shutdown", &mysql.MySQLError{Number: 1053}, ErrUnavailable},
+        {"PostgreSQL unique violation", &pgconn.PgError{Code: "23505"}, ErrConflict},
+        {"PostgreSQL query canceled", &pgconn.PgError{Code: "57014"}, ErrTimeout},
+        {"PostgreSQL connection failure", &pgconn.PgError{Code: "08006"}, ErrUnavailable},
+        {"SQLite unique", sqliteError(2067), ErrConflict},
+        {"SQLite primary key", sqliteError(1555), ErrConflict},
+        {"SQLite busy", sqliteError(5), ErrTimeout},
+        {"SQLite busy snapshot", sqliteError(517), ErrTimeout},
+        {"deadline", context.DeadlineExceeded, ErrTimeout},
+        {"connection refused", fmt.Errorf("dial: %w", syscall.ECONNREFUSED), ErrUnavailable},
+    }
+    for _, test := range tests {
+        err := wrapError(test.err)
+        if !errors.Is(err, test.want) {
+            t.Errorf("%s: %v is not %v", test.name, err, test.want)
+        }
+        // The driver error is kept as the cause
+        if !reflect.DeepEqual(errors.Unwrap(err), test.err) {
+            t.Errorf("%s: %v lost its cause", test.name, err)
+        }
+    }
+
+    for _, err := range []error{errors.New("syntax error"), &mysql.MySQLError{Number: 1064}, &pgconn.PgError{Code: "42601"}, sqliteError(1)} {
+        if wrapped := wrapError(err); wrapped != err {
+            t.Errorf("%v was wrapped as %v, want it unchanged", err, wrapped)
+        }
+    }
+    wrapped := wrapError(gorm.ErrRecordNotFound)
+    if wrapError(wrapped) != wrapped || wrapError(ErrStale) != ErrStale || wrapError(nil) != nil {
+        t.Error("wrapError changed an error that needs no translation")
+    }
+}
+
+func TestGormErrors(t *testing.T) {
+    db := newTestDatabase(t)
+    ctx := context.Background()
+    if err := db.CreateUser(ctx, models.NewUser("Ann", "ann@example.com")); err != nil {
+        t.Fatal(err)
+    }
+    if err := db.CreateUser(ctx, models.NewUser("Ann", "ann@example.com")); !errors.Is(err, ErrConflict) {
+        t.Errorf("duplicate email: %v, want ErrConflict", err)
+    }
+    identity := models.Identity{Provider: "google", Subject: "1"}
+    if err := db.CreateIdentity(ctx, &identity); err != nil {
+        t.Fatal(err)
+    }
+    identity.ID = 0
+    if err := db.CreateIdentity(ctx, &identity); !errors.Is(err, ErrConflict) {
+        t.Errorf("duplicate identity: %v, want ErrConflict", err)
+    }
+    if _, err := db.GetUserByID(ctx, 999); !errors.Is(err, ErrNotFound) {
+        t.Errorf("missing user: %v, want ErrNotFound", err)
+    }
+    if _, err := db.GetIdentity(ctx, "google", "2"); !errors.Is(err, ErrNotFound) {
+        t.Errorf("missing identity: %v, want ErrNotFound", err)
+    }
+    if err := db.PatchUser(ctx, 999, map[string]interface{}{"name": "Bob"}); !errors.Is(err, ErrNotFound) {
+        t.Errorf("patching a missing user: %v, want ErrNotFound", err)
+    }
+}
@@ -0,0 +1,231 @@
+package database
+
+import (
+    "fmt"
+    "strings"
+    "unicode"
+)
+
+// Expr is a node of a parsed filter expression. Leaves are Filter values.
+type Expr interface {
+    expr()
+}
+
+type AndExpr struct {
+    Left, Right Expr
+}
+
+type OrExpr struct {
+    Left, Right Expr
+}
+
+type NotExpr struct {
+    Expr Expr
+}
+
+func (AndExpr) expr() {}
+func (OrExpr) expr()  {}
+func (NotExpr) expr() {}
+func (Filter) expr()  {}
+
+const (
+    maxFilterLength = 2048
+    maxFilterDepth  = 32
+)
+
+// ParseFilter parses a filter expression such as
+//
+//  name co "ali" and (role eq admin or created_at gt 2024-01-01)
+//
+// Comparisons are `field op value` with the operators eq, ne, gt, ge, lt, le,
+// co (contains), sw (starts with) and ew (ends with), or `field pr` for fields
+// that are set. They combine with and, or, not and parentheses. Only the given
+// fields are accepted and values are parsed by the field kind.
+func ParseFilter(input string, fields map[string]Field) (Expr, error) {
+    if len(input) > maxFilterLength {
+        return nil, fmt.Errorf("filter is longer than %d characters", maxFilterLength)
+    }
+    tokens, err := tokenizeFilter(input)
+    if err != nil {
+        return nil, err
+    }
+    p := &filterParser{tokens: tokens, fields: fields}
+    expr, err := p.parseOr(0)
+    if err != nil {
+        return nil, err
+    }
+    if token, ok := p.peek(); ok {
+        return nil, fmt.Errorf("unexpected %q in filter", token.text)
+    }
+    return expr, nil
+}
+
+type filterToken struct {
+    text   string
+    quoted bool
+}
+
+func tokenizeFilter(input string) ([]filterToken, error) {
+    var tokens []filterToken
+    runes := []rune(input)
+    for i := 0; i < len(runes); {
+        switch r := runes[i]; {
+        case unicode.IsSpace(r):
+            i++
+        case r == '(' || r == ')':
+            tokens = append(tokens, filterToken{text: string(r)})
+            i++
+        case r == '"':
+            var text strings.Builder
+            i++
+            for ; i < len(runes) && runes[i] != '"'; i++ {
+                if runes[i] == '\\' && i+1 < len(runes) {
+                    i++
+                }
+                text.WriteRune(runes[i])
+            }
+            if i == len(runes) {
+                return nil, fmt.Errorf("unterminated string in filter")
+            }
+            tokens = append(tokens, filterToken{text: text.String(), quoted: true})
+            i++
+        default:
+            start := i
+            for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' && runes[i] != '"' {
+                i++
+            }
+            tokens = append(tokens, filterToken{text: string(runes[start:i])})
+        }
+    }
+    return tokens, nil
+}
+
+type filterParser struct {
+    tokens []filterToken
+    pos    int
+    fields map[string]Field
+}
+
+// filterOps maps the operators of the grammar to filter operators
+var filterOps = map[string]string{
+    "eq": OpEq, "ne": OpNe,
+    "gt": OpGt, "ge": OpGte, "gte": OpGte,
+    "lt": OpLt, "le": OpLte, "lte": OpLte,
+    "co": OpContains, "sw": OpStartsWith, "ew": OpEndsWith,
+    "pr": OpPresent,
+}
+
+func (p *filterParser) peek() (filterToken, bool) {
+    if p.pos >= len(p.tokens) {
+        return filterToken{}, false
+    }
+    return p.tokens[p.pos], true
+}
+
+func (p *filterParser) next() (filterToken, error) {
+    token, ok := p.peek()
+    if !ok {
+        return token, fmt.Errorf("unexpected end of filter")
+    }
+    p.pos++
+    return token, nil
+}
+
+// keyword consumes the next token if it is the given unquoted keyword
+func (p *filterParser) keyword(word string) bool {
+    token, ok := p.peek()
+    if ok && !token.quoted && strings.EqualFold(token.text, word) {
+        p.pos++
+        return true
+    }
+    return false
+}
+
+func (p *filterParser) parseOr(depth int) (Expr, error) {
+    left, err := p.parseAnd(depth)
+    if err != nil {
+        return nil, err
+    }
+    for p.keyword("or") {
+        right, err := p.parseAnd(depth)
+        if err != nil {
+            return nil, err
+        }
+        left = OrExpr{Left: left, Right: right}
+    }
+    return left, nil
+}
+
+func (p *filterParser) parseAnd(depth int) (Expr, error) {
+    left, err := p.parseUnary(depth)
+    if err != nil {
+        return nil, err
+    }
+    for p.keyword("and") {
+        right, err := p.parseUnary(depth)
+        if err != nil {
+            return nil, err
+        }
+        left = AndExpr{Left: left, Right: right}
+    }
+    return left, nil
+}
+
+func (p *filterParser) parseUnary(depth int) (Expr, error) {
+    if depth > maxFilterDepth {
+        return nil, fmt.Errorf("filter is nested too deeply")
+    }
+    if p.keyword("not") {
+        expr, err := p.parseUnary(depth + 1)
+        if err != nil {
+            return nil, err
+        }
+        return NotExpr{Expr: expr}, nil
+    }
+    if p.keyword("(") {
+        expr, err := p.parseOr(depth + 1)
+        if err != nil {
+            return nil, err
+        }
+        if !p.keyword(")") {
+            return nil, fmt.Errorf("missing ) in filter")
+        }
+        return expr, nil
+    }
+    return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (Expr, error) {
+    name, err := p.next()
+    if err != nil {
+        return nil, err
+    }
+    field, ok := p.fields[name.text]
+    if !ok || name.quoted {
+        return nil, fmt.Errorf("cannot filter by %q", name.text)
+    }
+    opToken, err := p.next()
+    if err != nil {
+        return nil, err
+    }
+    op, ok := filterOps[strings.ToLower(opToken.text)]
+    if !ok || opToken.quoted {
+        return nil, fmt.Errorf("unsupported filter operator %q", opToken.text)
+    }
+    var raw string
+    if op != OpPresent {
+        value, err := p.next()
+        if err != nil {
+            return nil, err
+        }
+        if !value.quoted && (value.text == "(" || value.text == ")") {
+            return nil, fmt.Errorf("missing value for %s", name.text)
+        }
+        raw = value.text
+    }
+    filter, err := field.Filter(op, raw)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %v", name.text, err)
+    }
+    return filter, nil
+}
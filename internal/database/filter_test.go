@@ -0,0 +1,135 @@
+package database
+
+import (
+    "context"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "github.com/glebarez/sqlite"
+    "gorm.io/gorm"
+    "gorm.io/gorm/logger"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestParseFilter(t *testing.T) {
+    name := Filter{Field: "name", Op: OpContains, Value: "ali"}
+    admin := Filter{Field: "role", Op: OpEq, Value: "admin"}
+    tests := []struct {
+        input string
+        want  Expr
+    }{
+        {`name co "ali"`, name},
+        {`name CO ali`, name},
+        {`name co "ali" and role eq admin`, AndExpr{Left: name, Right: admin}},
+        {`name co ali or role eq admin and not deleted_at pr`, OrExpr{Left: name, Right: AndExpr{
+            Left:  admin,
+            Right: NotExpr{Expr: Filter{Field: "deleted_at", Op: OpPresent}},
+        }}},
+        {`(name co ali or role eq admin) and id gt 3`, AndExpr{
+            Left:  OrExpr{Left: name, Right: admin},
+            Right: Filter{Field: "id", Op: OpGt, Value: int64(3)},
+        }},
+        {`name eq "say \"hi\" (now)"`, Filter{Field: "name", Op: OpEq, Value: `say "hi" (now)`}},
+        {strings.Repeat("(", maxFilterDepth) + "role eq admin" + strings.Repeat(")", maxFilterDepth), admin},
+    }
+    for _, test := range tests {
+        got, err := ParseFilter(test.input, UserFields)
+        if err != nil {
+            t.Errorf("ParseFilter(%q): %v", test.input, err)
+            continue
+        }
+        if !reflect.DeepEqual(got, test.want) {
+            t.Errorf("ParseFilter(%q) = %#v, want %#v", test.input, got, test.want)
+        }
+    }
+}
+
+func TestParseFilterErrors(t *testing.T) {
+    tests := map[string]string{
+        "too long":               `name eq "` + strings.Repeat("a", maxFilterLength) + `"`,
+        "nested too deeply":      strings.Repeat("(", maxFilterDepth+1) + "role eq admin" + strings.Repeat(")", maxFilterDepth+1),
+        "too many nots":          strings.Repeat("not ", maxFilterDepth+1) + "role eq admin",
+        "unknown field":          `password_hash eq x`,
+        "quoted field":           `"name" eq x`,
+        "unknown operator":       `name like x`,
+        "quoted operator":        `name "eq" x`,
+        "contains on a number":   `id co 1`,
+        "bad number":             `id eq one`,
+        "missing value":          `name eq`,
+        "parenthesis as a value": `(name eq )`,
+        "unterminated string":    `name eq "ali`,
+        "missing parenthesis":    `(name eq ali`,
+        "trailing token":         `name eq ali role`,
+        "dangling and":           `name eq ali and`,
+        "empty":                  ``,
+    }
+    for name, input := range tests {
+        if expr, err := ParseFilter(input, UserFields); err == nil {
+            t.Errorf("%s: ParseFilter(%q) = %#v, want an error", name, input, expr)
+        }
+    }
+}
+
+func TestLikePattern(t *testing.T) {
+    tests := []struct {
+        op, value, want string
+    }{
+        {OpContains, "ali", "%ali%"},
+        {OpStartsWith, "ali", "ali%"},
+        {OpEndsWith, "ali", "%ali"},
+        {OpContains, "50%_off!", "%50!%!_off!!%"},
+        {OpStartsWith, "%", "!%%"},
+        {OpEndsWith, "_", "%!_"},
+    }
+    for _, test := range tests {
+        if got := likePattern(test.op, test.value); got != test.want {
+            t.Errorf("likePattern(%s, %q) = %q, want %q", test.op, test.value, got, test.want)
+        }
+    }
+}
+
+// TestFilterWildcards checks on SQLite that wildcards in values match only
+// themselves
+func TestFilterWildcards(t *testing.T) {
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := db.AutoMigrate(&models.Webhook{}); err != nil {
+        t.Fatal(err)
+    }
+    repo, err := newGormRepository[models.Webhook](db)
+    if err != nil {
+        t.Fatal(err)
+    }
+    ctx := context.Background()
+    for _, url := range []string{"http://a.test/50%", "http://a.test/500", "http://a.test/a_b", "http://a.test/axb", "http://a.test/a!b"} {
+        if err := repo.Create(ctx, &models.Webhook{URL: url}); err != nil {
+            t.Fatal(err)
+        }
+    }
+    fields := FieldsOf(models.Webhook{})
+    tests := map[string][]string{
+        `url ew "%"`:               {"http://a.test/50%"},
+        `url co "a_b"`:             {"http://a.test/a_b"},
+        `url co "!"`:               {"http://a.test/a!b"},
+        `url sw "HTTP://A.TEST/5"`: {"http://a.test/50%", "http://a.test/500"},
+    }
+    for input, want := range tests {
+        where, err := ParseFilter(input, fields)
+        if err != nil {
+            t.Fatal(err)
+        }
+        found, _, err := repo.List(ctx, ListOptions{Where: where, Sort: []SortField{{Field: "id"}}})
+        if err != nil {
+            t.Fatalf("%s: %v", input, err)
+        }
+        var got []string
+        for _, webhook := range found {
+            got = append(got, webhook.URL)
+        }
+        if !reflect.DeepEqual(got, want) {
+            t.Errorf("%s matched %v, want %v", input, got, want)
+        }
+    }
+}
@@ -0,0 +1,299 @@
+package database
+
+import (
+    "context"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/migrate"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+    "time"
+)
+
+// GormDatabase implements Database on top of gorm. It backs every SQL
+// database; the drivers only differ in the dialector they open.
+type GormDatabase struct {
+    db     *gorm.DB
+    config Config
+}
+
+// NewGormDatabase wraps an open gorm connection. Prefer GormFactory, which
+// also applies the shared configuration.
+func NewGormDatabase(db *gorm.DB, config Config) *GormDatabase {
+    return &GormDatabase{db: db, config: config}
+}
+
+// GormFactory returns a Factory for a SQL database gorm has a dialector for.
+// The connection gets the error translation, time zone and pool settings
+// from config. Migrations are looked up by the dialector's name, so a backend
+// without a directory under migrations/ needs Config.SkipMigrations.
+func GormFactory(dialector func(config Config) (gorm.Dialector, error)) Factory {
+    return func(config Config) (Database, error) {
+        d, err := dialector(config)
+        if err != nil {
+            return nil, err
+        }
+        db, err := openGorm(d, config)
+        if err != nil {
+            return nil, err
+        }
+        return NewGormDatabase(db, config), nil
+    }
+}
+
+// DB returns the underlying gorm connection
+func (g *GormDatabase) DB() *gorm.DB {
+    return g.db
+}
+
+// users is the repository the user methods are implemented with
+func (g *GormDatabase) users() (Repository[models.User], error) {
+    return newGormRepository[models.User](g.db)
+}
+
+func (g *GormDatabase) Connect() error {
+    return runMigrations(g.db, g.config)
+}
+
+func (g *GormDatabase) Migrator() *migrate.Migrator {
+    return newMigrator(g.db)
+}
+
+func (g *GormDatabase) Close() error {
+    sqlDB, err := g.db.DB()
+    if err != nil {
+        return err
+    }
+    return sqlDB.Close()
+}
+
+func (g *GormDatabase) WithTx(ctx context.Context, fn func(tx Database) error) error {
+    return wrapError(g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        return fn(&GormDatabase{db: tx, config: g.config})
+    }))
+}
+
+func (g *GormDatabase) CreateUser(ctx context.Context, user *models.User) error {
+    users, err := g.users()
+    if err != nil {
+        return err
+    }
+    return users.Create(ctx, user)
+}
+
+func (g *GormDatabase) GetUserByID(ctx context.Context, id uint) (*models.User, error) {
+    users, err := g.users()
+    if err != nil {
+        return nil, err
+    }
+    return users.Get(ctx, id)
+}
+
+func (g *GormDatabase) GetAllUsers(ctx context.Context) ([]models.User, error) {
+    var users []models.User
+    err := g.db.WithContext(ctx).Scopes(notDeleted).Find(&users).Error
+    return users, err
+}
+
+func (g *GormDatabase) ListUsers(ctx context.Context, opts ListOptions) ([]models.User, int64, error) {
+    users, err := g.users()
+    if err != nil {
+        return nil, 0, err
+    }
+    return users.List(ctx, opts)
+}
+
+func (g *GormDatabase) SearchUsers(ctx context.Context, query string, opts ListOptions) ([]models.User, int64, error) {
+    return searchUsers(g.db.WithContext(ctx), query, opts)
+}
+
+func (g *GormDatabase) UpdateUser(ctx context.Context, user *models.User) error {
+    users, err := g.users()
+    if err != nil {
+        return err
+    }
+    return users.Update(ctx, user)
+}
+
+func (g *GormDatabase) PatchUser(ctx context.Context, id uint, changes map[string]interface{}) error {
+    users, err := g.users()
+    if err != nil {
+        return err
+    }
+    return users.Patch(ctx, id, changes)
+}
+
+// DeleteUser soft deletes a user, see PurgeUser for removing it for good
+func (g *GormDatabase) DeleteUser(ctx context.Context, id uint, version uint) error {
+    users, err := g.users()
+    if err != nil {
+        return err
+    }
+    if version == 0 {
+        return users.Delete(ctx, id)
+    }
+    return users.DeleteMany(ctx, []BulkItem{{ID: id, Version: version}})[0]
+}
+
+func (g *GormDatabase) GetUsersByIDs(ctx context.Context, ids []uint) ([]models.User, error) {
+    users, err := g.users()
+    if err != nil {
+        return nil, err
+    }
+    keys := make([]interface{}, len(ids))
+    for i, id := range ids {
+        keys[i] = id
+    }
+    return users.GetMany(ctx, keys)
+}
+
+func (g *GormDatabase) CreateUsers(ctx context.Context, batch []*models.User) []error {
+    users, err := g.users()
+    if err != nil {
+        return fill(make([]error, len(batch)), err)
+    }
+    return users.CreateMany(ctx, batch)
+}
+
+func (g *GormDatabase) PatchUsers(ctx context.Context, items []BulkItem) []error {
+    users, err := g.users()
+    if err != nil {
+        return fill(make([]error, len(items)), err)
+    }
+    return users.PatchMany(ctx, items)
+}
+
+func (g *GormDatabase) DeleteUsers(ctx context.Context, items []BulkItem) []error {
+    users, err := g.users()
+    if err != nil {
+        return fill(make([]error, len(items)), err)
+    }
+    return users.DeleteMany(ctx, items)
+}
+
+func (g *GormDatabase) RestoreUser(ctx context.Context, id uint) error {
+    return restoreUser(g.db.WithContext(ctx), id)
+}
+
+func (g *GormDatabase) UpsertUserByEmail(ctx context.Context, user *models.User) (bool, error) {
+    return upsertUserByEmail(g.db.WithContext(ctx), user)
+}
+
+func (g *GormDatabase) PurgeUser(ctx context.Context, id uint, version uint) error {
+    return purgeUser(g.db.WithContext(ctx), id, version)
+}
+
+func (g *GormDatabase) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+    return purgeDeletedUsers(g.db.WithContext(ctx), before)
+}
+
+func (g *GormDatabase) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+    var user models.User
+    err := g.db.WithContext(ctx).Scopes(notDeleted).Where("LOWER(email) = LOWER(?)", email).First(&user).Error
+    return &user, err
+}
+
+func (g *GormDatabase) GetLoginAttempt(ctx context.Context, scope, identifier string) (*models.LoginAttempt, error) {
+    attempt := models.LoginAttempt{Scope: scope, Identifier: identifier}
+    err := g.db.WithContext(ctx).Where("scope = ? AND identifier = ?", scope, identifier).FirstOrInit(&attempt).Error
+    return &attempt, err
+}
+
+// RecordLoginFailure increments the count with an upsert and reads it back in
+// the same transaction, which holds the row lock until the block is written
+func (g *GormDatabase) RecordLoginFailure(ctx context.Context, scope, identifier string, now, resetBefore time.Time, lock func(failures int) time.Duration) (*models.LoginAttempt, error) {
+    var attempt models.LoginAttempt
+    err := g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        first := models.LoginAttempt{Scope: scope, Identifier: identifier, Failures: 1, LastFailureAt: now}
+        err := tx.Clauses(clause.OnConflict{
+            Columns: []clause.Column{{Name: "scope"}, {Name: "identifier"}},
+            DoUpdates: clause.Assignments(map[string]interface{}{
+                "failures":        gorm.Expr("CASE WHEN login_attempts.last_failure_at < ? THEN 1 ELSE login_attempts.failures + 1 END", resetBefore),
+                "last_failure_at": now,
+                "updated_at":      now,
+            }),
+        }).Create(&first).Error
+        if err != nil {
+            return err
+        }
+        if err := tx.Where("scope = ? AND identifier = ?", scope, identifier).First(&attempt).Error; err != nil {
+            return err
+        }
+        lockedUntil := now.Add(lock(attempt.Failures))
+        attempt.LockedUntil = &lockedUntil
+        return tx.Model(&attempt).Update("locked_until", lockedUntil).Error
+    })
+    return &attempt, wrapError(err)
+}
+
+func (g *GormDatabase) DeleteLoginAttempt(ctx context.Context, scope, identifier string) error {
+    return g.db.WithContext(ctx).Where("scope = ? AND identifier = ?", scope, identifier).Delete(&models.LoginAttempt{}).Error
+}
+
+func (g *GormDatabase) CreateIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+    return g.db.WithContext(ctx).Create(record).Error
+}
+
+func (g *GormDatabase) GetIdempotencyRecord(ctx context.Context, scope, key string) (*models.IdempotencyRecord, error) {
+    var record models.IdempotencyRecord
+    err := g.db.WithContext(ctx).Where("scope = ? AND idempotency_key = ?", scope, key).First(&record).Error
+    return &record, err
+}
+
+func (g *GormDatabase) SaveIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+    return g.db.WithContext(ctx).Save(record).Error
+}
+
+func (g *GormDatabase) DeleteIdempotencyRecord(ctx context.Context, scope, key string) error {
+    return g.db.WithContext(ctx).Where("scope = ? AND idempotency_key = ?", scope, key).Delete(&models.IdempotencyRecord{}).Error
+}
+
+func (g *GormDatabase) PurgeIdempotencyRecords(ctx context.Context, before time.Time) (int64, error) {
+    result := g.db.WithContext(ctx).Where("expires_at < ?", before).Delete(&models.IdempotencyRecord{})
+    return result.RowsAffected, result.Error
+}
+
+func (g *GormDatabase) GetIdentity(ctx context.Context, provider, subject string) (*models.Identity, error) {
+    var identity models.Identity
+    err := g.db.WithContext(ctx).Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+    return &identity, err
+}
+
+func (g *GormDatabase) CreateIdentity(ctx context.Context, identity *models.Identity) error {
+    return g.db.WithContext(ctx).Create(identity).Error
+}
+
+func (g *GormDatabase) CreateAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+    return g.db.WithContext(ctx).Create(entry).Error
+}
+
+func (g *GormDatabase) ListAuditEntries(ctx context.Context, opts ListOptions) ([]models.AuditEntry, int64, error) {
+    entries, err := newGormRepository[models.AuditEntry](g.db)
+    if err != nil {
+        return nil, 0, err
+    }
+    return entries.List(ctx, opts)
+}
+
+func (g *GormDatabase) snapshotUsers(ctx context.Context, ids []uint) ([]models.User, error) {
+    var users []models.User
+    var err error
+    chunks(len(ids), func(start, end int) {
+        if err == nil {
+            var chunk []models.User
+            err = g.db.WithContext(ctx).Where("id IN ?", ids[start:end]).Find(&chunk).Error
+            users = append(users, chunk...)
+        }
+    })
+    return users, err
+}
+
+func (g *GormDatabase) snapshotUserByEmail(ctx context.Context, email string) (*models.User, error) {
+    var users []models.User
+    if err := g.db.WithContext(ctx).Where("LOWER(email) = LOWER(?)", email).Limit(1).Find(&users).Error; err != nil {
+        return nil, err
+    }
+    if len(users) == 0 {
+        return nil, nil
+    }
+    return &users[0], nil
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+    "fmt"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+    "strings"
+)
+
+func gormFilters(filters []Filter, where Expr) func(*gorm.DB) *gorm.DB {
+    return func(db *gorm.DB) *gorm.DB {
+        for _, filter := range filters {
+            db = db.Where(gormCondition(filter))
+        }
+        if where != nil {
+            db = db.Where(gormCondition(where))
+        }
+        return db
+    }
+}
+
+// gormCondition compiles a filter expression to SQL. Columns are quoted by
+// gorm and values are always bound as parameters.
+func gormCondition(expr Expr) clause.Expression {
+    switch e := expr.(type) {
+    case AndExpr:
+        return clause.Expr{SQL: "(? AND ?)", Vars: []interface{}{gormCondition(e.Left), gormCondition(e.Right)}}
+    case OrExpr:
+        return clause.Expr{SQL: "(? OR ?)", Vars: []interface{}{gormCondition(e.Left), gormCondition(e.Right)}}
+    case NotExpr:
+        return clause.Expr{SQL: "NOT (?)", Vars: []interface{}{gormCondition(e.Expr)}}
+    case Filter:
+        column := gormColumn(e.Field)
+        switch e.Op {
+        case OpNe:
+            return clause.Neq{Column: column, Value: e.Value}
+        case OpGt:
+            return clause.Gt{Column: column, Value: e.Value}
+        case OpGte:
+            return clause.Gte{Column: column, Value: e.Value}
+        case OpLt:
+            return clause.Lt{Column: column, Value: e.Value}
+        case OpLte:
+            return clause.Lte{Column: column, Value: e.Value}
+        case OpContains, OpStartsWith, OpEndsWith:
+            return clause.Expr{
+                SQL:  "LOWER(?) LIKE LOWER(?) ESCAPE '!'",
+                Vars: []interface{}{column, likePattern(e.Op, fmt.Sprint(e.Value))},
+            }
+        case OpPresent:
+            return clause.Expr{SQL: "? IS NOT NULL", Vars: []interface{}{column}}
+        }
+        return clause.Eq{Column: column, Value: e.Value}
+    }
+    return clause.Expr{SQL: "1 = 0"}
+}
+
+// likePattern escapes LIKE wildcards in value with ! and anchors it for op
+func likePattern(op, value string) string {
+    value = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(value)
+    switch op {
+    case OpStartsWith:
+        return value + "%"
+    case OpEndsWith:
+        return "%" + value
+    }
+    return "%" + value + "%"
+}
+
+func gormPage(opts ListOptions, order []SortField, after []interface{}) func(*gorm.DB) *gorm.DB {
+    return func(db *gorm.DB) *gorm.DB {
+        if after != nil {
+            db = db.Where(gormKeyset(order, after))
+        } else if opts.Offset > 0 {
+            db = db.Offset(opts.Offset)
+        }
+        for _, field := range order {
+            db = db.Order(clause.OrderByColumn{Column: gormColumn(field.Field), Desc: field.Desc})
+        }
+        if opts.Limit > 0 {
+            db = db.Limit(opts.Limit)
+        }
+        return db
+    }
+}
+
+// gormKeyset matches the rows that sort after the given values:
+// (a > ?) OR (a = ? AND b > ?) OR ..., with < for descending fields
+func gormKeyset(order []SortField, values []interface{}) clause.Expression {
+    var branches []clause.Expression
+    for i, field := range order {
+        var terms []clause.Expression
+        for j := 0; j < i; j++ {
+            terms = append(terms, clause.Eq{Column: gormColumn(order[j].Field), Value: values[j]})
+        }
+        column := gormColumn(field.Field)
+        if field.Desc {
+            terms = append(terms, clause.Lt{Column: column, Value: values[i]})
+        } else {
+            terms = append(terms, clause.Gt{Column: column, Value: values[i]})
+        }
+        branches = append(branches, clause.And(terms...))
+    }
+    if len(branches) == 1 {
+        return branches[0]
+    }
+    return clause.Or(branches...)
+}
+
+// gormColumn qualifies column with the model's table so that it stays
+// unambiguous in joins
+func gormColumn(name string) clause.Column {
+    return clause.Column{Table: clause.CurrentTable, Name: name}
+}
@@ -0,0 +1,258 @@
+package database
+
+import (
+    "context"
+    "errors"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+    "reflect"
+    "time"
+)
+
+type gormRepository[T any] struct {
+    db     *gorm.DB
+    schema modelSchema
+}
+
+func newGormRepository[T any](db *gorm.DB) (*gormRepository[T], error) {
+    s, err := parseModel[T](db.NamingStrategy)
+    if err != nil {
+        return nil, err
+    }
+    return &gormRepository[T]{db: db, schema: s}, nil
+}
+
+// query starts a statement on the model's table, leaving out soft deleted
+// rows unless includeDeleted is set
+func (r *gormRepository[T]) query(ctx context.Context, includeDeleted bool) *gorm.DB {
+    query := r.db.WithContext(ctx).Model(new(T))
+    if r.schema.softDelete && !includeDeleted {
+        query = query.Scopes(notDeleted)
+    }
+    return query
+}
+
+func (r *gormRepository[T]) byID(id interface{}) clause.Expression {
+    return clause.Eq{Column: gormColumn(r.schema.primaryKey.DBName), Value: id}
+}
+
+// bump is the assignment that increments the version column
+func (r *gormRepository[T]) bump() clause.Expr {
+    return gorm.Expr("? + 1", gormColumn(r.schema.version.DBName))
+}
+
+// missing tells why a versioned write matched no row: ErrStale if the entity
+// exists, ErrNotFound otherwise
+func (r *gormRepository[T]) missing(ctx context.Context, id interface{}) error {
+    var count int64
+    if err := r.query(ctx, false).Where(r.byID(id)).Count(&count).Error; err != nil {
+        return err
+    }
+    if count > 0 {
+        return ErrStale
+    }
+    return ErrNotFound
+}
+
+func (r *gormRepository[T]) Create(ctx context.Context, entity *T) error {
+    return r.db.WithContext(ctx).Create(entity).Error
+}
+
+func (r *gormRepository[T]) Get(ctx context.Context, id interface{}) (*T, error) {
+    var entity T
+    err := r.query(ctx, false).Where(r.byID(id)).First(&entity).Error
+    return &entity, err
+}
+
+func (r *gormRepository[T]) List(ctx context.Context, opts ListOptions) ([]T, int64, error) {
+    if err := opts.Validate(); err != nil {
+        return nil, 0, err
+    }
+    query := r.query(ctx, opts.IncludeDeleted).Scopes(gormFilters(opts.Filters, opts.Where)).Session(&gorm.Session{})
+    var total int64
+    if err := query.Count(&total).Error; err != nil {
+        return nil, 0, err
+    }
+    order, after, err := opts.keyset(r.schema.primaryKey.DBName)
+    if err != nil {
+        return nil, 0, err
+    }
+    entities := []T{}
+    if err := query.Scopes(gormPage(opts, order, after)).Find(&entities).Error; err != nil {
+        return nil, 0, err
+    }
+    if opts.Cursor != nil && opts.Cursor.Backward {
+        reverse(entities)
+    }
+    return entities, total, nil
+}
+
+func (r *gormRepository[T]) Update(ctx context.Context, entity *T) error {
+    version := r.schema.version
+    if version == nil {
+        return r.db.WithContext(ctx).Save(entity).Error
+    }
+    value := reflect.ValueOf(entity)
+    expected, _ := version.ValueOf(ctx, value)
+    if err := version.Set(ctx, value, nextVersion(expected)); err != nil {
+        return err
+    }
+    result := r.db.WithContext(ctx).Select("*").
+        Where(clause.Eq{Column: gormColumn(version.DBName), Value: expected}).Updates(entity)
+    if result.Error == nil && result.RowsAffected == 0 {
+        result.Error = r.missing(ctx, r.schema.primaryKeyOf(ctx, entity))
+    }
+    if result.Error != nil {
+        _ = version.Set(ctx, value, expected)
+    }
+    return result.Error
+}
+
+func (r *gormRepository[T]) Patch(ctx context.Context, id interface{}, changes map[string]interface{}) error {
+    expected, changes := r.schema.expectedVersion(changes)
+    query := r.query(ctx, false).Where(r.byID(id))
+    if r.schema.version != nil {
+        changes[r.schema.version.DBName] = r.bump()
+        if expected != nil {
+            query = query.Where(clause.Eq{Column: gormColumn(r.schema.version.DBName), Value: expected})
+        }
+    }
+    result := query.Updates(changes)
+    if result.Error == nil && result.RowsAffected == 0 {
+        if expected != nil {
+            return r.missing(ctx, id)
+        }
+        return ErrNotFound
+    }
+    return result.Error
+}
+
+// remove soft or hard deletes the rows query selects
+func (r *gormRepository[T]) remove(query *gorm.DB) *gorm.DB {
+    if !r.schema.softDelete {
+        return query.Delete(new(T))
+    }
+    set := map[string]interface{}{"deleted_at": time.Now()}
+    if r.schema.version != nil {
+        set[r.schema.version.DBName] = r.bump()
+    }
+    return query.Updates(set)
+}
+
+func (r *gormRepository[T]) Delete(ctx context.Context, id interface{}) error {
+    result := r.remove(r.query(ctx, false).Where(r.byID(id)))
+    if result.Error == nil && result.RowsAffected == 0 {
+        return ErrNotFound
+    }
+    return result.Error
+}
+
+func (r *gormRepository[T]) Count(ctx context.Context, opts ListOptions) (int64, error) {
+    var total int64
+    err := r.query(ctx, opts.IncludeDeleted).Scopes(gormFilters(opts.Filters, opts.Where)).Count(&total).Error
+    return total, err
+}
+
+func (r *gormRepository[T]) GetMany(ctx context.Context, ids []interface{}) ([]T, error) {
+    entities := []T{}
+    var err error
+    chunks(len(ids), func(start, end int) {
+        if err == nil {
+            err = r.query(ctx, false).Where(r.inIDs(ids[start:end])).Find(&entities).Error
+        }
+    })
+    return entities, err
+}
+
+func (r *gormRepository[T]) inIDs(ids []interface{}) clause.Expression {
+    return clause.IN{Column: gormColumn(r.schema.primaryKey.DBName), Values: ids}
+}
+
+func (r *gormRepository[T]) CreateMany(ctx context.Context, entities []*T) []error {
+    errs := make([]error, len(entities))
+    if len(entities) == 0 {
+        return errs
+    }
+    pk := r.schema.primaryKey
+    unset := make([]bool, len(entities))
+    for i, entity := range entities {
+        _, unset[i] = pk.ValueOf(ctx, reflect.ValueOf(entity))
+    }
+    // The savepoint keeps a failed INSERT from aborting an outer transaction
+    err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        return tx.CreateInBatches(entities, BatchSize).Error
+    })
+    if err == nil {
+        return errs
+    }
+    if errors.Is(err, ErrUnavailable) || errors.Is(err, ErrTimeout) {
+        return fill(errs, err)
+    }
+    // A row was rejected and the batches were rolled back, so insert the
+    // entities one at a time to tell which
+    for i, entity := range entities {
+        if unset[i] {
+            _ = pk.Set(ctx, reflect.ValueOf(entity), reflect.Zero(pk.FieldType).Interface())
+        }
+        errs[i] = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+            return tx.Create(entity).Error
+        })
+    }
+    return errs
+}
+
+func (r *gormRepository[T]) PatchMany(ctx context.Context, items []BulkItem) []error {
+    // UPDATE has no batched form for rows that get different values
+    errs := make([]error, len(items))
+    for i, item := range items {
+        errs[i] = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+            return (&gormRepository[T]{db: tx, schema: r.schema}).Patch(ctx, item.ID, item.columns(r.schema))
+        })
+    }
+    return errs
+}
+
+func (r *gormRepository[T]) DeleteMany(ctx context.Context, items []BulkItem) []error {
+    errs := make([]error, len(items))
+    // Items that expect a version need a condition of their own; the others
+    // are deleted a batch at a time
+    var unconditional []int
+    for i, item := range items {
+        if item.Version == nil || r.schema.version == nil {
+            unconditional = append(unconditional, i)
+            continue
+        }
+        query := r.query(ctx, false).Where(r.byID(item.ID)).
+            Where(clause.Eq{Column: gormColumn(r.schema.version.DBName), Value: item.Version})
+        result := r.remove(query)
+        errs[i] = result.Error
+        if result.Error == nil && result.RowsAffected == 0 {
+            errs[i] = r.missing(ctx, item.ID)
+        }
+    }
+    chunks(len(unconditional), func(start, end int) {
+        batch := unconditional[start:end]
+        ids := make([]interface{}, len(batch))
+        for j, i := range batch {
+            ids[j] = items[i].ID
+        }
+        var found []interface{}
+        err := r.query(ctx, false).Where(r.inIDs(ids)).Pluck(r.schema.primaryKey.DBName, &found).Error
+        if err == nil && len(found) > 0 {
+            err = r.remove(r.query(ctx, false).Where(r.inIDs(found))).Error
+        }
+        exists := map[string]bool{}
+        for _, id := range found {
+            exists[keyOf(id)] = true
+        }
+        for _, i := range batch {
+            switch {
+            case err != nil:
+                errs[i] = err
+            case !exists[keyOf(items[i].ID)]:
+                errs[i] = ErrNotFound
+            }
+        }
+    })
+    return errs
+}
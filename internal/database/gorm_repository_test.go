@@ -0,0 +1,124 @@
+package database
+
+import (
+    "context"
+    "errors"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "testing"
+)
+
+func TestRepositoryVersioned(t *testing.T) {
+    db := newTestDatabase(t)
+    ctx := context.Background()
+    users, err := NewRepository[models.User](db)
+    if err != nil {
+        t.Fatal(err)
+    }
+    user := models.NewUser("Ann", "ann@example.com")
+    if err := users.Create(ctx, user); err != nil {
+        t.Fatal(err)
+    }
+    stored, err := users.Get(ctx, user.ID)
+    if err != nil || stored.Name != "Ann" || stored.Version != 1 {
+        t.Fatalf("Get = %+v, %v, want Ann at version 1", stored, err)
+    }
+
+    // Update expects the version it holds and leaves the new one in it
+    stored.Name = "Anna"
+    if err := users.Update(ctx, stored); err != nil || stored.Version != 2 {
+        t.Fatalf("Update: %v, version %d, want version 2", err, stored.Version)
+    }
+    user.Name = "Annie"
+    if err := users.Update(ctx, user); !errors.Is(err, ErrStale) || user.Version != 1 {
+        t.Errorf("stale Update: %v, version %d, want ErrStale with the version kept", err, user.Version)
+    }
+
+    // A version in the changes of Patch is the one expected
+    tests := []struct {
+        name    string
+        id      uint
+        changes map[string]interface{}
+        err     error
+        version uint
+    }{
+        {"stale", user.ID, map[string]interface{}{"name": "Annie", "version": uint(1)}, ErrStale, 2},
+        {"current", user.ID, map[string]interface{}{"name": "Annie", "version": uint(2)}, nil, 3},
+        {"unconditional", user.ID, map[string]interface{}{"name": "Ann"}, nil, 4},
+        {"missing", 999, map[string]interface{}{"name": "Bob", "version": uint(1)}, ErrNotFound, 4},
+    }
+    for _, test := range tests {
+        if err := users.Patch(ctx, test.id, test.changes); !errors.Is(err, test.err) || (test.err == nil) != (err == nil) {
+            t.Errorf("%s Patch: %v, want %v", test.name, err, test.err)
+        }
+        if stored, err := users.Get(ctx, user.ID); err != nil || stored.Version != test.version {
+            t.Errorf("%s Patch: %+v, %v, want version %d", test.name, stored, err, test.version)
+        }
+    }
+
+    // Delete is soft on a model with deleted_at
+    if err := users.Delete(ctx, user.ID); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := users.Get(ctx, user.ID); !errors.Is(err, ErrNotFound) {
+        t.Errorf("Get of a deleted user: %v, want ErrNotFound", err)
+    }
+    if err := users.Delete(ctx, user.ID); !errors.Is(err, ErrNotFound) {
+        t.Errorf("Delete of a deleted user: %v, want ErrNotFound", err)
+    }
+    if count, err := users.Count(ctx, ListOptions{IncludeDeleted: true}); err != nil || count != 1 {
+        t.Errorf("Count with deleted = %d, %v, want 1", count, err)
+    }
+    if err := users.Patch(ctx, user.ID, map[string]interface{}{"name": "Bob", "version": uint(5)}); !errors.Is(err, ErrNotFound) {
+        t.Errorf("Patch of a deleted user: %v, want ErrNotFound", err)
+    }
+}
+
+func TestRepositoryUnversioned(t *testing.T) {
+    db := newTestDatabase(t)
+    ctx := context.Background()
+    webhooks, err := NewRepository[models.Webhook](db)
+    if err != nil {
+        t.Fatal(err)
+    }
+    hooks := []*models.Webhook{{URL: "http://a.test/"}, {URL: "http://b.test/"}, {URL: "http://c.test/"}}
+    for _, err := range webhooks.CreateMany(ctx, hooks) {
+        if err != nil {
+            t.Fatal(err)
+        }
+    }
+    list, total, err := webhooks.List(ctx, ListOptions{
+        Filters: []Filter{{Field: "url", Op: OpNe, Value: "http://b.test/"}},
+        Sort:    []SortField{{Field: "id", Desc: true}},
+    })
+    if err != nil || total != 2 || len(list) != 2 || list[0].ID != hooks[2].ID {
+        t.Errorf("List = %+v, %d, %v, want c and a", list, total, err)
+    }
+
+    hooks[0].Paused = true
+    if err := webhooks.Update(ctx, hooks[0]); err != nil {
+        t.Fatal(err)
+    }
+    if err := webhooks.Patch(ctx, hooks[1].ID, map[string]interface{}{"url": "http://d.test/"}); err != nil {
+        t.Fatal(err)
+    }
+    many, err := webhooks.GetMany(ctx, []interface{}{hooks[0].ID, hooks[1].ID, uint(999)})
+    if err != nil || len(many) != 2 {
+        t.Fatalf("GetMany = %+v, %v, want a and d", many, err)
+    }
+    for _, hook := range many {
+        if hook.ID == hooks[0].ID && !hook.Paused || hook.ID == hooks[1].ID && hook.URL != "http://d.test/" {
+            t.Errorf("webhook %d = %+v, want the writes", hook.ID, hook)
+        }
+    }
+
+    // Delete is hard without deleted_at
+    if err := webhooks.Delete(ctx, hooks[2].ID); err != nil {
+        t.Fatal(err)
+    }
+    if count, err := webhooks.Count(ctx, ListOptions{IncludeDeleted: true}); err != nil || count != 2 {
+        t.Errorf("Count = %d, %v, want 2", count, err)
+    }
+    if err := webhooks.Patch(ctx, 999, map[string]interface{}{"paused": true}); !errors.Is(err, ErrNotFound) {
+        t.Errorf("Patch of a missing webhook: %v, want ErrNotFound", err)
+    }
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+    "fmt"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+    "strings"
+)
+
+// searchUsers implements SearchUsers for the gorm backends with the full-text
+// index each dialect gets from the user_search migration. Results are ordered
+// by relevance, then by the requested sort.
+func searchUsers(db *gorm.DB, query string, opts ListOptions) ([]models.User, int64, error) {
+    if err := opts.Validate(); err != nil {
+        return nil, 0, err
+    }
+    if opts.Cursor != nil {
+        return nil, 0, fmt.Errorf("search results cannot be paged with cursors")
+    }
+    terms := searchTerms(query)
+    if len(terms) == 0 {
+        return nil, 0, ErrEmptySearch
+    }
+    search := db.Model(&models.User{})
+    // rank scores how well a row matches, best first unless desc is false
+    var rank string
+    var rankArgs []interface{}
+    desc := true
+    switch db.Dialector.Name() {
+    case "sqlite":
+        match := make([]string, len(terms))
+        for i, term := range terms {
+            match[i] = `"` + term + `"*`
+        }
+        search = search.Joins("JOIN users_fts ON users_fts.rowid = users.id").
+            Where("users_fts MATCH ?", strings.Join(match, " "))
+        rank, desc = "bm25(users_fts)", false
+    case "postgres":
+        tsquery := strings.Join(terms, ":* & ") + ":*"
+        search = search.Where("users.search @@ to_tsquery('simple', ?)", tsquery)
+        rank, rankArgs = "ts_rank(users.search, to_tsquery('simple', ?))", []interface{}{tsquery}
+    case "mysql":
+        match := "+" + strings.Join(terms, "* +") + "*"
+        search = search.Where("MATCH (users.name, users.email) AGAINST (? IN BOOLEAN MODE)", match)
+        rank, rankArgs = "MATCH (users.name, users.email) AGAINST (? IN BOOLEAN MODE)", []interface{}{match}
+    default:
+        return nil, 0, fmt.Errorf("search is not supported on %s", db.Dialector.Name())
+    }
+    search = search.Scopes(gormFilters(opts.Filters, opts.Where))
+    if !opts.IncludeDeleted {
+        search = search.Scopes(notDeleted)
+    }
+    search = search.Session(&gorm.Session{})
+    var total int64
+    if err := search.Count(&total).Error; err != nil {
+        return nil, 0, err
+    }
+    var users []models.User
+    err := search.Select("users.*, "+rank+" AS search_rank", rankArgs...).
+        Order(clause.OrderByColumn{Column: clause.Column{Name: "search_rank", Raw: true}, Desc: desc}).
+        Scopes(gormPage(opts, opts.OrderBy("id"), nil)).Find(&users).Error
+    return users, total, err
+}
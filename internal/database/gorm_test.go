@@ -0,0 +1,127 @@
+package database
+
+import (
+    "context"
+    "errors"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "path/filepath"
+    "sort"
+    "sync"
+    "testing"
+    "time"
+)
+
+// newTestDatabase returns a migrated SQLite database in a temporary file.
+// Writers wait for each other rather than failing with SQLITE_BUSY.
+func newTestDatabase(t *testing.T) Database {
+    t.Helper()
+    db, err := NewDatabase(Config{Type: "sqlite-pure", FilePath: filepath.Join(t.TempDir(), "test.db") + "?_pragma=busy_timeout(10000)"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := db.Connect(); err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { db.Close() })
+    return db
+}
+
+func TestRecordLoginFailure(t *testing.T) {
+    db := newTestDatabase(t)
+    ctx := context.Background()
+    now := time.Now().UTC().Truncate(time.Second)
+    lock := func(failures int) time.Duration { return time.Duration(failures) * time.Minute }
+
+    // Concurrent failures each get a count of their own
+    const n = 20
+    counts := make([]int, n)
+    var wg sync.WaitGroup
+    for i := 0; i < n; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            attempt, err := db.RecordLoginFailure(ctx, models.LoginScopeIP, "10.0.0.1", now, time.Time{}, lock)
+            if err != nil {
+                t.Error(err)
+                return
+            }
+            counts[i] = attempt.Failures
+        }(i)
+    }
+    wg.Wait()
+    sort.Ints(counts)
+    for i, count := range counts {
+        if count != i+1 {
+            t.Fatalf("counts = %v, want 1 to %d", counts, n)
+        }
+    }
+    attempt, err := db.GetLoginAttempt(ctx, models.LoginScopeIP, "10.0.0.1")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if attempt.Failures != n || attempt.LockedUntil == nil || !attempt.LockedUntil.Equal(now.Add(n*time.Minute)) {
+        t.Errorf("attempt = %+v, want %d failures locked for %d minutes", attempt, n, n)
+    }
+
+    // A failure after the reset time starts over
+    later := now.Add(time.Minute)
+    attempt, err = db.RecordLoginFailure(ctx, models.LoginScopeIP, "10.0.0.1", later, later, lock)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if attempt.Failures != 1 || !attempt.LockedUntil.Equal(later.Add(time.Minute)) {
+        t.Errorf("attempt after the reset = %+v, want 1 failure locked for a minute", attempt)
+    }
+
+    // Other identifiers and scopes are counted separately
+    other, err := db.RecordLoginFailure(ctx, models.LoginScopeAccount, "10.0.0.1", now, time.Time{}, lock)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if other.Failures != 1 {
+        t.Errorf("account failures = %d, want 1", other.Failures)
+    }
+    if err := db.DeleteLoginAttempt(ctx, models.LoginScopeIP, "10.0.0.1"); err != nil {
+        t.Fatal(err)
+    }
+    if attempt, err = db.GetLoginAttempt(ctx, models.LoginScopeIP, "10.0.0.1"); err != nil || attempt.Failures != 0 {
+        t.Errorf("after delete: %+v, %v, want no failures", attempt, err)
+    }
+}
+
+func TestWithTx(t *testing.T) {
+    db := newTestDatabase(t)
+    ctx := context.Background()
+    failed := errors.New("failed")
+    tests := []struct {
+        email string
+        fn    func() error
+        err   error
+    }{
+        {"commit@example.com", func() error { return nil }, nil},
+        {"error@example.com", func() error { return failed }, failed},
+        {"panic@example.com", func() error { panic(failed) }, failed},
+    }
+    for _, test := range tests {
+        err := func() (err error) {
+            defer func() {
+                if recovered := recover(); recovered != nil {
+                    err = recovered.(error)
+                }
+            }()
+            return db.WithTx(ctx, func(tx Database) error {
+                if err := tx.CreateUser(ctx, models.NewUser("Ann", test.email)); err != nil {
+                    t.Fatal(err)
+                }
+                return test.fn()
+            })
+        }()
+        if !errors.Is(err, test.err) || (test.err == nil) != (err == nil) {
+            t.Errorf("%s: error = %v, want %v", test.email, err, test.err)
+        }
+        _, err = db.GetUserByEmail(ctx, test.email)
+        if committed := err == nil; committed != (test.err == nil) {
+            t.Errorf("%s: committed = %v, error %v", test.email, committed, err)
+        }
+    }
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+    "time"
+)
+
+// notDeleted hides soft-deleted rows, as every query on a soft deleted model
+// does unless it asks for deleted rows explicitly
+func notDeleted(db *gorm.DB) *gorm.DB {
+    return db.Where(clause.Eq{Column: gormColumn("deleted_at"), Value: nil})
+}
+
+func restoreUser(db *gorm.DB, id uint) error {
+    result := db.Model(&models.User{}).Where("id = ? AND deleted_at IS NOT NULL", id).
+        Updates(map[string]interface{}{"deleted_at": nil, "version": gorm.Expr("version + 1")})
+    if result.Error == nil && result.RowsAffected == 0 {
+        return ErrNotFound
+    }
+    return result.Error
+}
+
+// upsertUserByEmail inserts user, or updates the user with its email with
+// ON CONFLICT (ON DUPLICATE KEY on MySQL), see Database.UpsertUserByEmail
+func upsertUserByEmail(db *gorm.DB, user *models.User) (bool, error) {
+    var created bool
+    err := db.Transaction(func(tx *gorm.DB) error {
+        // The unique index on email is case-sensitive on PostgreSQL and
+        // SQLite, so conflict on the spelling that is stored
+        var stored []string
+        err := tx.Model(&models.User{}).Where("LOWER(email) = LOWER(?)", user.Email).Limit(1).Pluck("email", &stored).Error
+        if err != nil {
+            return err
+        }
+        if len(stored) > 0 {
+            user.Email = stored[0]
+        }
+        columns := []string{"name", "updated_at"}
+        if user.Role != "" {
+            columns = append(columns, "role")
+        } else {
+            user.Role = models.RoleUser
+        }
+        if user.PasswordHash != "" {
+            columns = append(columns, "password_hash")
+        }
+        updates := append(clause.AssignmentColumns(columns), clause.Assignments(map[string]interface{}{
+            "deleted_at": nil,
+            "version":    gorm.Expr("users.version + 1"),
+        })...)
+        user.ID = 0
+        user.Version = 1
+        onConflict := clause.OnConflict{Columns: []clause.Column{{Name: "email"}}, DoUpdates: updates}
+        if err := tx.Clauses(onConflict).Create(user).Error; err != nil {
+            return err
+        }
+        var saved models.User
+        if err := tx.Where("email = ?", user.Email).First(&saved).Error; err != nil {
+            return err
+        }
+        // Only an insert leaves the version at 1, and the row stays locked
+        // until the transaction ends
+        created = saved.Version == 1
+        *user = saved
+        return nil
+    })
+    return created, err
+}
+
+// purgeUser removes a user, deleted or not, along with its linked identities
+func purgeUser(db *gorm.DB, id uint, version uint) error {
+    return db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Where("user_id = ?", id).Delete(&models.Identity{}).Error; err != nil {
+            return err
+        }
+        query := tx.Where("id = ?", id)
+        if version != 0 {
+            query = query.Where("version = ?", version)
+        }
+        result := query.Delete(&models.User{})
+        if result.Error != nil || result.RowsAffected > 0 {
+            return result.Error
+        }
+        var count int64
+        if version != 0 {
+            if err := tx.Model(&models.User{}).Where("id = ?", id).Count(&count).Error; err != nil {
+                return err
+            }
+        }
+        if count > 0 {
+            return ErrStale
+        }
+        return ErrNotFound
+    })
+}
+
+// purgeDeletedUsers removes the users deleted before the given time
+func purgeDeletedUsers(db *gorm.DB, before time.Time) (int64, error) {
+    var purged int64
+    err := db.Transaction(func(tx *gorm.DB) error {
+        deleted := tx.Model(&models.User{}).Select("id").Where("deleted_at < ?", before)
+        if err := tx.Where("user_id IN (?)", deleted).Delete(&models.Identity{}).Error; err != nil {
+            return err
+        }
+        result := tx.Where("deleted_at < ?", before).Delete(&models.User{})
+        purged = result.RowsAffected
+        return result.Error
+    })
+    return purged, err
+}
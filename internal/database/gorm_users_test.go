@@ -0,0 +1,102 @@
+package database
+
+import (
+    "context"
+    "errors"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "testing"
+    "time"
+)
+
+func TestSoftDeleteAndRestore(t *testing.T) {
+    db := newTestDatabase(t)
+    ctx := context.Background()
+    user := models.NewUser("Ann", "ann@example.com")
+    if err := db.CreateUser(ctx, user); err != nil {
+        t.Fatal(err)
+    }
+    if err := db.RestoreUser(ctx, user.ID); !errors.Is(err, ErrNotFound) {
+        t.Errorf("restoring a user that is not deleted: %v, want ErrNotFound", err)
+    }
+    if err := db.DeleteUser(ctx, user.ID, 0); err != nil {
+        t.Fatal(err)
+    }
+
+    // Deleted users are left out unless asked for
+    if _, err := db.GetUserByID(ctx, user.ID); !errors.Is(err, ErrNotFound) {
+        t.Errorf("GetUserByID of a deleted user: %v, want ErrNotFound", err)
+    }
+    if _, err := db.GetUserByEmail(ctx, user.Email); !errors.Is(err, ErrNotFound) {
+        t.Errorf("GetUserByEmail of a deleted user: %v, want ErrNotFound", err)
+    }
+    if err := db.DeleteUser(ctx, user.ID, 0); !errors.Is(err, ErrNotFound) {
+        t.Errorf("deleting a deleted user: %v, want ErrNotFound", err)
+    }
+    if _, total, err := db.ListUsers(ctx, ListOptions{}); err != nil || total != 0 {
+        t.Errorf("ListUsers: %d users, %v, want none", total, err)
+    }
+    users, total, err := db.ListUsers(ctx, ListOptions{IncludeDeleted: true})
+    if err != nil || total != 1 || users[0].DeletedAt == nil || users[0].Version != 2 {
+        t.Fatalf("ListUsers with deleted: %+v, %v, want Ann deleted at version 2", users, err)
+    }
+
+    if err := db.RestoreUser(ctx, user.ID); err != nil {
+        t.Fatal(err)
+    }
+    restored, err := db.GetUserByID(ctx, user.ID)
+    if err != nil || restored.DeletedAt != nil || restored.Version != 3 {
+        t.Errorf("restored user: %+v, %v, want Ann at version 3", restored, err)
+    }
+}
+
+func TestPurge(t *testing.T) {
+    db := newTestDatabase(t)
+    ctx := context.Background()
+    users := map[string]*models.User{}
+    for i, name := range []string{"Ann", "Bob", "Cy"} {
+        user := models.NewUser(name, name+"@example.com")
+        if err := db.CreateUser(ctx, user); err != nil {
+            t.Fatal(err)
+        }
+        identity := &models.Identity{UserID: user.ID, Provider: "google", Subject: string(rune('a' + i))}
+        if err := db.CreateIdentity(ctx, identity); err != nil {
+            t.Fatal(err)
+        }
+        users[name] = user
+    }
+
+    // Purging removes a user whether it was deleted or not, with its
+    // identities
+    if err := db.PurgeUser(ctx, users["Ann"].ID, 0); err != nil {
+        t.Fatal(err)
+    }
+    if _, total, err := db.ListUsers(ctx, ListOptions{IncludeDeleted: true}); err != nil || total != 2 {
+        t.Errorf("%d users left, %v, want 2", total, err)
+    }
+    if _, err := db.GetIdentity(ctx, "google", "a"); !errors.Is(err, ErrNotFound) {
+        t.Errorf("Ann's identity: %v, want ErrNotFound", err)
+    }
+    if err := db.PurgeUser(ctx, users["Ann"].ID, 0); !errors.Is(err, ErrNotFound) {
+        t.Errorf("purging a purged user: %v, want ErrNotFound", err)
+    }
+
+    // Retention purges only the users deleted before the cutoff
+    if err := db.DeleteUser(ctx, users["Bob"].ID, 0); err != nil {
+        t.Fatal(err)
+    }
+    if purged, err := db.PurgeDeletedUsers(ctx, time.Now().Add(-time.Hour)); err != nil || purged != 0 {
+        t.Errorf("purged %d recently deleted users, %v, want none", purged, err)
+    }
+    if purged, err := db.PurgeDeletedUsers(ctx, time.Now().Add(time.Second)); err != nil || purged != 1 {
+        t.Errorf("purged %d users, %v, want Bob", purged, err)
+    }
+    if _, err := db.GetIdentity(ctx, "google", "b"); !errors.Is(err, ErrNotFound) {
+        t.Errorf("Bob's identity: %v, want ErrNotFound", err)
+    }
+    if _, err := db.GetUserByID(ctx, users["Cy"].ID); err != nil {
+        t.Errorf("Cy: %v, want the user kept", err)
+    }
+    if _, err := db.GetIdentity(ctx, "google", "c"); err != nil {
+        t.Errorf("Cy's identity: %v, want it kept", err)
+    }
+}
@@ -0,0 +1,144 @@
+package database
+
+import (
+    "context"
+    "encoding/json"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "strconv"
+    "time"
+)
+
+// UserHistory replays the audit log of a user backwards from its stored state
+// to rebuild the states it had before. Changes made before the audit log was
+// kept are not in it, so states older than the first entry are a guess.
+type UserHistory struct {
+    state   map[string]interface{}
+    entries []models.AuditEntry
+    // password sums up the password changes undone so far
+    password *models.AuditChange
+}
+
+// LoadUserHistory reads the stored state of the user with the given ID, soft
+// deleted or purged, and the audit entries made after since, newest first. A
+// zero since reads them all.
+func LoadUserHistory(ctx context.Context, db Database, id uint, since time.Time) (*UserHistory, error) {
+    if audited, ok := db.(*auditedDatabase); ok {
+        db = audited.Database
+    }
+    current, err := (&auditedDatabase{Database: db}).snapshot(ctx, []uint{id})
+    if err != nil {
+        return nil, err
+    }
+    opts := ListOptions{
+        Sort: []SortField{{Field: "id", Desc: true}},
+        Filters: []Filter{
+            {Field: "resource", Op: OpEq, Value: "users"},
+            {Field: "resource_id", Op: OpEq, Value: strconv.FormatUint(uint64(id), 10)},
+        },
+    }
+    if !since.IsZero() {
+        opts.Filters = append(opts.Filters, Filter{Field: "created_at", Op: OpGt, Value: since})
+    }
+    entries, _, err := db.ListAuditEntries(ctx, opts)
+    if err != nil {
+        return nil, err
+    }
+    return &UserHistory{state: jsonFields(snapshotOf(current, id)), entries: entries}, nil
+}
+
+// AsOf rewinds to the state of the user at the given time, which must not be
+// before the since time the history was loaded with. It returns ErrNotFound if
+// the user did not exist then.
+func (h *UserHistory) AsOf(at time.Time) (*models.User, error) {
+    for len(h.entries) > 0 && h.entries[0].CreatedAt.After(at) {
+        h.undo()
+    }
+    return h.found(h.user())
+}
+
+// AtVersion rewinds to the last state of the user with the given version. It
+// returns ErrNotFound if the user never had it.
+func (h *UserHistory) AtVersion(version uint) (*models.User, error) {
+    user := h.user()
+    for len(h.entries) > 0 && (user == nil || user.Version > version) {
+        h.undo()
+        user = h.user()
+    }
+    if user != nil && user.Version != version {
+        user = nil
+    }
+    return h.found(user)
+}
+
+// DiffUserVersions returns the fields that changed between two versions of a
+// user, with their values in from and to. A changed password is listed
+// without its values.
+func DiffUserVersions(ctx context.Context, db Database, id uint, from, to uint) (models.AuditChanges, error) {
+    history, err := LoadUserHistory(ctx, db, id, time.Time{})
+    if err != nil {
+        return nil, err
+    }
+    newer, older := to, from
+    if from > to {
+        newer, older = from, to
+    }
+    newest, err := history.AtVersion(newer)
+    if err != nil {
+        return nil, err
+    }
+    history.password = nil
+    oldest, err := history.AtVersion(older)
+    if err != nil {
+        return nil, err
+    }
+    before, after := oldest, newest
+    if from > to {
+        before, after = newest, oldest
+    }
+    changes := diffUsers(before, after)
+    if password := history.password; password != nil {
+        if from > to {
+            password.Before, password.After = password.After, password.Before
+        }
+        changes["password"] = *password
+    }
+    return changes, nil
+}
+
+// undo reverts the newest entry that is left
+func (h *UserHistory) undo() {
+    for name, change := range h.entries[0].Changes {
+        if name == "password" {
+            if h.password == nil {
+                h.password = &models.AuditChange{After: change.After}
+            }
+            h.password.Before = change.Before
+            continue
+        }
+        h.state[name] = change.Before
+    }
+    h.entries = h.entries[1:]
+}
+
+func (h *UserHistory) found(user *models.User) (*models.User, error) {
+    if user == nil {
+        return nil, ErrNotFound
+    }
+    return user, nil
+}
+
+// user converts the replayed fields to a user, nil if it did not exist
+func (h *UserHistory) user() *models.User {
+    if h.state["id"] == nil {
+        return nil
+    }
+    data, err := json.Marshal(h.state)
+    if err != nil {
+        return nil
+    }
+    var user models.User
+    if err := json.Unmarshal(data, &user); err != nil {
+        return nil
+    }
+    return &user
+}
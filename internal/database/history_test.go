@@ -0,0 +1,110 @@
+package database
+
+import (
+    "context"
+    "errors"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "testing"
+    "time"
+)
+
+func TestUserHistoryAsOf(t *testing.T) {
+    db := newTestDatabase(t)
+    ctx := context.Background()
+    id, entries := createUserHistory(t, db)
+    tests := []struct {
+        name    string
+        at      time.Time
+        want    string
+        version uint
+        deleted bool
+    }{
+        {"before the first entry", entries[0].CreatedAt.Add(-time.Second), "", 0, false},
+        {"created", entries[0].CreatedAt, "Ann", 1, false},
+        {"renamed", entries[1].CreatedAt, "Anna", 2, false},
+        {"password changed", entries[2].CreatedAt, "Anna", 3, false},
+        {"soft deleted", entries[3].CreatedAt, "Anna", 4, true},
+        {"purged", entries[4].CreatedAt, "", 0, false},
+    }
+    for _, test := range tests {
+        // Loaded the way GET /users/{id}?as_of= does, with the entries after it
+        history, err := LoadUserHistory(ctx, db, id, test.at)
+        if err != nil {
+            t.Fatal(err)
+        }
+        user, err := history.AsOf(test.at)
+        if test.want == "" {
+            if !errors.Is(err, ErrNotFound) {
+                t.Errorf("%s: %+v, %v, want ErrNotFound", test.name, user, err)
+            }
+            continue
+        }
+        if err != nil || user.Name != test.want || user.Version != test.version || (user.DeletedAt != nil) != test.deleted {
+            t.Errorf("%s: %+v, %v, want %s at version %d", test.name, user, err, test.want, test.version)
+        }
+    }
+}
+
+func TestUserHistoryAtVersion(t *testing.T) {
+    db := newTestDatabase(t)
+    ctx := context.Background()
+    id, _ := createUserHistory(t, db)
+    history, err := LoadUserHistory(ctx, db, id, time.Time{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    // Versions are rewound newest first on one history
+    for _, version := range []uint{4, 3, 2, 1} {
+        user, err := history.AtVersion(version)
+        if err != nil || user.Version != version {
+            t.Fatalf("AtVersion(%d) = %+v, %v", version, user, err)
+        }
+    }
+    for _, version := range []uint{0, 5} {
+        history, err := LoadUserHistory(ctx, db, id, time.Time{})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if _, err := history.AtVersion(version); !errors.Is(err, ErrNotFound) {
+            t.Errorf("AtVersion(%d) error = %v, want ErrNotFound", version, err)
+        }
+    }
+}
+
+func TestDiffUserVersions(t *testing.T) {
+    db := newTestDatabase(t)
+    ctx := context.Background()
+    id, _ := createUserHistory(t, db)
+    tests := []struct {
+        name     string
+        from, to uint
+        want     models.AuditChanges
+    }{
+        // The password change after version 2 is not part of the diff
+        {"rename", 1, 2, models.AuditChanges{"name": {Before: "Ann", After: "Anna"}}},
+        {"password", 2, 3, models.AuditChanges{"password": {Before: nil, After: redacted}}},
+        {"both", 1, 3, models.AuditChanges{"name": {Before: "Ann", After: "Anna"}, "password": {Before: nil, After: redacted}}},
+        {"backwards", 3, 1, models.AuditChanges{"name": {Before: "Anna", After: "Ann"}, "password": {Before: redacted, After: nil}}},
+        {"same version", 2, 2, models.AuditChanges{}},
+    }
+    for _, test := range tests {
+        changes, err := DiffUserVersions(ctx, db, id, test.from, test.to)
+        if err != nil {
+            t.Fatalf("%s: %v", test.name, err)
+        }
+        delete(changes, "version")
+        delete(changes, "updated_at")
+        if len(changes) != len(test.want) {
+            t.Errorf("%s: changes = %+v, want %+v", test.name, changes, test.want)
+            continue
+        }
+        for field, want := range test.want {
+            if changes[field] != want {
+                t.Errorf("%s: %s = %+v, want %+v", test.name, field, changes[field], want)
+            }
+        }
+    }
+    if _, err := DiffUserVersions(ctx, db, id, 1, 9); !errors.Is(err, ErrNotFound) {
+        t.Errorf("diff to a missing version: %v, want ErrNotFound", err)
+    }
+}
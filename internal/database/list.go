@@ -0,0 +1,226 @@
+package database
+
+import (
+    "fmt"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "gorm.io/gorm/schema"
+    "reflect"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const (
+    OpEq         = "eq"
+    OpNe         = "ne"
+    OpGt         = "gt"
+    OpGte        = "gte"
+    OpLt         = "lt"
+    OpLte        = "lte"
+    OpContains   = "co"
+    OpStartsWith = "sw"
+    OpEndsWith   = "ew"
+    OpPresent    = "pr"
+)
+
+// ListOptions selects a page of records. Field names are database column names
+// and must be checked against a whitelist such as UserFields before use.
+type ListOptions struct {
+    Limit   int
+    Offset  int
+    Sort    []SortField
+    Filters []Filter
+    Where   Expr
+    Cursor  *Cursor
+    // IncludeDeleted lists soft-deleted records along with the others
+    IncludeDeleted bool
+}
+
+// Cursor continues a listing after the row whose sort values are Values, or
+// before it when Backward is set. Values line up with ListOptions.OrderBy and
+// the offset is ignored.
+type Cursor struct {
+    Values   []interface{}
+    Backward bool
+}
+
+type SortField struct {
+    Field string
+    Desc  bool
+}
+
+// Filter compares a column with a value. It is also the leaf of a parsed
+// filter expression.
+type Filter struct {
+    Field string
+    Op    string
+    Value interface{}
+}
+
+// FieldKind tells how filter values for a field are parsed
+type FieldKind int
+
+const (
+    KindString FieldKind = iota
+    KindInt
+    KindTime
+    KindBool
+)
+
+// Field maps a public field name to its column and value kind
+type Field struct {
+    Column string
+    Kind   FieldKind
+}
+
+// UserFields are the user fields clients may sort and filter on
+var UserFields = FieldsOf(models.UserSchema{})
+
+// FieldsOf derives the sortable and filterable fields of a model from its
+// tags. Fields are named by their JSON name, and fields hidden from JSON, not
+// stored by gorm or tagged `filter:"-"` are left out.
+func FieldsOf(model interface{}) map[string]Field {
+    fields := map[string]Field{}
+    collectFields(reflect.TypeOf(model), fields)
+    return fields
+}
+
+func collectFields(t reflect.Type, fields map[string]Field) {
+    if t.Kind() == reflect.Ptr {
+        t = t.Elem()
+    }
+    for i := 0; i < t.NumField(); i++ {
+        field := t.Field(i)
+        if field.Anonymous {
+            collectFields(field.Type, fields)
+            continue
+        }
+        if !field.IsExported() || field.Tag.Get("filter") == "-" {
+            continue
+        }
+        name := strings.Split(field.Tag.Get("json"), ",")[0]
+        gormTag := schema.ParseTagSetting(field.Tag.Get("gorm"), ";")
+        if name == "-" || gormTag["-"] != "" {
+            continue
+        }
+        if name == "" {
+            name = field.Name
+        }
+        column := gormTag["COLUMN"]
+        if column == "" {
+            column = schema.NamingStrategy{}.ColumnName("", field.Name)
+        }
+        kind, ok := fieldKind(field.Type)
+        if !ok {
+            continue
+        }
+        fields[name] = Field{Column: column, Kind: kind}
+    }
+}
+
+func fieldKind(t reflect.Type) (FieldKind, bool) {
+    if t.Kind() == reflect.Ptr {
+        t = t.Elem()
+    }
+    if t == reflect.TypeOf(time.Time{}) {
+        return KindTime, true
+    }
+    switch t.Kind() {
+    case reflect.String:
+        return KindString, true
+    case reflect.Bool:
+        return KindBool, true
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+        reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        return KindInt, true
+    }
+    return 0, false
+}
+
+// Parse converts a raw query value to the field's type
+func (k FieldKind) Parse(raw string) (interface{}, error) {
+    switch k {
+    case KindInt:
+        return strconv.ParseInt(raw, 10, 64)
+    case KindBool:
+        return strconv.ParseBool(raw)
+    case KindTime:
+        if t, err := time.Parse(time.RFC3339, raw); err == nil {
+            return t, nil
+        }
+        return time.Parse("2006-01-02", raw)
+    }
+    return raw, nil
+}
+
+// Filter builds a comparison on the field from a raw query value
+func (f Field) Filter(op, raw string) (Filter, error) {
+    filter := Filter{Field: f.Column, Op: op}
+    switch op {
+    case OpEq, OpNe, OpGt, OpGte, OpLt, OpLte:
+    case OpContains, OpStartsWith, OpEndsWith:
+        if f.Kind != KindString {
+            return filter, fmt.Errorf("operator %q only applies to text fields", op)
+        }
+    case OpPresent:
+        return filter, nil
+    default:
+        return filter, fmt.Errorf("unsupported filter operator %q", op)
+    }
+    value, err := f.Kind.Parse(raw)
+    if err != nil {
+        return filter, fmt.Errorf("invalid value %q", raw)
+    }
+    filter.Value = value
+    return filter, nil
+}
+
+func (o ListOptions) Validate() error {
+    if o.Limit < 0 || o.Offset < 0 {
+        return fmt.Errorf("limit and offset must not be negative")
+    }
+    for _, filter := range o.Filters {
+        switch filter.Op {
+        case OpEq, OpNe, OpGt, OpGte, OpLt, OpLte, OpContains, OpStartsWith, OpEndsWith, OpPresent:
+        default:
+            return fmt.Errorf("unsupported filter operator %q", filter.Op)
+        }
+    }
+    return nil
+}
+
+// OrderBy appends the primary key to the requested sort so that pages are
+// stable and every row has a unique position a cursor can point at
+func (o ListOptions) OrderBy(primaryKey string) []SortField {
+    sort := append([]SortField{}, o.Sort...)
+    for _, field := range sort {
+        if field.Field == primaryKey {
+            return sort
+        }
+    }
+    return append(sort, SortField{Field: primaryKey})
+}
+
+// keyset returns the order to query in and the cursor values to seek past.
+// Backward cursors query in reverse and their results must be reversed.
+func (o ListOptions) keyset(primaryKey string) ([]SortField, []interface{}, error) {
+    order := o.OrderBy(primaryKey)
+    if o.Cursor == nil {
+        return order, nil, nil
+    }
+    if len(o.Cursor.Values) != len(order) {
+        return nil, nil, fmt.Errorf("cursor does not match the sort order")
+    }
+    if o.Cursor.Backward {
+        for i := range order {
+            order[i].Desc = !order[i].Desc
+        }
+    }
+    return order, o.Cursor.Values, nil
+}
+
+func reverse[T any](items []T) {
+    for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+        items[i], items[j] = items[j], items[i]
+    }
+}
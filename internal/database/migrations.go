@@ -0,0 +1,86 @@
+package database
+
+import (
+    "context"
+    "embed"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/migrate"
+    "gorm.io/gorm"
+    "log"
+    "time"
+)
+
+// migrationFiles holds the versioned SQL migrations, one directory per dialect.
+// Create new ones with `go run ./cmd/api migrate new <name>`.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Migratable is implemented by the backends that manage their schema with
+// versioned migrations
+type Migratable interface {
+    Migrator() *migrate.Migrator
+}
+
+var goMigrations []migrate.Migration
+
+// RegisterMigration adds migrations written as Go functions. Call it before
+// connecting so the migrations run along with the embedded SQL ones.
+func RegisterMigration(migrations ...migrate.Migration) {
+    goMigrations = append(goMigrations, migrations...)
+}
+
+// autoMigratedUser has the users columns the initial schema has but a table
+// created by AutoMigrate, before the schema was migrated, may lack
+type autoMigratedUser struct {
+    Role         string     `gorm:"type:varchar(20);default:user"`
+    PasswordHash string     `gorm:"type:varchar(255)"`
+    DeletedAt    *time.Time `gorm:"index"`
+}
+
+func (autoMigratedUser) TableName() string {
+    return "users"
+}
+
+// adoptAutoMigrateSchema upgrades a users table that AutoMigrate created to
+// the initial schema, which skips existing tables. It runs right after the
+// initial schema, and on databases migrated before it existed on the next
+// start.
+var adoptAutoMigrateSchema = migrate.Migration{
+    Version: 20261019000050,
+    Name:    "adopt_automigrate_schema",
+    Up: func(tx *gorm.DB) error {
+        migrator := tx.Migrator()
+        for _, field := range []string{"Role", "PasswordHash", "DeletedAt"} {
+            if migrator.HasColumn(&autoMigratedUser{}, field) {
+                continue
+            }
+            if err := migrator.AddColumn(&autoMigratedUser{}, field); err != nil {
+                return err
+            }
+        }
+        if migrator.HasIndex(&autoMigratedUser{}, "DeletedAt") {
+            return nil
+        }
+        return migrator.CreateIndex(&autoMigratedUser{}, "DeletedAt")
+    },
+    // The columns belong to the initial schema, whose rollback drops them
+    Down: func(*gorm.DB) error { return nil },
+}
+
+func newMigrator(db *gorm.DB) *migrate.Migrator {
+    m := migrate.New(db, migrationFiles, "migrations")
+    m.Register(adoptAutoMigrateSchema)
+    m.Register(goMigrations...)
+    m.Logf = log.Printf
+    return m
+}
+
+// runMigrations brings the schema up to date unless the config opts out, as
+// the migrate command does to manage migrations itself
+func runMigrations(db *gorm.DB, config Config) error {
+    if config.SkipMigrations {
+        return nil
+    }
+    _, err := newMigrator(db).Up(context.Background(), 0)
+    return err
+}
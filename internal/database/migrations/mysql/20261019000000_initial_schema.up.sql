@@ -0,0 +1,55 @@
+CREATE TABLE IF NOT EXISTS users (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    name VARCHAR(100),
+    email VARCHAR(100),
+    role VARCHAR(20) DEFAULT 'user',
+    password_hash VARCHAR(255),
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    deleted_at DATETIME(3) NULL,
+    PRIMARY KEY (id),
+    UNIQUE INDEX uni_users_email (email),
+    INDEX idx_users_deleted_at (deleted_at)
+);
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    scope VARCHAR(20),
+    identifier VARCHAR(255),
+    failures BIGINT,
+    last_failure_at DATETIME(3) NULL,
+    locked_until DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    PRIMARY KEY (id),
+    UNIQUE INDEX idx_login_attempts_scope_identifier (scope, identifier)
+);
+
+CREATE TABLE IF NOT EXISTS identities (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    user_id BIGINT UNSIGNED,
+    provider VARCHAR(50),
+    subject VARCHAR(255),
+    email VARCHAR(100),
+    created_at DATETIME(3) NULL,
+    PRIMARY KEY (id),
+    INDEX idx_identities_user_id (user_id),
+    UNIQUE INDEX idx_identities_provider_subject (provider, subject)
+);
+
+CREATE TABLE IF NOT EXISTS audit_entries (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    action VARCHAR(50),
+    actor_id VARCHAR(50),
+    impersonator_id VARCHAR(50),
+    resource VARCHAR(50),
+    resource_id VARCHAR(50),
+    request_id VARCHAR(64),
+    details TEXT,
+    created_at DATETIME(3) NULL,
+    PRIMARY KEY (id),
+    INDEX idx_audit_entries_action (action),
+    INDEX idx_audit_entries_actor_id (actor_id),
+    INDEX idx_audit_entries_impersonator_id (impersonator_id),
+    INDEX idx_audit_entries_resource_id (resource_id),
+    INDEX idx_audit_entries_created_at (created_at)
+);
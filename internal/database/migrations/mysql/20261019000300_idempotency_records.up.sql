@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS idempotency_records (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    scope VARCHAR(100),
+    idempotency_key VARCHAR(255),
+    fingerprint VARCHAR(64),
+    status BIGINT,
+    headers TEXT,
+    body MEDIUMTEXT,
+    created_at DATETIME(3) NULL,
+    expires_at DATETIME(3) NULL,
+    PRIMARY KEY (id),
+    UNIQUE INDEX idx_idempotency_records_scope_key (scope, idempotency_key),
+    INDEX idx_idempotency_records_expires_at (expires_at)
+);
@@ -0,0 +1 @@
+ALTER TABLE audit_entries ADD COLUMN changes TEXT;
@@ -0,0 +1,42 @@
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    type VARCHAR(50),
+    resource_id VARCHAR(50),
+    data MEDIUMTEXT,
+    created_at DATETIME(3) NULL,
+    dispatched_at DATETIME(3) NULL,
+    version BIGINT UNSIGNED NOT NULL DEFAULT 1,
+    PRIMARY KEY (id),
+    INDEX idx_outbox_events_dispatched_at (dispatched_at)
+);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    url VARCHAR(2048),
+    secret VARCHAR(255),
+    events VARCHAR(255),
+    paused BOOLEAN,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    webhook_id BIGINT UNSIGNED,
+    event_id BIGINT UNSIGNED,
+    event_type VARCHAR(50),
+    status VARCHAR(20),
+    attempts BIGINT,
+    next_attempt_at DATETIME(3) NULL,
+    response_status BIGINT,
+    last_error TEXT,
+    delivered_at DATETIME(3) NULL,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    version BIGINT UNSIGNED NOT NULL DEFAULT 1,
+    PRIMARY KEY (id),
+    INDEX idx_webhook_deliveries_webhook_id (webhook_id),
+    INDEX idx_webhook_deliveries_event_id (event_id),
+    INDEX idx_webhook_deliveries_status_next_attempt_at (status, next_attempt_at)
+);
@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (
+    to_tsvector('simple', coalesce(name, '') || ' ' || translate(coalesce(email, ''), '@.-_+', '     '))
+) STORED;
+CREATE INDEX IF NOT EXISTS idx_users_search ON users USING GIN (search);
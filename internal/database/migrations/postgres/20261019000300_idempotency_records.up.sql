@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS idempotency_records (
+    id BIGSERIAL PRIMARY KEY,
+    scope VARCHAR(100),
+    idempotency_key VARCHAR(255),
+    fingerprint VARCHAR(64),
+    status INTEGER,
+    headers TEXT,
+    body TEXT,
+    created_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_idempotency_records_scope_key ON idempotency_records (scope, idempotency_key);
+CREATE INDEX IF NOT EXISTS idx_idempotency_records_expires_at ON idempotency_records (expires_at);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS audit_entries;
+DROP TABLE IF EXISTS identities;
+DROP TABLE IF EXISTS login_attempts;
+DROP TABLE IF EXISTS users;
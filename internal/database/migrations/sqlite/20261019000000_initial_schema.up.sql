@@ -0,0 +1,50 @@
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(100),
+    email VARCHAR(100) UNIQUE,
+    role VARCHAR(20) DEFAULT 'user',
+    password_hash VARCHAR(255),
+    created_at DATETIME,
+    updated_at DATETIME,
+    deleted_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    scope VARCHAR(20),
+    identifier VARCHAR(255),
+    failures INTEGER,
+    last_failure_at DATETIME,
+    locked_until DATETIME,
+    updated_at DATETIME
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_login_attempts_scope_identifier ON login_attempts (scope, identifier);
+
+CREATE TABLE IF NOT EXISTS identities (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER,
+    provider VARCHAR(50),
+    subject VARCHAR(255),
+    email VARCHAR(100),
+    created_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_identities_user_id ON identities (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_identities_provider_subject ON identities (provider, subject);
+
+CREATE TABLE IF NOT EXISTS audit_entries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    action VARCHAR(50),
+    actor_id VARCHAR(50),
+    impersonator_id VARCHAR(50),
+    resource VARCHAR(50),
+    resource_id VARCHAR(50),
+    request_id VARCHAR(64),
+    details TEXT,
+    created_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_audit_entries_action ON audit_entries (action);
+CREATE INDEX IF NOT EXISTS idx_audit_entries_actor_id ON audit_entries (actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_entries_impersonator_id ON audit_entries (impersonator_id);
+CREATE INDEX IF NOT EXISTS idx_audit_entries_resource_id ON audit_entries (resource_id);
+CREATE INDEX IF NOT EXISTS idx_audit_entries_created_at ON audit_entries (created_at);
@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    type VARCHAR(50),
+    resource_id VARCHAR(50),
+    data TEXT,
+    created_at DATETIME,
+    dispatched_at DATETIME,
+    version INTEGER NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_events_dispatched_at ON outbox_events (dispatched_at);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url VARCHAR(2048),
+    secret VARCHAR(255),
+    events VARCHAR(255),
+    paused NUMERIC,
+    created_at DATETIME,
+    updated_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhook_id INTEGER,
+    event_id INTEGER,
+    event_type VARCHAR(50),
+    status VARCHAR(20),
+    attempts INTEGER,
+    next_attempt_at DATETIME,
+    response_status INTEGER,
+    last_error TEXT,
+    delivered_at DATETIME,
+    created_at DATETIME,
+    updated_at DATETIME,
+    version INTEGER NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_event_id ON webhook_deliveries (event_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status_next_attempt_at ON webhook_deliveries (status, next_attempt_at);
@@ -0,0 +1,128 @@
+package database
+
+import (
+    "context"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/migrate"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "github.com/glebarez/sqlite"
+    "gorm.io/gorm"
+    "gorm.io/gorm/logger"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+// baselineUser is the users table as AutoMigrate created it before the
+// schema was migrated
+type baselineUser struct {
+    ID        uint       `gorm:"primaryKey"`
+    Name      string     `gorm:"type:varchar(100)"`
+    Email     string     `gorm:"unique;type:varchar(100)"`
+    CreatedAt time.Time  `gorm:"autoCreateTime"`
+    UpdatedAt time.Time  `gorm:"autoUpdateTime"`
+    DeletedAt *time.Time `gorm:"index"`
+}
+
+func (baselineUser) TableName() string {
+    return "users"
+}
+
+func openSQLite(t *testing.T) *gorm.DB {
+    t.Helper()
+    db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() {
+        if sqlDB, err := db.DB(); err == nil {
+            sqlDB.Close()
+        }
+    })
+    return db
+}
+
+// openAutoMigrated returns a database with users created by AutoMigrate and
+// Ann in it
+func openAutoMigrated(t *testing.T) *gorm.DB {
+    t.Helper()
+    db := openSQLite(t)
+    if err := db.AutoMigrate(&baselineUser{}); err != nil {
+        t.Fatal(err)
+    }
+    if err := db.Exec("INSERT INTO users (name, email, created_at, updated_at) VALUES ('Ann', 'ann@example.com', ?, ?)", time.Now(), time.Now()).Error; err != nil {
+        t.Fatal(err)
+    }
+    return db
+}
+
+// checkAdopted checks that the users of an upgraded database can be read,
+// written and logged in as
+func checkAdopted(t *testing.T, db *gorm.DB) {
+    t.Helper()
+    for _, column := range []string{"role", "password_hash", "deleted_at", "version"} {
+        if !db.Migrator().HasColumn("users", column) {
+            t.Errorf("users.%s is missing", column)
+        }
+    }
+    ctx := context.Background()
+    g := NewGormDatabase(db, Config{})
+    user, err := g.GetUserByEmail(ctx, "ann@example.com")
+    if err != nil {
+        t.Fatalf("GetUserByEmail: %v", err)
+    }
+    if user.Role != models.RoleUser || user.Version != 1 {
+        t.Errorf("existing user has role %q and version %d, want user and 1", user.Role, user.Version)
+    }
+    if err := g.CreateUser(ctx, models.NewUser("Bob", "bob@example.com")); err != nil {
+        t.Errorf("CreateUser: %v", err)
+    }
+    if err := g.DeleteUser(ctx, user.ID, user.Version); err != nil {
+        t.Errorf("DeleteUser: %v", err)
+    }
+}
+
+func TestMigrationsAdoptAutoMigratedSchema(t *testing.T) {
+    ctx := context.Background()
+    db := openAutoMigrated(t)
+    if _, err := newMigrator(db).Up(ctx, 0); err != nil {
+        t.Fatalf("Up: %v", err)
+    }
+    checkAdopted(t, db)
+
+    // Running again finds nothing to do
+    if applied, err := newMigrator(db).Up(ctx, 0); err != nil || applied != 0 {
+        t.Errorf("Up again = %d, %v", applied, err)
+    }
+}
+
+func TestMigrationsRepairMigratedAutoMigratedSchema(t *testing.T) {
+    // A database whose AutoMigrate table went through the migrations before
+    // the adoption step existed gets it on the next start
+    ctx := context.Background()
+    db := openAutoMigrated(t)
+    if _, err := migrate.New(db, migrationFiles, "migrations").Up(ctx, 0); err != nil {
+        t.Fatalf("Up without adoption: %v", err)
+    }
+    if db.Migrator().HasColumn("users", "role") {
+        t.Fatal("the initial schema altered an existing table")
+    }
+    if applied, err := newMigrator(db).Up(ctx, 0); err != nil || applied != 1 {
+        t.Fatalf("Up = %d, %v, want the adoption applied", applied, err)
+    }
+    checkAdopted(t, db)
+}
+
+func TestMigrationsFreshSchema(t *testing.T) {
+    ctx := context.Background()
+    db := openSQLite(t)
+    if _, err := newMigrator(db).Up(ctx, 0); err != nil {
+        t.Fatalf("Up: %v", err)
+    }
+    if err := NewGormDatabase(db, Config{}).CreateUser(ctx, models.NewUser("Ann", "ann@example.com")); err != nil {
+        t.Fatal(err)
+    }
+    checkAdopted(t, db)
+    if rolledBack, err := newMigrator(db).Down(ctx, 100); err != nil || db.Migrator().HasTable("users") {
+        t.Errorf("Down = %d, %v, want every migration rolled back", rolledBack, err)
+    }
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+    "fmt"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "regexp"
+)
+
+// mongoFilter translates list filters and the filter expression into a bson
+// query
+func mongoFilter(filters []Filter, where Expr) bson.M {
+    conditions := bson.A{}
+    for _, filter := range filters {
+        conditions = append(conditions, mongoCondition(filter))
+    }
+    if where != nil {
+        conditions = append(conditions, mongoCondition(where))
+    }
+    switch len(conditions) {
+    case 0:
+        return bson.M{}
+    case 1:
+        return conditions[0].(bson.M)
+    }
+    return bson.M{"$and": conditions}
+}
+
+// mongoCondition compiles a filter expression to a bson query. Text matches
+// are quoted so values never act as regular expressions.
+func mongoCondition(expr Expr) bson.M {
+    switch e := expr.(type) {
+    case AndExpr:
+        return bson.M{"$and": bson.A{mongoCondition(e.Left), mongoCondition(e.Right)}}
+    case OrExpr:
+        return bson.M{"$or": bson.A{mongoCondition(e.Left), mongoCondition(e.Right)}}
+    case NotExpr:
+        return bson.M{"$nor": bson.A{mongoCondition(e.Expr)}}
+    case Filter:
+        switch e.Op {
+        case OpNe, OpGt, OpGte, OpLt, OpLte:
+            return bson.M{e.Field: bson.M{"$" + e.Op: e.Value}}
+        case OpContains, OpStartsWith, OpEndsWith:
+            pattern := regexp.QuoteMeta(fmt.Sprint(e.Value))
+            switch e.Op {
+            case OpStartsWith:
+                pattern = "^" + pattern
+            case OpEndsWith:
+                pattern = pattern + "$"
+            }
+            return bson.M{e.Field: primitive.Regex{Pattern: pattern, Options: "i"}}
+        case OpPresent:
+            return bson.M{e.Field: bson.M{"$ne": nil}}
+        }
+        return bson.M{e.Field: bson.M{"$eq": e.Value}}
+    }
+    return bson.M{"_id": bson.M{"$exists": false}}
+}
+
+// mongoKeyset matches the documents that sort after the given values, the
+// same way gormKeyset does
+func mongoKeyset(order []SortField, values []interface{}) bson.M {
+    branches := bson.A{}
+    for i, field := range order {
+        branch := bson.M{}
+        for j := 0; j < i; j++ {
+            branch[order[j].Field] = values[j]
+        }
+        op := "$gt"
+        if field.Desc {
+            op = "$lt"
+        }
+        branch[field.Field] = bson.M{op: values[i]}
+        branches = append(branches, branch)
+    }
+    return bson.M{"$or": branches}
+}
+
+func mongoFindOptions(opts ListOptions, order []SortField, after []interface{}) *options.FindOptions {
+    sort := bson.D{}
+    for _, field := range order {
+        direction := 1
+        if field.Desc {
+            direction = -1
+        }
+        sort = append(sort, bson.E{Key: field.Field, Value: direction})
+    }
+    findOptions := options.Find().SetSort(sort)
+    if opts.Limit > 0 {
+        findOptions.SetLimit(int64(opts.Limit))
+    }
+    if after == nil && opts.Offset > 0 {
+        findOptions.SetSkip(int64(opts.Offset))
+    }
+    return findOptions
+}
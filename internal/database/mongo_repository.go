@@ -0,0 +1,437 @@
+package database
+
+import (
+    "context"
+    "errors"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "gorm.io/gorm/schema"
+    "reflect"
+    "time"
+)
+
+type mongoRepository[T any] struct {
+    m      *MongoDB
+    schema modelSchema
+}
+
+func newMongoRepository[T any](m *MongoDB) (*mongoRepository[T], error) {
+    s, err := parseModel[T](schema.NamingStrategy{})
+    if err != nil {
+        return nil, err
+    }
+    return &mongoRepository[T]{m: m, schema: s}, nil
+}
+
+func (r *mongoRepository[T]) collection() *mongo.Collection {
+    return r.m.db.Collection(r.schema.Table)
+}
+
+// scope adds the soft delete condition to filter unless includeDeleted is set
+func (r *mongoRepository[T]) scope(filter bson.M, includeDeleted bool) bson.M {
+    if !r.schema.softDelete || includeDeleted {
+        return filter
+    }
+    return bson.M{"$and": bson.A{filter, bson.M{"deleted_at": nil}}}
+}
+
+func (r *mongoRepository[T]) byID(id interface{}) bson.M {
+    return bson.M{bsonName(r.schema.primaryKey): id}
+}
+
+// missing tells why a versioned write matched no document: ErrStale if the
+// entity exists, ErrNotFound otherwise
+func (r *mongoRepository[T]) missing(ctx context.Context, id interface{}) error {
+    count, err := r.collection().CountDocuments(r.m.sessionContext(ctx), r.scope(r.byID(id), false), options.Count().SetLimit(1))
+    if err != nil {
+        return wrapError(err)
+    }
+    if count > 0 {
+        return ErrStale
+    }
+    return ErrNotFound
+}
+
+// prepare fills in what gorm would for the SQL backends: counter values for
+// empty integer primary keys, taken in one round trip, the auto create and
+// update times and the default values from the gorm tags
+func (r *mongoRepository[T]) prepare(ctx context.Context, entities []*T) error {
+    pk := r.schema.primaryKey
+    var unset []reflect.Value
+    if pk.DataType == schema.Uint || pk.DataType == schema.Int {
+        for _, entity := range entities {
+            if _, zero := pk.ValueOf(ctx, reflect.ValueOf(entity)); zero {
+                unset = append(unset, reflect.ValueOf(entity))
+            }
+        }
+    }
+    if len(unset) > 0 {
+        first, err := r.m.reserveIDs(ctx, r.schema.Table, len(unset))
+        if err != nil {
+            return wrapError(err)
+        }
+        for i, value := range unset {
+            if err := pk.Set(ctx, value, first+uint(i)); err != nil {
+                return err
+            }
+        }
+    }
+    now := time.Now()
+    for _, entity := range entities {
+        value := reflect.ValueOf(entity)
+        for _, field := range r.schema.Fields {
+            _, zero := field.ValueOf(ctx, value)
+            var err error
+            switch {
+            case field.AutoUpdateTime > 0, field.AutoCreateTime > 0 && zero:
+                err = field.Set(ctx, value, now)
+            case zero && field.DefaultValueInterface != nil:
+                err = field.Set(ctx, value, field.DefaultValueInterface)
+            }
+            if err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+func (r *mongoRepository[T]) Create(ctx context.Context, entity *T) error {
+    if err := r.prepare(ctx, []*T{entity}); err != nil {
+        return err
+    }
+    _, err := r.collection().InsertOne(r.m.sessionContext(ctx), entity)
+    return wrapError(err)
+}
+
+func (r *mongoRepository[T]) Get(ctx context.Context, id interface{}) (*T, error) {
+    var entity T
+    err := r.collection().FindOne(r.m.sessionContext(ctx), r.scope(r.byID(id), false)).Decode(&entity)
+    return &entity, wrapError(err)
+}
+
+func (r *mongoRepository[T]) List(ctx context.Context, opts ListOptions) ([]T, int64, error) {
+    ctx = r.m.sessionContext(ctx)
+    if err := opts.Validate(); err != nil {
+        return nil, 0, wrapError(err)
+    }
+    filter := r.scope(mongoFilter(opts.Filters, opts.Where), opts.IncludeDeleted)
+    total, err := r.collection().CountDocuments(ctx, filter)
+    if err != nil {
+        return nil, 0, wrapError(err)
+    }
+    order, after, err := opts.keyset(bsonName(r.schema.primaryKey))
+    if err != nil {
+        return nil, 0, wrapError(err)
+    }
+    if after != nil {
+        filter = bson.M{"$and": bson.A{filter, mongoKeyset(order, after)}}
+    }
+    cursor, err := r.collection().Find(ctx, filter, mongoFindOptions(opts, order, after))
+    if err != nil {
+        return nil, 0, wrapError(err)
+    }
+    entities := []T{}
+    if err := cursor.All(ctx, &entities); err != nil {
+        return nil, 0, wrapError(err)
+    }
+    if opts.Cursor != nil && opts.Cursor.Backward {
+        reverse(entities)
+    }
+    return entities, total, nil
+}
+
+// Update replaces the stored fields except the primary key and the creation
+// time, and refreshes the auto update times
+func (r *mongoRepository[T]) Update(ctx context.Context, entity *T) (err error) {
+    value := reflect.ValueOf(entity)
+    id := r.schema.primaryKeyOf(ctx, entity)
+    filter := r.byID(id)
+    if version := r.schema.version; version != nil {
+        expected, _ := version.ValueOf(ctx, value)
+        filter[bsonName(version)] = expected
+        if err := version.Set(ctx, value, nextVersion(expected)); err != nil {
+            return err
+        }
+        defer func() {
+            if err != nil {
+                _ = version.Set(ctx, value, expected)
+            }
+        }()
+    }
+    immutable := []string{bsonName(r.schema.primaryKey)}
+    now := time.Now()
+    for _, field := range r.schema.Fields {
+        switch {
+        case field.AutoUpdateTime > 0:
+            if err := field.Set(ctx, value, now); err != nil {
+                return err
+            }
+        case field.AutoCreateTime > 0:
+            immutable = append(immutable, bsonName(field))
+        }
+    }
+    update, err := mongoSetFields(entity, immutable...)
+    if err != nil {
+        return err
+    }
+    result, err := r.collection().UpdateOne(r.m.sessionContext(ctx), filter, bson.M{"$set": update})
+    if err == nil && result.MatchedCount == 0 && r.schema.version != nil {
+        err = r.missing(ctx, id)
+    }
+    return wrapError(err)
+}
+
+// patchUpdate builds the filter and update of a Patch, and returns the
+// version it expects
+func (r *mongoRepository[T]) patchUpdate(id interface{}, changes map[string]interface{}) (bson.M, bson.M, interface{}) {
+    expected, changes := r.schema.expectedVersion(changes)
+    filter := r.byID(id)
+    update := bson.M{}
+    if r.schema.version != nil {
+        update["$inc"] = bson.M{bsonName(r.schema.version): 1}
+        if expected != nil {
+            filter[bsonName(r.schema.version)] = expected
+        }
+    }
+    set := bson.M{}
+    for column, value := range changes {
+        set[column] = value
+    }
+    now := time.Now()
+    for _, field := range r.schema.Fields {
+        if _, ok := set[field.DBName]; field.AutoUpdateTime > 0 && !ok {
+            set[field.DBName] = now
+        }
+    }
+    update["$set"] = set
+    return r.scope(filter, false), update, expected
+}
+
+func (r *mongoRepository[T]) Patch(ctx context.Context, id interface{}, changes map[string]interface{}) error {
+    filter, update, expected := r.patchUpdate(id, changes)
+    result, err := r.collection().UpdateOne(r.m.sessionContext(ctx), filter, update)
+    if err == nil && result.MatchedCount == 0 {
+        if expected != nil {
+            return r.missing(ctx, id)
+        }
+        return ErrNotFound
+    }
+    return wrapError(err)
+}
+
+// deleteModel is the write that deletes the entity id, if it is still at the
+// expected version when that is not nil
+func (r *mongoRepository[T]) deleteModel(id, expected interface{}) mongo.WriteModel {
+    filter := r.byID(id)
+    if expected != nil && r.schema.version != nil {
+        filter[bsonName(r.schema.version)] = expected
+    }
+    if !r.schema.softDelete {
+        return mongo.NewDeleteOneModel().SetFilter(filter)
+    }
+    now := time.Now()
+    set := bson.M{"deleted_at": now}
+    if r.schema.LookUpField("updated_at") != nil {
+        set["updated_at"] = now
+    }
+    update := bson.M{"$set": set}
+    if r.schema.version != nil {
+        update["$inc"] = bson.M{bsonName(r.schema.version): 1}
+    }
+    return mongo.NewUpdateOneModel().SetFilter(r.scope(filter, false)).SetUpdate(update)
+}
+
+func (r *mongoRepository[T]) Delete(ctx context.Context, id interface{}) error {
+    result, err := r.collection().BulkWrite(r.m.sessionContext(ctx), []mongo.WriteModel{r.deleteModel(id, nil)})
+    if err == nil && result.MatchedCount+result.DeletedCount == 0 {
+        return ErrNotFound
+    }
+    return wrapError(err)
+}
+
+func (r *mongoRepository[T]) Count(ctx context.Context, opts ListOptions) (int64, error) {
+    filter := r.scope(mongoFilter(opts.Filters, opts.Where), opts.IncludeDeleted)
+    total, err := r.collection().CountDocuments(r.m.sessionContext(ctx), filter)
+    return total, wrapError(err)
+}
+
+func (r *mongoRepository[T]) GetMany(ctx context.Context, ids []interface{}) ([]T, error) {
+    ctx = r.m.sessionContext(ctx)
+    filter := r.scope(bson.M{bsonName(r.schema.primaryKey): bson.M{"$in": ids}}, false)
+    cursor, err := r.collection().Find(ctx, filter)
+    if err != nil {
+        return nil, wrapError(err)
+    }
+    entities := []T{}
+    err = cursor.All(ctx, &entities)
+    return entities, wrapError(err)
+}
+
+func (r *mongoRepository[T]) CreateMany(ctx context.Context, entities []*T) []error {
+    errs := make([]error, len(entities))
+    if len(entities) == 0 {
+        return errs
+    }
+    if err := r.prepare(ctx, entities); err != nil {
+        return fill(errs, err)
+    }
+    docs := make([]interface{}, len(entities))
+    for i, entity := range entities {
+        docs[i] = entity
+    }
+    _, err := r.collection().InsertMany(r.m.sessionContext(ctx), docs, options.InsertMany().SetOrdered(false))
+    if err != nil && !writeErrors(err, errs) {
+        fill(errs, wrapError(err))
+    }
+    return errs
+}
+
+func (r *mongoRepository[T]) PatchMany(ctx context.Context, items []BulkItem) []error {
+    errs := make([]error, len(items))
+    if len(items) == 0 {
+        return errs
+    }
+    writes := make([]mongo.WriteModel, len(items))
+    for i, item := range items {
+        filter, update, _ := r.patchUpdate(item.ID, item.columns(r.schema))
+        writes[i] = mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update)
+    }
+    result, err := r.collection().BulkWrite(r.m.sessionContext(ctx), writes, options.BulkWrite().SetOrdered(false))
+    if err != nil && !writeErrors(err, errs) {
+        return fill(errs, wrapError(err))
+    }
+    if result != nil && int(result.MatchedCount) < pending(errs) {
+        err = r.settle(ctx, items, errs, func(item BulkItem, doc bson.M) error {
+            expected, _ := r.schema.expectedVersion(item.columns(r.schema))
+            switch {
+            case doc == nil:
+                return ErrNotFound
+            case expected != nil && nextVersion(doc[bsonName(r.schema.version)]) != nextVersion(expected)+1:
+                return ErrStale
+            }
+            return nil
+        })
+        if err != nil {
+            return fill(errs, err)
+        }
+    }
+    return errs
+}
+
+func (r *mongoRepository[T]) DeleteMany(ctx context.Context, items []BulkItem) []error {
+    errs := make([]error, len(items))
+    // A deleted document looks the same as one that never existed, so the
+    // missing ones are found before writing
+    err := r.settle(ctx, items, errs, func(item BulkItem, doc bson.M) error {
+        if doc == nil {
+            return ErrNotFound
+        }
+        return nil
+    })
+    if err != nil {
+        return fill(errs, err)
+    }
+    var writes []mongo.WriteModel
+    for i, item := range items {
+        if errs[i] == nil {
+            writes = append(writes, r.deleteModel(item.ID, item.Version))
+        }
+    }
+    if len(writes) == 0 {
+        return errs
+    }
+    // writeErrors indexes into the writes sent, which skip the missing items
+    sent := make([]error, len(writes))
+    result, err := r.collection().BulkWrite(r.m.sessionContext(ctx), writes, options.BulkWrite().SetOrdered(false))
+    if err != nil && !writeErrors(err, sent) {
+        sent = fill(sent, wrapError(err))
+    }
+    for i, j := 0, 0; i < len(items); i++ {
+        if errs[i] == nil {
+            errs[i] = sent[j]
+            j++
+        }
+    }
+    if result != nil && int(result.MatchedCount+result.DeletedCount) < pending(sent) {
+        // Still there after the write means the version did not match
+        err = r.settle(ctx, items, errs, func(item BulkItem, doc bson.M) error {
+            if doc != nil {
+                return ErrStale
+            }
+            return nil
+        })
+        if err != nil {
+            return fill(errs, err)
+        }
+    }
+    return errs
+}
+
+// settle sets the error of each item that has none yet from the stored
+// document with its ID, or nil if there is none. BulkWrite only counts the
+// documents its writes matched, so this is how the ones that matched nothing
+// are found.
+func (r *mongoRepository[T]) settle(ctx context.Context, items []BulkItem, errs []error, check func(item BulkItem, doc bson.M) error) error {
+    ctx = r.m.sessionContext(ctx)
+    key := bsonName(r.schema.primaryKey)
+    var ids []interface{}
+    for i, item := range items {
+        if errs[i] == nil {
+            ids = append(ids, item.ID)
+        }
+    }
+    docs := map[string]bson.M{}
+    if len(ids) > 0 {
+        projection := bson.M{key: 1}
+        if r.schema.version != nil {
+            projection[bsonName(r.schema.version)] = 1
+        }
+        filter := r.scope(bson.M{key: bson.M{"$in": ids}}, false)
+        cursor, err := r.collection().Find(ctx, filter, options.Find().SetProjection(projection))
+        if err != nil {
+            return wrapError(err)
+        }
+        var found []bson.M
+        if err := cursor.All(ctx, &found); err != nil {
+            return wrapError(err)
+        }
+        for _, doc := range found {
+            docs[keyOf(doc[key])] = doc
+        }
+    }
+    for i, item := range items {
+        if errs[i] == nil {
+            errs[i] = check(item, docs[keyOf(item.ID)])
+        }
+    }
+    return nil
+}
+
+// pending counts the items without an error
+func pending(errs []error) int {
+    n := 0
+    for _, err := range errs {
+        if err == nil {
+            n++
+        }
+    }
+    return n
+}
+
+// writeErrors spreads the write errors of an unordered InsertMany or
+// BulkWrite over the items they belong to. It returns false for any other
+// error, which concerns every item.
+func writeErrors(err error, errs []error) bool {
+    var bulkErr mongo.BulkWriteException
+    if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+        return false
+    }
+    for _, writeErr := range bulkErr.WriteErrors {
+        if writeErr.Index >= 0 && writeErr.Index < len(errs) {
+            errs[writeErr.Index] = wrapError(mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{writeErr}})
+        }
+    }
+    return true
+}
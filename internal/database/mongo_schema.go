@@ -0,0 +1,138 @@
+package database
+
+import (
+    "context"
+    "errors"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// caseInsensitive matches the collation GetUserByEmail queries with, so the
+// unique email index also serves those lookups
+var caseInsensitive = &options.Collation{Locale: "en", Strength: 2}
+
+// mongoIndexes mirrors the indexes the SQL migrations create
+var mongoIndexes = map[string][]mongo.IndexModel{
+    "users": {
+        {Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetName("uni_users_id").SetUnique(true)},
+        {Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetName("uni_users_email").SetUnique(true).SetCollation(caseInsensitive)},
+        {Keys: bson.D{{Key: "deleted_at", Value: 1}}, Options: options.Index().SetName("idx_users_deleted_at")},
+        {Keys: bson.D{{Key: "name", Value: "text"}, {Key: "email", Value: "text"}}, Options: options.Index().SetName("users_search")},
+    },
+    "login_attempts": {
+        {Keys: bson.D{{Key: "scope", Value: 1}, {Key: "identifier", Value: 1}}, Options: options.Index().SetName("idx_login_attempts_scope_identifier").SetUnique(true)},
+    },
+    "idempotency_records": {
+        {Keys: bson.D{{Key: "scope", Value: 1}, {Key: "key", Value: 1}}, Options: options.Index().SetName("idx_idempotency_records_scope_key").SetUnique(true)},
+        {Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetName("idx_idempotency_records_expires_at")},
+    },
+    "identities": {
+        {Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetName("uni_identities_id").SetUnique(true)},
+        {Keys: bson.D{{Key: "user_id", Value: 1}}, Options: options.Index().SetName("idx_identities_user_id")},
+        {Keys: bson.D{{Key: "provider", Value: 1}, {Key: "subject", Value: 1}}, Options: options.Index().SetName("idx_identities_provider_subject").SetUnique(true)},
+    },
+    "audit_entries": {
+        {Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetName("uni_audit_entries_id").SetUnique(true)},
+        {Keys: bson.D{{Key: "action", Value: 1}}, Options: options.Index().SetName("idx_audit_entries_action")},
+        {Keys: bson.D{{Key: "actor_id", Value: 1}}, Options: options.Index().SetName("idx_audit_entries_actor_id")},
+        {Keys: bson.D{{Key: "impersonator_id", Value: 1}}, Options: options.Index().SetName("idx_audit_entries_impersonator_id")},
+        {Keys: bson.D{{Key: "resource_id", Value: 1}}, Options: options.Index().SetName("idx_audit_entries_resource_id")},
+        {Keys: bson.D{{Key: "created_at", Value: 1}}, Options: options.Index().SetName("idx_audit_entries_created_at")},
+    },
+    "outbox_events": {
+        {Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetName("uni_outbox_events_id").SetUnique(true)},
+        {Keys: bson.D{{Key: "dispatched_at", Value: 1}}, Options: options.Index().SetName("idx_outbox_events_dispatched_at")},
+    },
+    "webhooks": {
+        {Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetName("uni_webhooks_id").SetUnique(true)},
+    },
+    "webhook_deliveries": {
+        {Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetName("uni_webhook_deliveries_id").SetUnique(true)},
+        {Keys: bson.D{{Key: "webhook_id", Value: 1}}, Options: options.Index().SetName("idx_webhook_deliveries_webhook_id")},
+        {Keys: bson.D{{Key: "event_id", Value: 1}}, Options: options.Index().SetName("idx_webhook_deliveries_event_id")},
+        {Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}, Options: options.Index().SetName("idx_webhook_deliveries_status_next_attempt_at")},
+    },
+}
+
+// mongoValidators are $jsonSchema validators matching the SQL column types
+var mongoValidators = map[string]bson.M{
+    "users": {"$jsonSchema": bson.M{
+        "bsonType": "object",
+        "required": bson.A{"id", "name", "email", "role", "created_at", "updated_at"},
+        "properties": bson.M{
+            "id":            bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 1},
+            "name":          bson.M{"bsonType": "string", "maxLength": 100},
+            "email":         bson.M{"bsonType": "string", "maxLength": 100},
+            "role":          bson.M{"enum": bson.A{"user", "admin"}},
+            "password_hash": bson.M{"bsonType": "string", "maxLength": 255},
+            "created_at":    bson.M{"bsonType": "date"},
+            "updated_at":    bson.M{"bsonType": "date"},
+            "deleted_at":    bson.M{"bsonType": bson.A{"date", "null"}},
+            "version":       bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 1},
+        },
+    }},
+}
+
+// ensureSchema creates the collections with their validators and indexes, the
+// MongoDB counterpart of the SQL migrations. It is safe to run on every start.
+func (m *MongoDB) ensureSchema(ctx context.Context) error {
+    for name, validator := range mongoValidators {
+        err := m.db.CreateCollection(ctx, name, options.CreateCollection().SetValidator(validator))
+        var commandErr mongo.CommandError
+        if errors.As(err, &commandErr) && commandErr.Name == "NamespaceExists" {
+            err = m.db.RunCommand(ctx, bson.D{{Key: "collMod", Value: name}, {Key: "validator", Value: validator}}).Err()
+        }
+        if err != nil {
+            return err
+        }
+    }
+    for name, indexes := range mongoIndexes {
+        if _, err := m.db.Collection(name).Indexes().CreateMany(ctx, indexes); err != nil {
+            return err
+        }
+    }
+    // Users stored before versioning start at version 1, as the SQL column default does
+    _, err := m.db.Collection("users").UpdateMany(ctx, bson.M{"version": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"version": 1}})
+    return err
+}
+
+// nextID atomically takes the next value of a sequence kept in the counters
+// collection. Inside a transaction the increment is part of it, so a rolled
+// back insert gives its ID back, and of concurrent transactions that take
+// from the same sequence all but one fail with a write conflict.
+func (m *MongoDB) nextID(ctx context.Context, sequence string) (uint, error) {
+    return m.reserveIDs(ctx, sequence, 1)
+}
+
+// reserveIDs takes n consecutive values of a sequence in one round trip and
+// returns the first
+func (m *MongoDB) reserveIDs(ctx context.Context, sequence string, n int) (uint, error) {
+    counters := m.db.Collection("counters")
+    var counter struct {
+        Seq int64 `bson:"seq"`
+    }
+    err := counters.FindOneAndUpdate(m.sessionContext(ctx),
+        bson.M{"_id": sequence},
+        bson.M{"$inc": bson.M{"seq": n}},
+        options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+    ).Decode(&counter)
+    return uint(counter.Seq) - uint(n) + 1, err
+}
+
+// mongoSetFields encodes doc for a $set update, leaving out the given fields
+// that must not change once a document is created
+func mongoSetFields(doc interface{}, immutable ...string) (bson.M, error) {
+    data, err := bson.Marshal(doc)
+    if err != nil {
+        return nil, err
+    }
+    fields := bson.M{}
+    if err := bson.Unmarshal(data, &fields); err != nil {
+        return nil, err
+    }
+    for _, name := range immutable {
+        delete(fields, name)
+    }
+    return fields, nil
+}
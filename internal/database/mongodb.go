@@ -3,72 +3,622 @@ package database
 import (
     "context"
     "fmt"
+    "log"
     "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/mongo"
     "go.mongodb.org/mongo-driver/mongo/options"
+    "go.mongodb.org/mongo-driver/mongo/readpref"
+    "go.mongodb.org/mongo-driver/mongo/writeconcern"
     "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "strconv"
+    "strings"
+    "time"
 )
 
 type MongoDB struct {
-    client *mongo.Client
-    db     *mongo.Database
+    client  *mongo.Client
+    db      *mongo.Database
+    session mongo.Session
+    options *options.ClientOptions
+    dbName  string
+    timeout time.Duration
+    // transactions is whether the server is a replica set member or mongos
+    transactions bool
+}
+
+func init() {
+    Register("mongodb", func(config Config) (Database, error) {
+        db, err := NewMongoDB(config)
+        if err != nil {
+            return nil, err
+        }
+        return db, nil
+    })
 }
 
 func NewMongoDB(config Config) (*MongoDB, error) {
-    uri := fmt.Sprintf("mongodb://%s:%s", config.Host, config.Port)
-    client, err := mongo.NewClient(options.Client().ApplyURI(uri))
+    opts, err := mongoClientOptions(config)
     if err != nil {
         return nil, err
     }
-    return &MongoDB{client: client, db: client.Database(config.DBName)}, nil
+    timeout := config.ConnectTimeout
+    if timeout <= 0 {
+        timeout = DefaultConnectTimeout
+    }
+    opts.SetConnectTimeout(timeout).SetServerSelectionTimeout(timeout)
+    return &MongoDB{options: opts, dbName: config.DBName, timeout: timeout}, nil
 }
 
+// mongoClientOptions starts from config.URI, or builds one from the host and
+// port, and layers the structured options on top
+func mongoClientOptions(config Config) (*options.ClientOptions, error) {
+    uri := config.URI
+    if uri == "" {
+        uri = fmt.Sprintf("mongodb://%s:%s", config.Host, config.Port)
+    }
+    opts := options.Client().ApplyURI(uri)
+    if (config.URI == "" && config.User != "") || config.AuthSource != "" || config.AuthMechanism != "" {
+        credential := options.Credential{}
+        if opts.Auth != nil {
+            credential = *opts.Auth
+        }
+        if config.URI == "" {
+            credential.Username, credential.Password = config.User, config.Password
+        }
+        if config.AuthSource != "" {
+            credential.AuthSource = config.AuthSource
+        }
+        if config.AuthMechanism != "" {
+            credential.AuthMechanism = config.AuthMechanism
+        }
+        opts.SetAuth(credential)
+    }
+    if config.ReplicaSet != "" {
+        opts.SetReplicaSet(config.ReplicaSet)
+    }
+    tlsConfig, err := config.TLS.Build()
+    if err != nil {
+        return nil, err
+    }
+    if tlsConfig != nil {
+        opts.SetTLSConfig(tlsConfig)
+    }
+    if config.ReadPreference != "" {
+        mode, err := readpref.ModeFromString(config.ReadPreference)
+        if err != nil {
+            return nil, err
+        }
+        pref, err := readpref.New(mode)
+        if err != nil {
+            return nil, err
+        }
+        opts.SetReadPreference(pref)
+    }
+    if config.WriteConcern != "" {
+        if config.WriteConcern == "majority" {
+            opts.SetWriteConcern(writeconcern.Majority())
+        } else {
+            w, err := strconv.Atoi(config.WriteConcern)
+            if err != nil || w < 0 {
+                return nil, fmt.Errorf("invalid write concern %q", config.WriteConcern)
+            }
+            opts.SetWriteConcern(&writeconcern.WriteConcern{W: w})
+        }
+    }
+    if config.MaxPoolSize > 0 {
+        opts.SetMaxPoolSize(config.MaxPoolSize)
+    }
+    if config.MinPoolSize > 0 {
+        opts.SetMinPoolSize(config.MinPoolSize)
+    }
+    return opts, opts.Validate()
+}
+
+// Connect connects and pings the server, failing once the connect timeout
+// passes, then sets up the collections
 func (m *MongoDB) Connect() error {
-    return m.client.Connect(context.Background())
+    ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+    defer cancel()
+    client, err := mongo.Connect(ctx, m.options)
+    if err != nil {
+        return wrapError(err)
+    }
+    if err := client.Ping(ctx, nil); err != nil {
+        client.Disconnect(context.Background())
+        return wrapError(err)
+    }
+    m.client, m.db = client, client.Database(m.dbName)
+    if m.transactions, err = m.supportsTransactions(ctx); err != nil {
+        client.Disconnect(context.Background())
+        return wrapError(err)
+    }
+    if !m.transactions {
+        log.Printf("MongoDB: standalone server without transactions, audited writes are not atomic and WithTx fails")
+    }
+    return wrapError(m.ensureSchema(ctx))
+}
+
+// supportsTransactions asks the server with hello whether it is a replica set
+// member or a mongos router, the deployments that run transactions
+func (m *MongoDB) supportsTransactions(ctx context.Context) (bool, error) {
+    var hello struct {
+        SetName string `bson:"setName"`
+        Msg     string `bson:"msg"`
+    }
+    if err := m.client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+        return false, err
+    }
+    return hello.SetName != "" || hello.Msg == "isdbgrid", nil
+}
+
+func (m *MongoDB) supportsTx() bool {
+    return m.transactions
 }
 
 func (m *MongoDB) Close() error {
-    return m.client.Disconnect(context.Background())
+    if m.client == nil {
+        return nil
+    }
+    return wrapError(m.client.Disconnect(context.Background()))
+}
+
+// WithTx runs fn in a multi-document transaction. MongoDB only supports
+// transactions on replica sets and sharded clusters. fn runs once: unlike
+// session.WithTransaction, a transient error is not retried, since fn may
+// have effects outside the database, such as a written response.
+func (m *MongoDB) WithTx(ctx context.Context, fn func(tx Database) error) error {
+    if m.session != nil {
+        return fn(m)
+    }
+    if !m.transactions {
+        return ErrTxUnsupported
+    }
+    session, err := m.client.StartSession()
+    if err != nil {
+        return wrapError(err)
+    }
+    defer session.EndSession(ctx)
+    if err := session.StartTransaction(); err != nil {
+        return wrapError(err)
+    }
+    tx := *m
+    tx.session = session
+    if err := fn(&tx); err != nil {
+        session.AbortTransaction(context.Background())
+        return err
+    }
+    return wrapError(session.CommitTransaction(ctx))
+}
+
+// users is the repository the user methods are implemented with
+func (m *MongoDB) users() (Repository[models.User], error) {
+    return newMongoRepository[models.User](m)
+}
+
+// sessionContext binds operations to the transaction's session, if any
+func (m *MongoDB) sessionContext(ctx context.Context) context.Context {
+    if m.session == nil {
+        return ctx
+    }
+    return mongo.NewSessionContext(ctx, m.session)
 }
 
 func (m *MongoDB) CreateUser(ctx context.Context, user *models.User) error {
-    collection := m.db.Collection("users")
-    _, err := collection.InsertOne(ctx, user.UserSchema)
-    return err
+    users, err := m.users()
+    if err != nil {
+        return err
+    }
+    return users.Create(ctx, user)
 }
 
 func (m *MongoDB) GetUserByID(ctx context.Context, id uint) (*models.User, error) {
-    collection := m.db.Collection("users")
-    var user models.User
-    err := collection.FindOne(ctx, bson.M{"id": id}).Decode(&user.UserSchema)
-    return &user, err
+    users, err := m.users()
+    if err != nil {
+        return nil, err
+    }
+    return users.Get(ctx, id)
 }
 
 func (m *MongoDB) GetAllUsers(ctx context.Context) ([]models.User, error) {
+    ctx = m.sessionContext(ctx)
     collection := m.db.Collection("users")
-    cursor, err := collection.Find(ctx, bson.M{})
+    cursor, err := collection.Find(ctx, bson.M{"deleted_at": nil})
     if err != nil {
-        return nil, err
+        return nil, wrapError(err)
     }
     var users []models.User
     for cursor.Next(ctx) {
         var user models.User
         if err := cursor.Decode(&user.UserSchema); err != nil {
-            return nil, err
+            return nil, wrapError(err)
         }
         users = append(users, user)
     }
     return users, nil
 }
 
+func (m *MongoDB) ListUsers(ctx context.Context, opts ListOptions) ([]models.User, int64, error) {
+    users, err := m.users()
+    if err != nil {
+        return nil, 0, err
+    }
+    return users.List(ctx, opts)
+}
+
+// SearchUsers uses the users text index. Unlike the SQL backends, MongoDB text
+// search matches whole words rather than prefixes.
+func (m *MongoDB) SearchUsers(ctx context.Context, query string, opts ListOptions) ([]models.User, int64, error) {
+    ctx = m.sessionContext(ctx)
+    if err := opts.Validate(); err != nil {
+        return nil, 0, wrapError(err)
+    }
+    if opts.Cursor != nil {
+        return nil, 0, fmt.Errorf("search results cannot be paged with cursors")
+    }
+    terms := searchTerms(query)
+    if len(terms) == 0 {
+        return nil, 0, ErrEmptySearch
+    }
+    collection := m.db.Collection("users")
+    conditions := bson.A{
+        bson.M{"$text": bson.M{"$search": strings.Join(terms, " ")}},
+        mongoFilter(opts.Filters, opts.Where),
+    }
+    if !opts.IncludeDeleted {
+        conditions = append(conditions, bson.M{"deleted_at": nil})
+    }
+    filter := bson.M{"$and": conditions}
+    total, err := collection.CountDocuments(ctx, filter)
+    if err != nil {
+        return nil, 0, wrapError(err)
+    }
+    findOptions := mongoFindOptions(opts, opts.OrderBy("id"), nil)
+    findOptions.SetSort(append(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}}, findOptions.Sort.(bson.D)...))
+    cursor, err := collection.Find(ctx, filter, findOptions)
+    if err != nil {
+        return nil, 0, wrapError(err)
+    }
+    defer cursor.Close(ctx)
+    users := []models.User{}
+    for cursor.Next(ctx) {
+        var user models.User
+        if err := cursor.Decode(&user.UserSchema); err != nil {
+            return nil, 0, wrapError(err)
+        }
+        users = append(users, user)
+    }
+    return users, total, wrapError(cursor.Err())
+}
+
 func (m *MongoDB) UpdateUser(ctx context.Context, user *models.User) error {
+    users, err := m.users()
+    if err != nil {
+        return err
+    }
+    return users.Update(ctx, user)
+}
+
+func (m *MongoDB) PatchUser(ctx context.Context, id uint, changes map[string]interface{}) error {
+    users, err := m.users()
+    if err != nil {
+        return err
+    }
+    return users.Patch(ctx, id, changes)
+}
+
+// DeleteUser soft deletes a user, see PurgeUser for removing it for good
+func (m *MongoDB) DeleteUser(ctx context.Context, id uint, version uint) error {
+    users, err := m.users()
+    if err != nil {
+        return err
+    }
+    if version == 0 {
+        return users.Delete(ctx, id)
+    }
+    return users.DeleteMany(ctx, []BulkItem{{ID: id, Version: version}})[0]
+}
+
+func (m *MongoDB) GetUsersByIDs(ctx context.Context, ids []uint) ([]models.User, error) {
+    users, err := m.users()
+    if err != nil {
+        return nil, err
+    }
+    keys := make([]interface{}, len(ids))
+    for i, id := range ids {
+        keys[i] = id
+    }
+    return users.GetMany(ctx, keys)
+}
+
+func (m *MongoDB) CreateUsers(ctx context.Context, batch []*models.User) []error {
+    users, err := m.users()
+    if err != nil {
+        return fill(make([]error, len(batch)), err)
+    }
+    return users.CreateMany(ctx, batch)
+}
+
+func (m *MongoDB) PatchUsers(ctx context.Context, items []BulkItem) []error {
+    users, err := m.users()
+    if err != nil {
+        return fill(make([]error, len(items)), err)
+    }
+    return users.PatchMany(ctx, items)
+}
+
+func (m *MongoDB) DeleteUsers(ctx context.Context, items []BulkItem) []error {
+    users, err := m.users()
+    if err != nil {
+        return fill(make([]error, len(items)), err)
+    }
+    return users.DeleteMany(ctx, items)
+}
+
+func (m *MongoDB) RestoreUser(ctx context.Context, id uint) error {
+    ctx = m.sessionContext(ctx)
     collection := m.db.Collection("users")
-    _, err := collection.UpdateOne(ctx, bson.M{"id": user.ID}, bson.M{"$set": user.UserSchema})
-    return err
+    result, err := collection.UpdateOne(ctx,
+        bson.M{"id": id, "deleted_at": bson.M{"$ne": nil}},
+        bson.M{"$set": bson.M{"deleted_at": nil, "updated_at": time.Now()}, "$inc": bson.M{"version": 1}})
+    if err == nil && result.MatchedCount == 0 {
+        return ErrNotFound
+    }
+    return wrapError(err)
 }
 
-func (m *MongoDB) DeleteUser(ctx context.Context, id uint) error {
+// UpsertUserByEmail updates with upsert: true. The ID is only used when the
+// user is inserted, but it is reserved either way.
+func (m *MongoDB) UpsertUserByEmail(ctx context.Context, user *models.User) (bool, error) {
+    id, err := m.nextID(ctx, "users")
+    if err != nil {
+        return false, wrapError(err)
+    }
+    ctx = m.sessionContext(ctx)
     collection := m.db.Collection("users")
-    _, err := collection.DeleteOne(ctx, bson.M{"id": id})
-    return err
+    now := time.Now()
+    set := bson.M{"name": user.Name, "updated_at": now, "deleted_at": nil}
+    insert := bson.M{"id": id, "created_at": now}
+    if user.Role != "" {
+        set["role"] = user.Role
+    } else {
+        insert["role"] = models.RoleUser
+    }
+    if user.PasswordHash != "" {
+        set["password_hash"] = user.PasswordHash
+    }
+    // $inc creates the version as 1 on insert
+    update := bson.M{"$set": set, "$setOnInsert": insert, "$inc": bson.M{"version": 1}}
+    opts := options.Update().SetUpsert(true).SetCollation(caseInsensitive)
+    result, err := collection.UpdateOne(ctx, bson.M{"email": user.Email}, update, opts)
+    if err != nil {
+        return false, wrapError(err)
+    }
+    var saved models.User
+    err = collection.FindOne(ctx, bson.M{"email": user.Email}, options.FindOne().SetCollation(caseInsensitive)).Decode(&saved.UserSchema)
+    if err != nil {
+        return false, wrapError(err)
+    }
+    *user = saved
+    return result.UpsertedCount == 1, nil
+}
+
+// PurgeUser removes the user before its identities, so that a stale version
+// leaves both in place outside a transaction too
+func (m *MongoDB) PurgeUser(ctx context.Context, id uint, version uint) error {
+    ctx = m.sessionContext(ctx)
+    users := m.db.Collection("users")
+    filter := bson.M{"id": id}
+    if version != 0 {
+        filter["version"] = version
+    }
+    result, err := users.DeleteOne(ctx, filter)
+    if err != nil {
+        return wrapError(err)
+    }
+    if result.DeletedCount == 0 {
+        if version == 0 {
+            return ErrNotFound
+        }
+        count, err := users.CountDocuments(ctx, bson.M{"id": id})
+        if err != nil {
+            return wrapError(err)
+        }
+        if count > 0 {
+            return ErrStale
+        }
+        return ErrNotFound
+    }
+    _, err = m.db.Collection("identities").DeleteMany(ctx, bson.M{"user_id": id})
+    return wrapError(err)
+}
+
+func (m *MongoDB) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+    ctx = m.sessionContext(ctx)
+    collection := m.db.Collection("users")
+    filter := bson.M{"deleted_at": bson.M{"$lt": before}}
+    ids, err := collection.Distinct(ctx, "id", filter)
+    if err != nil || len(ids) == 0 {
+        return 0, wrapError(err)
+    }
+    if _, err := m.db.Collection("identities").DeleteMany(ctx, bson.M{"user_id": bson.M{"$in": ids}}); err != nil {
+        return 0, wrapError(err)
+    }
+    result, err := collection.DeleteMany(ctx, bson.M{"id": bson.M{"$in": ids}, "deleted_at": bson.M{"$lt": before}})
+    if err != nil {
+        return 0, wrapError(err)
+    }
+    return result.DeletedCount, nil
+}
+
+func (m *MongoDB) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+    ctx = m.sessionContext(ctx)
+    collection := m.db.Collection("users")
+    var user models.User
+    opts := options.FindOne().SetCollation(caseInsensitive)
+    err := collection.FindOne(ctx, bson.M{"email": email, "deleted_at": nil}, opts).Decode(&user.UserSchema)
+    return &user, wrapError(err)
+}
+
+func (m *MongoDB) GetLoginAttempt(ctx context.Context, scope, identifier string) (*models.LoginAttempt, error) {
+    ctx = m.sessionContext(ctx)
+    collection := m.db.Collection("login_attempts")
+    attempt := models.LoginAttempt{Scope: scope, Identifier: identifier}
+    err := collection.FindOne(ctx, bson.M{"scope": scope, "identifier": identifier}).Decode(&attempt)
+    if err == mongo.ErrNoDocuments {
+        return &attempt, nil
+    }
+    return &attempt, wrapError(err)
+}
+
+// RecordLoginFailure increments the count with a pipeline upsert that returns
+// the new document. The block is raised with $max so that a slower request
+// with a lower count cannot shorten it.
+func (m *MongoDB) RecordLoginFailure(ctx context.Context, scope, identifier string, now, resetBefore time.Time, lock func(failures int) time.Duration) (*models.LoginAttempt, error) {
+    ctx = m.sessionContext(ctx)
+    collection := m.db.Collection("login_attempts")
+    filter := bson.M{"scope": scope, "identifier": identifier}
+    expired := bson.M{"$lt": bson.A{bson.M{"$ifNull": bson.A{"$last_failure_at", time.Time{}}}, resetBefore}}
+    count := bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$failures", 0}}, 1}}
+    update := bson.A{bson.M{"$set": bson.M{
+        "failures":        bson.M{"$cond": bson.A{expired, 1, count}},
+        "last_failure_at": now,
+        "updated_at":      now,
+    }}}
+    var attempt models.LoginAttempt
+    opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+    if err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&attempt); err != nil {
+        return nil, wrapError(err)
+    }
+    lockedUntil := now.Add(lock(attempt.Failures))
+    if _, err := collection.UpdateOne(ctx, filter, bson.M{"$max": bson.M{"locked_until": lockedUntil}}); err != nil {
+        return nil, wrapError(err)
+    }
+    attempt.LockedUntil = &lockedUntil
+    return &attempt, nil
+}
+
+func (m *MongoDB) DeleteLoginAttempt(ctx context.Context, scope, identifier string) error {
+    ctx = m.sessionContext(ctx)
+    collection := m.db.Collection("login_attempts")
+    _, err := collection.DeleteOne(ctx, bson.M{"scope": scope, "identifier": identifier})
+    return wrapError(err)
+}
+
+func (m *MongoDB) CreateIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+    ctx = m.sessionContext(ctx)
+    collection := m.db.Collection("idempotency_records")
+    record.CreatedAt = time.Now()
+    _, err := collection.InsertOne(ctx, record)
+    return wrapError(err)
+}
+
+func (m *MongoDB) GetIdempotencyRecord(ctx context.Context, scope, key string) (*models.IdempotencyRecord, error) {
+    ctx = m.sessionContext(ctx)
+    collection := m.db.Collection("idempotency_records")
+    var record models.IdempotencyRecord
+    err := collection.FindOne(ctx, bson.M{"scope": scope, "key": key}).Decode(&record)
+    return &record, wrapError(err)
+}
+
+func (m *MongoDB) SaveIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+    ctx = m.sessionContext(ctx)
+    collection := m.db.Collection("idempotency_records")
+    filter := bson.M{"scope": record.Scope, "key": record.Key}
+    _, err := collection.UpdateOne(ctx, filter, bson.M{"$set": record}, options.Update().SetUpsert(true))
+    return wrapError(err)
+}
+
+func (m *MongoDB) DeleteIdempotencyRecord(ctx context.Context, scope, key string) error {
+    ctx = m.sessionContext(ctx)
+    collection := m.db.Collection("idempotency_records")
+    _, err := collection.DeleteOne(ctx, bson.M{"scope": scope, "key": key})
+    return wrapError(err)
+}
+
+func (m *MongoDB) PurgeIdempotencyRecords(ctx context.Context, before time.Time) (int64, error) {
+    ctx = m.sessionContext(ctx)
+    collection := m.db.Collection("idempotency_records")
+    result, err := collection.DeleteMany(ctx, bson.M{"expires_at": bson.M{"$lt": before}})
+    if err != nil {
+        return 0, wrapError(err)
+    }
+    return result.DeletedCount, nil
+}
+
+func (m *MongoDB) GetIdentity(ctx context.Context, provider, subject string) (*models.Identity, error) {
+    ctx = m.sessionContext(ctx)
+    collection := m.db.Collection("identities")
+    var identity models.Identity
+    err := collection.FindOne(ctx, bson.M{"provider": provider, "subject": subject}).Decode(&identity)
+    return &identity, wrapError(err)
+}
+
+func (m *MongoDB) CreateIdentity(ctx context.Context, identity *models.Identity) error {
+    if identity.ID == 0 {
+        id, err := m.nextID(ctx, "identities")
+        if err != nil {
+            return wrapError(err)
+        }
+        identity.ID = id
+    }
+    ctx = m.sessionContext(ctx)
+    collection := m.db.Collection("identities")
+    identity.CreatedAt = time.Now()
+    _, err := collection.InsertOne(ctx, identity)
+    return wrapError(err)
+}
+
+func (m *MongoDB) CreateAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+    if entry.ID == 0 {
+        id, err := m.nextID(ctx, "audit_entries")
+        if err != nil {
+            return wrapError(err)
+        }
+        entry.ID = id
+    }
+    ctx = m.sessionContext(ctx)
+    collection := m.db.Collection("audit_entries")
+    entry.CreatedAt = time.Now()
+    _, err := collection.InsertOne(ctx, entry)
+    return wrapError(err)
+}
+
+func (m *MongoDB) ListAuditEntries(ctx context.Context, opts ListOptions) ([]models.AuditEntry, int64, error) {
+    entries, err := newMongoRepository[models.AuditEntry](m)
+    if err != nil {
+        return nil, 0, err
+    }
+    return entries.List(ctx, opts)
+}
+
+func (m *MongoDB) snapshotUsers(ctx context.Context, ids []uint) ([]models.User, error) {
+    ctx = m.sessionContext(ctx)
+    cursor, err := m.db.Collection("users").Find(ctx, bson.M{"id": bson.M{"$in": ids}})
+    if err != nil {
+        return nil, wrapError(err)
+    }
+    defer cursor.Close(ctx)
+    var users []models.User
+    for cursor.Next(ctx) {
+        var user models.User
+        if err := cursor.Decode(&user.UserSchema); err != nil {
+            return nil, wrapError(err)
+        }
+        users = append(users, user)
+    }
+    return users, wrapError(cursor.Err())
+}
+
+func (m *MongoDB) snapshotUserByEmail(ctx context.Context, email string) (*models.User, error) {
+    ctx = m.sessionContext(ctx)
+    var user models.User
+    opts := options.FindOne().SetCollation(caseInsensitive)
+    err := m.db.Collection("users").FindOne(ctx, bson.M{"email": email}, opts).Decode(&user.UserSchema)
+    if err == mongo.ErrNoDocuments {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, wrapError(err)
+    }
+    return &user, nil
 }
\ No newline at end of file
@@ -0,0 +1,10 @@
+//go:build !cgo
+
+package database
+
+const cgoEnabled = false
+
+// cgoSQLiteCode never matches without cgo, as the cgo SQLite driver is a stub
+func cgoSQLiteCode(err error) (int, bool) {
+    return 0, false
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+    "sync"
+)
+
+// Factory creates a Database from its configuration. It should not connect;
+// NewApp calls Connect once the database is created.
+type Factory func(config Config) (Database, error)
+
+var (
+    factoriesMu sync.RWMutex
+    factories   = map[string]Factory{}
+)
+
+// Register makes a database type available to NewDatabase under name. Like
+// database/sql.Register it is meant to be called from init and panics when
+// the name is taken.
+func Register(name string, factory Factory) {
+    factoriesMu.Lock()
+    defer factoriesMu.Unlock()
+    if factory == nil {
+        panic("database: Register factory is nil")
+    }
+    if _, dup := factories[name]; dup {
+        panic("database: Register called twice for " + name)
+    }
+    factories[name] = factory
+}
+
+// Types returns the registered database types, sorted
+func Types() []string {
+    factoriesMu.RLock()
+    defer factoriesMu.RUnlock()
+    names := make([]string, 0, len(factories))
+    for name := range factories {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+func NewDatabase(config Config) (Database, error) {
+    factoriesMu.RLock()
+    factory, ok := factories[config.Type]
+    factoriesMu.RUnlock()
+    if !ok {
+        return nil, fmt.Errorf("unsupported database type %q, supported types: %s", config.Type, strings.Join(Types(), ", "))
+    }
+    return factory(config)
+}
@@ -0,0 +1,232 @@
+package database
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "gorm.io/gorm/schema"
+    "reflect"
+    "strings"
+    "sync"
+)
+
+// Repository stores one kind of model. It works for any struct gorm can map
+// that also has matching bson tags: every bson name must equal the gorm
+// column name so that list filters and sorts mean the same on every backend.
+// A model with a deleted_at column is soft deleted: Delete only marks it, and
+// Get, List and Count leave it out unless ListOptions.IncludeDeleted is set.
+// A model with a version column is versioned: every write increments the
+// version, and Update and Patch fail with ErrStale when the stored version is
+// not the one they expect.
+type Repository[T any] interface {
+    Create(ctx context.Context, entity *T) error
+    // Get returns ErrNotFound if there is no entity with the primary key id
+    Get(ctx context.Context, id interface{}) (*T, error)
+    // List returns a page of entities and the number matching the filters
+    List(ctx context.Context, opts ListOptions) ([]T, int64, error)
+    // Update writes every column of entity. On a versioned model it expects
+    // the version entity holds and leaves the new one in it.
+    Update(ctx context.Context, entity *T) error
+    // Patch writes only the given columns of the entity with the primary key
+    // id, along with its auto update times. On a versioned model a version
+    // entry is the version expected rather than a new value. See Changes.
+    Patch(ctx context.Context, id interface{}, changes map[string]interface{}) error
+    // Delete returns ErrNotFound if there is no entity with the primary key id
+    Delete(ctx context.Context, id interface{}) error
+    Count(ctx context.Context, opts ListOptions) (int64, error)
+
+    // GetMany returns the entities with the given primary keys, leaving out
+    // those that do not exist, in no particular order
+    GetMany(ctx context.Context, ids []interface{}) ([]T, error)
+    // CreateMany inserts entities in batches of BatchSize. The bulk methods
+    // return one error per entity or item, nil for those that were written;
+    // a failed item does not stop the others. Run them in WithTx and roll
+    // back on any error to write all or nothing.
+    CreateMany(ctx context.Context, entities []*T) []error
+    // PatchMany applies Patch to each item
+    PatchMany(ctx context.Context, items []BulkItem) []error
+    // DeleteMany applies Delete to each item
+    DeleteMany(ctx context.Context, items []BulkItem) []error
+}
+
+// BatchSize is the number of rows CreateMany sends per INSERT, and the number
+// of keys per IN list of the other bulk methods
+const BatchSize = 500
+
+// BulkItem names one entity of a PatchMany or DeleteMany
+type BulkItem struct {
+    ID interface{}
+    // Changes are the columns PatchMany writes, as for Patch
+    Changes map[string]interface{}
+    // Version, if not nil, is the version a versioned entity must be at, the
+    // same as a version entry in Changes
+    Version interface{}
+}
+
+// columns returns the changes of item with its expected version, if any
+func (item BulkItem) columns(s modelSchema) map[string]interface{} {
+    if item.Version == nil || s.version == nil {
+        return item.Changes
+    }
+    columns := make(map[string]interface{}, len(item.Changes)+1)
+    for column, value := range item.Changes {
+        columns[column] = value
+    }
+    columns[s.version.DBName] = item.Version
+    return columns
+}
+
+// keyOf makes primary keys comparable whatever Go type they were decoded as
+func keyOf(id interface{}) string {
+    if value := reflect.ValueOf(id); value.Kind() == reflect.Ptr && !value.IsNil() {
+        id = value.Elem().Interface()
+    }
+    return fmt.Sprint(id)
+}
+
+// chunks calls fn with the ranges of n items of at most BatchSize
+func chunks(n int, fn func(start, end int)) {
+    for start := 0; start < n; start += BatchSize {
+        end := start + BatchSize
+        if end > n {
+            end = n
+        }
+        fn(start, end)
+    }
+}
+
+// fill sets every error of errs to err
+func fill(errs []error, err error) []error {
+    for i := range errs {
+        errs[i] = err
+    }
+    return errs
+}
+
+// NewRepository returns a repository for T on db. Pass the Database given to
+// a WithTx callback to make the repository part of the transaction.
+func NewRepository[T any](db Database) (Repository[T], error) {
+    switch d := db.(type) {
+    case *auditedDatabase:
+        return NewRepository[T](d.Database)
+    case *GormDatabase:
+        return newGormRepository[T](d.db)
+    case *MongoDB:
+        return newMongoRepository[T](d)
+    }
+    return nil, fmt.Errorf("database type %T: %w", db, ErrNoRepositories)
+}
+
+// ErrNoRepositories is returned by NewRepository for a Database that is not
+// one of the built-in backends
+var ErrNoRepositories = errors.New("database does not support repositories")
+
+var schemaCache sync.Map
+
+// modelSchema describes how T is stored: its table, which is also the Mongo
+// collection, and its primary key, soft delete and version columns
+type modelSchema struct {
+    *schema.Schema
+    primaryKey *schema.Field
+    softDelete bool
+    version    *schema.Field
+}
+
+func parseModel[T any](naming schema.Namer) (modelSchema, error) {
+    var model T
+    s, err := schema.Parse(&model, &schemaCache, naming)
+    if err != nil {
+        return modelSchema{}, err
+    }
+    if s.PrioritizedPrimaryField == nil {
+        return modelSchema{}, fmt.Errorf("%s has no primary key", s.Name)
+    }
+    return modelSchema{
+        Schema:     s,
+        primaryKey: s.PrioritizedPrimaryField,
+        softDelete: s.LookUpField("deleted_at") != nil,
+        version:    s.LookUpField("version"),
+    }, nil
+}
+
+// bsonName returns the name the bson encoder stores field under
+func bsonName(field *schema.Field) string {
+    name, _, _ := strings.Cut(field.Tag.Get("bson"), ",")
+    if name == "" {
+        return strings.ToLower(field.Name)
+    }
+    return name
+}
+
+// primaryKeyOf returns the primary key value of entity
+func (s modelSchema) primaryKeyOf(ctx context.Context, entity interface{}) interface{} {
+    value, _ := s.primaryKey.ValueOf(ctx, reflect.ValueOf(entity))
+    return value
+}
+
+// expectedVersion splits the version a Patch expects from the columns it
+// writes. It returns a nil version when the model is not versioned or the
+// changes do not name one.
+func (s modelSchema) expectedVersion(changes map[string]interface{}) (interface{}, map[string]interface{}) {
+    if s.version == nil {
+        return nil, changes
+    }
+    columns := make(map[string]interface{}, len(changes))
+    for column, value := range changes {
+        columns[column] = value
+    }
+    expected := columns[s.version.DBName]
+    delete(columns, s.version.DBName)
+    return expected, columns
+}
+
+// nextVersion returns the version that follows a version column value
+func nextVersion(version interface{}) uint64 {
+    value := reflect.Indirect(reflect.ValueOf(version))
+    switch value.Kind() {
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        return value.Uint() + 1
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        return uint64(value.Int()) + 1
+    }
+    return 1
+}
+
+// VersionOf returns the version of entity, and false if T has no version
+// column
+func VersionOf[T any](entity *T) (uint64, bool) {
+    s, err := parseModel[T](schema.NamingStrategy{})
+    if err != nil || s.version == nil {
+        return 0, false
+    }
+    value, _ := s.version.ValueOf(context.Background(), reflect.ValueOf(entity))
+    return nextVersion(value) - 1, true
+}
+
+// Changes returns the columns whose values differ between before and after,
+// for Repository.Patch. The primary key is never included. For a versioned
+// model the version of before is added when anything changed, so that Patch
+// fails with ErrStale if the entity was written since before was read.
+func Changes[T any](before, after *T) (map[string]interface{}, error) {
+    s, err := parseModel[T](schema.NamingStrategy{})
+    if err != nil {
+        return nil, err
+    }
+    ctx := context.Background()
+    old, updated := reflect.ValueOf(before), reflect.ValueOf(after)
+    changes := map[string]interface{}{}
+    for _, field := range s.Fields {
+        if field.DBName == "" || field.PrimaryKey {
+            continue
+        }
+        oldValue, _ := field.ValueOf(ctx, old)
+        newValue, _ := field.ValueOf(ctx, updated)
+        if field != s.version && !reflect.DeepEqual(oldValue, newValue) {
+            changes[field.DBName] = newValue
+        }
+    }
+    if s.version != nil && len(changes) > 0 {
+        changes[s.version.DBName], _ = s.version.ValueOf(ctx, old)
+    }
+    return changes, nil
+}
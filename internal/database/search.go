@@ -0,0 +1,24 @@
+package database
+
+import (
+    "errors"
+    "strings"
+    "unicode"
+)
+
+var ErrEmptySearch = errors.New("search query has no words")
+
+const maxSearchTerms = 8
+
+// searchTerms splits a search query into lower case words the way the
+// full-text indexes split names and emails, so "jane@exa" finds
+// jane@example.com. Each word is matched as a prefix.
+func searchTerms(query string) []string {
+    terms := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+        return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+    })
+    if len(terms) > maxSearchTerms {
+        terms = terms[:maxSearchTerms]
+    }
+    return terms
+}
@@ -1,56 +1,39 @@
 package database
 
 import (
-    "context"
-    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "errors"
+    "fmt"
     "gorm.io/driver/sqlite"
     "gorm.io/gorm"
+    "log"
 )
 
-type SQLite struct {
-    db *gorm.DB
-}
-
-func NewSQLite(config Config) (*SQLite, error) {
-    db, err := gorm.Open(sqlite.Open(config.FilePath), &gorm.Config{})
-    if err != nil {
-        return nil, err
-    }
-    return &SQLite{db: db}, nil
-}
-
-func (s *SQLite) Connect() error {
-    return s.db.AutoMigrate(&models.User{})
-}
-
-func (s *SQLite) Close() error {
-    sqlDB, err := s.db.DB()
-    if err != nil {
-        return err
-    }
-    return sqlDB.Close()
-}
-
-func (s *SQLite) CreateUser(ctx context.Context, user *models.User) error {
-    return s.db.WithContext(ctx).Create(user).Error
-}
-
-func (s *SQLite) GetUserByID(ctx context.Context, id uint) (*models.User, error) {
-    var user models.User
-    err := s.db.WithContext(ctx).First(&user, id).Error
-    return &user, err
-}
-
-func (s *SQLite) GetAllUsers(ctx context.Context) ([]models.User, error) {
-    var users []models.User
-    err := s.db.WithContext(ctx).Find(&users).Error
-    return users, err
-}
+// CGO fallback policies, see Config.CGOFallback
+const (
+    CGOFallbackPure  = "pure"
+    CGOFallbackError = "error"
+)
 
-func (s *SQLite) UpdateUser(ctx context.Context, user *models.User) error {
-    return s.db.WithContext(ctx).Save(user).Error
+// ErrCGORequired is returned for the sqlite type in a binary built with
+// CGO_ENABLED=0 when the fallback policy is CGOFallbackError
+var ErrCGORequired = errors.New("database: the sqlite type needs a binary built with CGO_ENABLED=1, use sqlite-pure otherwise")
+
+var newSQLite = GormFactory(func(config Config) (gorm.Dialector, error) {
+    return sqlite.Open(sqliteDSN(config, true)), nil
+})
+
+func init() {
+    Register("sqlite", func(config Config) (Database, error) {
+        if cgoEnabled {
+            return newSQLite(config)
+        }
+        switch config.CGOFallback {
+        case "", CGOFallbackPure:
+            log.Printf("database: this binary was built without cgo, using the pure Go SQLite driver for %s", config.FilePath)
+            return newSQLitePure(config)
+        case CGOFallbackError:
+            return nil, ErrCGORequired
+        }
+        return nil, fmt.Errorf("invalid CGO fallback policy %q", config.CGOFallback)
+    })
 }
-
-func (s *SQLite) DeleteUser(ctx context.Context, id uint) error {
-    return s.db.WithContext(ctx).Delete(&models.User{}, id).Error
-}
\ No newline at end of file
@@ -0,0 +1,83 @@
+package database
+
+import (
+    "crypto/tls"
+    "crypto/x509"
+    "fmt"
+    "os"
+)
+
+// TLS modes, named after the PostgreSQL sslmode values
+const (
+    TLSDisable    = "disable"
+    TLSRequire    = "require"     // encrypt without verifying the server
+    TLSVerifyCA   = "verify-ca"   // verify the certificate chain but not the host name
+    TLSVerifyFull = "verify-full" // verify the chain and the host name
+)
+
+// EffectiveMode returns the configured mode; Enabled without a Mode means
+// verify-full
+func (c TLSConfig) EffectiveMode() string {
+    switch {
+    case c.Mode != "":
+        return c.Mode
+    case c.Enabled:
+        return TLSVerifyFull
+    }
+    return TLSDisable
+}
+
+// Build loads the configured certificates into a tls.Config. It returns nil
+// when TLS is disabled.
+func (c TLSConfig) Build() (*tls.Config, error) {
+    mode := c.EffectiveMode()
+    if mode == TLSDisable {
+        return nil, nil
+    }
+    config := &tls.Config{
+        ServerName:         c.ServerName,
+        InsecureSkipVerify: c.InsecureSkipVerify,
+        MinVersion:         tls.VersionTLS12,
+    }
+    if c.CAFile != "" {
+        pem, err := os.ReadFile(c.CAFile)
+        if err != nil {
+            return nil, fmt.Errorf("read TLS CA: %w", err)
+        }
+        pool := x509.NewCertPool()
+        if !pool.AppendCertsFromPEM(pem) {
+            return nil, fmt.Errorf("no certificates found in %s", c.CAFile)
+        }
+        config.RootCAs = pool
+    }
+    if c.CertFile != "" || c.KeyFile != "" {
+        cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+        if err != nil {
+            return nil, fmt.Errorf("load TLS client certificate: %w", err)
+        }
+        config.Certificates = []tls.Certificate{cert}
+    }
+    switch mode {
+    case TLSRequire:
+        config.InsecureSkipVerify = true
+    case TLSVerifyCA:
+        // Go verifies chain and host name together, so skip both and check
+        // the chain alone
+        config.InsecureSkipVerify = true
+        config.VerifyConnection = func(state tls.ConnectionState) error {
+            if len(state.PeerCertificates) == 0 {
+                return fmt.Errorf("server sent no certificate")
+            }
+            intermediates := x509.NewCertPool()
+            for _, cert := range state.PeerCertificates[1:] {
+                intermediates.AddCert(cert)
+            }
+            _, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{Roots: config.RootCAs, Intermediates: intermediates})
+            return err
+        }
+    case TLSVerifyFull:
+    default:
+        return nil, fmt.Errorf("invalid TLS mode %q", mode)
+    }
+    return config, nil
+}
@@ -4,10 +4,14 @@ import (
     "context"
     "encoding/json"
     "github.com/gorilla/mux"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/auth"
     "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/mailer"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
     "github.com/Mohammad007/GoExpressRestAPI/internal/utils"
     "log"
     "net/http"
+    "time"
 )
 
 type App struct {
@@ -15,8 +19,18 @@ type App struct {
     middlewares []func(http.HandlerFunc) http.HandlerFunc
     db          database.Database
     ctx         context.Context
+    auth        auth.Config
+    mailer      mailer.Mailer
+    // strictPreconditions requires If-Match on writes, see CheckPrecondition
+    strictPreconditions bool
+    // idempotencyTTL is how long responses to requests with an
+    // Idempotency-Key are kept for replay
+    idempotencyTTL time.Duration
 }
 
+// DefaultIdempotencyTTL is used until SetIdempotencyTTL is called
+const DefaultIdempotencyTTL = 24 * time.Hour
+
 type Response struct {
     w      http.ResponseWriter
     status int
@@ -27,9 +41,10 @@ func NewResponse(w http.ResponseWriter) *Response {
 }
 
 type Router struct {
-    app    *App
-    prefix string
-    mux    *mux.Router
+    app         *App
+    prefix      string
+    mux         *mux.Router
+    middlewares []func(http.HandlerFunc) http.HandlerFunc
 }
 
 func NewApp(dbConfig database.Config) (*App, error) {
@@ -42,10 +57,13 @@ func NewApp(dbConfig database.Config) (*App, error) {
     }
 
     return &App{
-        router:      mux.NewRouter(),
-        middlewares: []func(http.HandlerFunc) http.HandlerFunc{},
-        db:          db,
-        ctx:         context.Background(),
+        router:         mux.NewRouter(),
+        middlewares:    []func(http.HandlerFunc) http.HandlerFunc{},
+        db:             database.Audited(db, database.Actor{ID: models.AuditActorSystem}),
+        ctx:            context.Background(),
+        auth:           auth.DefaultConfig(),
+        mailer:         mailer.LogMailer{},
+        idempotencyTTL: DefaultIdempotencyTTL,
     }, nil
 }
 
@@ -62,6 +80,25 @@ func (app *App) Route(prefix string) *Router {
     }
 }
 
+// Use adds middleware to every route registered on the router afterwards.
+// Router middleware runs in the order it was added, inside the global middleware.
+func (r *Router) Use(middleware func(http.HandlerFunc) http.HandlerFunc) *Router {
+    r.middlewares = append(r.middlewares, middleware)
+    return r
+}
+
+// With returns a copy of the router that applies extra middleware to the routes
+// registered on it, e.g. router.With(middleware.RequireRole("admin")).POST(...)
+func (r *Router) With(middlewares ...func(http.HandlerFunc) http.HandlerFunc) *Router {
+    combined := append([]func(http.HandlerFunc) http.HandlerFunc{}, r.middlewares...)
+    return &Router{
+        app:         r.app,
+        prefix:      r.prefix,
+        mux:         r.mux,
+        middlewares: append(combined, middlewares...),
+    }
+}
+
 func (r *Router) GET(path string, handler func(r *http.Request, res *Response)) *Router {
     r.registerRoute(path, http.MethodGet, handler)
     return r
@@ -77,6 +114,11 @@ func (r *Router) PUT(path string, handler func(r *http.Request, res *Response))
     return r
 }
 
+func (r *Router) PATCH(path string, handler func(r *http.Request, res *Response)) *Router {
+    r.registerRoute(path, http.MethodPatch, handler)
+    return r
+}
+
 func (r *Router) DELETE(path string, handler func(r *http.Request, res *Response)) *Router {
     r.registerRoute(path, http.MethodDelete, handler)
     return r
@@ -87,6 +129,9 @@ func (r *Router) registerRoute(path, method string, handler func(r *http.Request
         res := &Response{w: w, status: http.StatusOK}
         handler(req, res)
     }
+    for i := len(r.middlewares) - 1; i >= 0; i-- {
+        wrappedHandler = r.middlewares[i](wrappedHandler)
+    }
     for _, middleware := range r.app.middlewares {
         wrappedHandler = middleware(wrappedHandler)
     }
@@ -106,6 +151,20 @@ func (res *Response) Respond(status int, data interface{}) {
     }
 }
 
+func (res *Response) Header() http.Header {
+    return res.w.Header()
+}
+
+func (res *Response) Cookie(cookie *http.Cookie) {
+    http.SetCookie(res.w, cookie)
+}
+
+func (res *Response) Redirect(status int, url string) {
+    res.status = status
+    res.w.Header().Set("Location", url)
+    res.w.WriteHeader(status)
+}
+
 func (res *Response) Status(status int) *Response {
     res.status = status
     return res
@@ -127,6 +186,67 @@ func (app *App) DB() database.Database {
     return app.db
 }
 
+type requestDBKey struct{}
+
+// RequestDB returns the transaction that middleware.Transaction opened for the
+// request, or the app database when there is none. Its writes are audited as
+// made by the request's user.
+func (app *App) RequestDB(r *http.Request) database.Database {
+    db := app.db
+    if tx, ok := requestTx(r); ok {
+        db = tx
+    }
+    return database.Audited(db, RequestActor(r))
+}
+
+// requestTx returns the transaction middleware.Transaction opened for the
+// request, if any
+func requestTx(r *http.Request) (database.Database, bool) {
+    tx, ok := r.Context().Value(requestDBKey{}).(database.Database)
+    return tx, ok
+}
+
+// RequestActor is who the audit log records the request's writes as
+func RequestActor(r *http.Request) database.Actor {
+    actor := database.Actor{ID: models.AuditActorAnonymous, RequestID: utils.RequestIDFromContext(r.Context())}
+    if claims, ok := auth.ClaimsFromContext(r.Context()); ok {
+        actor.ID = claims.Subject
+        if claims.Impersonating() {
+            actor.ImpersonatorID = claims.Act.Subject
+        }
+    }
+    return actor
+}
+
+// WithRequestDB returns a copy of the request whose handlers use db
+func WithRequestDB(r *http.Request, db database.Database) *http.Request {
+    return r.WithContext(context.WithValue(r.Context(), requestDBKey{}, db))
+}
+
+func (app *App) SetAuth(config auth.Config) {
+    app.auth = config
+}
+
+func (app *App) Auth() auth.Config {
+    return app.auth
+}
+
+func (app *App) SetMailer(m mailer.Mailer) {
+    app.mailer = m
+}
+
+func (app *App) Mailer() mailer.Mailer {
+    return app.mailer
+}
+
+func (app *App) SetIdempotencyTTL(ttl time.Duration) {
+    app.idempotencyTTL = ttl
+}
+
+func (app *App) IdempotencyTTL() time.Duration {
+    return app.idempotencyTTL
+}
+
 func (app *App) Context() context.Context {
     return app.ctx
 }
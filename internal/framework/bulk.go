@@ -0,0 +1,151 @@
+package framework
+
+import (
+    "errors"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "net/http"
+    "strconv"
+)
+
+// MaxBulkItems is the most items one bulk request may carry
+const MaxBulkItems = 1000
+
+// BulkResult is the outcome of one item of a bulk request, by its index in
+// the request
+type BulkResult struct {
+    Index  int         `json:"index"`
+    Status int         `json:"status"`
+    Error  string      `json:"error,omitempty"`
+    Data   interface{} `json:"data,omitempty"`
+}
+
+// BulkResponse is the data of a bulk response
+type BulkResponse struct {
+    Results   []BulkResult `json:"results"`
+    Succeeded int          `json:"succeeded"`
+    Failed    int          `json:"failed"`
+    Atomic    bool         `json:"atomic"`
+}
+
+// Bulk tracks the items of a bulk request. Handlers Fail the items that do
+// not pass their checks, write the others in Run and answer with Respond.
+// With ?atomic=true nothing is written unless every item succeeds.
+type Bulk struct {
+    Atomic  bool
+    results []BulkResult
+}
+
+var errBulkRollback = errors.New("bulk request rolled back")
+
+// NewBulk starts a bulk request of n items. It responds with a 400 and
+// returns false when there are none or more than MaxBulkItems.
+func NewBulk(r *http.Request, res *Response, n int) (*Bulk, bool) {
+    if n == 0 {
+        res.Error(http.StatusBadRequest, "No items given")
+        return nil, false
+    }
+    if n > MaxBulkItems {
+        res.Error(http.StatusBadRequest, "At most "+strconv.Itoa(MaxBulkItems)+" items can be sent at once")
+        return nil, false
+    }
+    atomic, _ := strconv.ParseBool(r.URL.Query().Get("atomic"))
+    bulk := &Bulk{Atomic: atomic, results: make([]BulkResult, n)}
+    for i := range bulk.results {
+        bulk.results[i].Index = i
+    }
+    return bulk, true
+}
+
+// Fail records that item i failed with status
+func (b *Bulk) Fail(i, status int, message string) {
+    b.results[i] = BulkResult{Index: i, Status: status, Error: message}
+}
+
+// FailDB records that item i failed with a database error, with the status
+// DBError would answer it with
+func (b *Bulk) FailDB(i int, err error, resource, message string) {
+    status, message := dbErrorStatus(err, resource, message)
+    b.Fail(i, status, message)
+}
+
+// Succeed records that item i succeeded
+func (b *Bulk) Succeed(i, status int, data interface{}) {
+    b.results[i] = BulkResult{Index: i, Status: status, Data: data}
+}
+
+// Pending returns the indexes of the items that have no outcome yet
+func (b *Bulk) Pending() []int {
+    var pending []int
+    for i, result := range b.results {
+        if result.Status == 0 {
+            pending = append(pending, i)
+        }
+    }
+    return pending
+}
+
+func (b *Bulk) failed() bool {
+    for _, result := range b.results {
+        if result.Status >= http.StatusBadRequest {
+            return true
+        }
+    }
+    return false
+}
+
+// Run calls write with the request's database. For an atomic request it
+// does so in a transaction that is rolled back if any item failed, or not at
+// all if an item already failed its checks; the items that did not fail are
+// then reported with 424 Failed Dependency. The error is that of committing.
+func (b *Bulk) Run(app *App, r *http.Request, write func(db database.Database)) error {
+    if !b.Atomic {
+        write(app.RequestDB(r))
+        return nil
+    }
+    if b.failed() {
+        b.abort()
+        return nil
+    }
+    err := app.RequestDB(r).WithTx(r.Context(), func(tx database.Database) error {
+        write(tx)
+        if b.failed() {
+            return errBulkRollback
+        }
+        return nil
+    })
+    if errors.Is(err, errBulkRollback) {
+        b.abort()
+        return nil
+    }
+    return err
+}
+
+// abort marks every item that did not fail as not applied
+func (b *Bulk) abort() {
+    for i, result := range b.results {
+        if result.Status < http.StatusBadRequest {
+            b.Fail(i, http.StatusFailedDependency, "Not applied because another item failed")
+        }
+    }
+}
+
+// Respond answers with every item's result: status when all succeeded, 207
+// Multi-Status when only some did and 422 when an atomic request was
+// rolled back
+func (b *Bulk) Respond(res *Response, status int, message string) {
+    response := BulkResponse{Results: b.results, Atomic: b.Atomic}
+    for _, result := range b.results {
+        if result.Status >= http.StatusBadRequest {
+            response.Failed++
+        } else {
+            response.Succeeded++
+        }
+    }
+    switch {
+    case response.Failed > 0 && b.Atomic:
+        status, message = http.StatusUnprocessableEntity, "No items were applied because some failed"
+    case response.Failed > 0:
+        status, message = http.StatusMultiStatus, "Some items failed"
+    }
+    res.Status(status).Success(message, response)
+}
@@ -0,0 +1,118 @@
+package framework
+
+import (
+    "bytes"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "reflect"
+    "strings"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursorPayload is the signed content of a cursor. The sort order is kept so a
+// cursor cannot be replayed against a different order.
+type cursorPayload struct {
+    Order    string   `json:"o"`
+    Values   []string `json:"v"`
+    Backward bool     `json:"b,omitempty"`
+}
+
+func orderKey(order []database.SortField) string {
+    keys := make([]string, len(order))
+    for i, field := range order {
+        keys[i] = field.Field
+        if field.Desc {
+            keys[i] = "-" + field.Field
+        }
+    }
+    return strings.Join(keys, ",")
+}
+
+func encodeCursor(secret []byte, payload cursorPayload) string {
+    data, _ := json.Marshal(payload)
+    return base64.RawURLEncoding.EncodeToString(data) + "." + base64.RawURLEncoding.EncodeToString(cursorSignature(secret, data))
+}
+
+// cursorSignature MACs a cursor with a key derived from the auth secret, so
+// that a cursor cannot pass for any other token signed with the secret
+func cursorSignature(secret, data []byte) []byte {
+    key := hmac.New(sha256.New, secret)
+    key.Write([]byte("cursor:"))
+    mac := hmac.New(sha256.New, key.Sum(nil))
+    mac.Write(data)
+    return mac.Sum(nil)
+}
+
+func decodeCursor(secret []byte, token string, order []database.SortField, fields map[string]database.Field) (*database.Cursor, error) {
+    encoded, signature, ok := strings.Cut(token, ".")
+    if !ok {
+        return nil, ErrInvalidCursor
+    }
+    data, err := base64.RawURLEncoding.DecodeString(encoded)
+    if err != nil {
+        return nil, ErrInvalidCursor
+    }
+    sum, err := base64.RawURLEncoding.DecodeString(signature)
+    if err != nil {
+        return nil, ErrInvalidCursor
+    }
+    if !hmac.Equal(sum, cursorSignature(secret, data)) {
+        return nil, ErrInvalidCursor
+    }
+    var payload cursorPayload
+    if err := json.Unmarshal(data, &payload); err != nil {
+        return nil, ErrInvalidCursor
+    }
+    if payload.Order != orderKey(order) || len(payload.Values) != len(order) {
+        return nil, fmt.Errorf("%w: sort order has changed", ErrInvalidCursor)
+    }
+    cursor := &database.Cursor{Backward: payload.Backward}
+    for i, field := range order {
+        value, err := columnKind(fields, field.Field).Parse(payload.Values[i])
+        if err != nil {
+            return nil, ErrInvalidCursor
+        }
+        cursor.Values = append(cursor.Values, value)
+    }
+    return cursor, nil
+}
+
+func columnKind(fields map[string]database.Field, column string) database.FieldKind {
+    for _, field := range fields {
+        if field.Column == column {
+            return field.Kind
+        }
+    }
+    return database.KindString
+}
+
+// rowCursor builds a cursor pointing at the given row. Sort values are read from
+// the row's JSON encoding, so sortable columns must use their column name as
+// their JSON name.
+func rowCursor(secret []byte, row reflect.Value, order []database.SortField, backward bool) string {
+    data, err := json.Marshal(row.Interface())
+    if err != nil {
+        return ""
+    }
+    decoder := json.NewDecoder(bytes.NewReader(data))
+    decoder.UseNumber()
+    var values map[string]interface{}
+    if err := decoder.Decode(&values); err != nil {
+        return ""
+    }
+    payload := cursorPayload{Order: orderKey(order), Backward: backward}
+    for _, field := range order {
+        value, ok := values[field.Field]
+        if !ok || value == nil {
+            return ""
+        }
+        payload.Values = append(payload.Values, fmt.Sprint(value))
+    }
+    return encodeCursor(secret, payload)
+}
@@ -0,0 +1,61 @@
+package framework
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestCursor(t *testing.T) {
+    secret := []byte("0123456789abcdef0123456789abcdef")
+    fields := database.FieldsOf(models.User{})
+    order := []database.SortField{{Field: "name"}, {Field: "id", Desc: true}}
+    user := models.User{UserSchema: models.UserSchema{ID: 7, Name: "Ann"}}
+    token := rowCursor(secret, reflect.ValueOf(user), order, true)
+    if token == "" {
+        t.Fatal("rowCursor returned no cursor")
+    }
+
+    cursor, err := decodeCursor(secret, token, order, fields)
+    if err != nil {
+        t.Fatalf("decodeCursor: %v", err)
+    }
+    if !cursor.Backward || fmt.Sprint(cursor.Values) != "[Ann 7]" {
+        t.Errorf("cursor = %+v, want backward from Ann, 7", cursor)
+    }
+
+    encoded, signature, _ := strings.Cut(token, ".")
+    data, _ := base64.RawURLEncoding.DecodeString(encoded)
+    // A MAC keyed with the secret itself, as other tokens are signed
+    plain := hmac.New(sha256.New, secret)
+    plain.Write(data)
+    forged := strings.Replace(string(data), `"Ann"`, `"Bob"`, 1)
+
+    tests := map[string]struct {
+        token string
+        order []database.SortField
+    }{
+        "tampered values":    {base64.RawURLEncoding.EncodeToString([]byte(forged)) + "." + signature, order},
+        "tampered signature": {encoded + "." + base64.RawURLEncoding.EncodeToString(make([]byte, sha256.Size)), order},
+        "signed with secret": {encoded + "." + base64.RawURLEncoding.EncodeToString(plain.Sum(nil)), order},
+        "no signature":       {encoded, order},
+        "not base64":         {"!!." + signature, order},
+        "other sort order":   {token, []database.SortField{{Field: "email"}, {Field: "id", Desc: true}}},
+        "other direction":    {token, []database.SortField{{Field: "name", Desc: true}, {Field: "id", Desc: true}}},
+    }
+    for name, test := range tests {
+        if _, err := decodeCursor(secret, test.token, test.order, fields); !errors.Is(err, ErrInvalidCursor) {
+            t.Errorf("%s: decodeCursor error = %v, want ErrInvalidCursor", name, err)
+        }
+    }
+    if _, err := decodeCursor([]byte("another secret"), token, order, fields); !errors.Is(err, ErrInvalidCursor) {
+        t.Errorf("decodeCursor accepted a cursor signed with another secret: %v", err)
+    }
+}
@@ -0,0 +1,47 @@
+package framework
+
+import (
+    "errors"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "log"
+    "net/http"
+)
+
+// DBError responds to a failed database operation on resource (such as "User")
+// with the status matching the error, falling back to a 500 with message
+func (res *Response) DBError(err error, resource, message string) {
+    res.Error(dbErrorStatus(err, resource, message))
+}
+
+// dbErrorStatus returns the status and message DBError answers err with
+func dbErrorStatus(err error, resource, message string) (int, string) {
+    switch {
+    case errors.Is(err, database.ErrNotFound):
+        return http.StatusNotFound, resource + " not found"
+    case errors.Is(err, database.ErrConflict):
+        return http.StatusConflict, resource + " already exists"
+    case errors.Is(err, database.ErrStale):
+        return http.StatusPreconditionFailed, resource + " was changed since it was read"
+    case errors.Is(err, database.ErrUnavailable):
+        log.Printf("Database unavailable: %v", err)
+        return http.StatusServiceUnavailable, "Database is unavailable"
+    case errors.Is(err, database.ErrTimeout):
+        log.Printf("Database timeout: %v", err)
+        return http.StatusGatewayTimeout, "Database operation timed out"
+    case errors.Is(err, database.ErrTxUnsupported):
+        return http.StatusNotImplemented, "Atomic writes are not supported by the database"
+    }
+    log.Printf("%s: %v", message, err)
+    return http.StatusInternalServerError, message
+}
+
+// HTTPError is an error that carries the status it should be answered with,
+// for hooks that want to reject a request with something other than a 400
+type HTTPError struct {
+    Status  int
+    Message string
+}
+
+func (e *HTTPError) Error() string {
+    return e.Message
+}
@@ -0,0 +1,184 @@
+package framework
+
+import (
+    "fmt"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/utils"
+    "net/http"
+    "reflect"
+    "regexp"
+    "strconv"
+    "strings"
+)
+
+const (
+    DefaultPageLimit = 20
+    MaxPageLimit     = 100
+)
+
+// ListParams are query parameters with a meaning of their own; every other
+// parameter of a list request is parsed as a filter
+var ListParams = map[string]bool{"page": true, "limit": true, "sort": true, "cursor": true, "filter": true, "q": true, "include_deleted": true}
+
+var filterParam = regexp.MustCompile(`^(\w+)(?:\[(\w+)\])?$`)
+
+// ParseListOptions reads ?page=&limit=&sort=-created_at,name&cursor=, filters
+// such as ?name=Ali or ?created_at[gte]=2024-01-01 and a filter expression
+// (see database.ParseFilter) into list options, along with include_deleted. Only the given fields can be
+// sorted and filtered on.
+func (app *App) ParseListOptions(r *http.Request, fields map[string]database.Field) (database.ListOptions, error) {
+    query := r.URL.Query()
+    opts := database.ListOptions{Limit: DefaultPageLimit}
+    if value := query.Get("limit"); value != "" {
+        limit, err := strconv.Atoi(value)
+        if err != nil || limit < 1 {
+            return opts, fmt.Errorf("invalid limit %q", value)
+        }
+        if limit > MaxPageLimit {
+            limit = MaxPageLimit
+        }
+        opts.Limit = limit
+    }
+    if value := query.Get("page"); value != "" {
+        page, err := strconv.Atoi(value)
+        if err != nil || page < 1 {
+            return opts, fmt.Errorf("invalid page %q", value)
+        }
+        opts.Offset = (page - 1) * opts.Limit
+    }
+    if value := query.Get("sort"); value != "" {
+        for _, name := range strings.Split(value, ",") {
+            desc := strings.HasPrefix(name, "-")
+            name = strings.TrimPrefix(name, "-")
+            field, ok := fields[name]
+            if !ok {
+                return opts, fmt.Errorf("cannot sort by %q", name)
+            }
+            opts.Sort = append(opts.Sort, database.SortField{Field: field.Column, Desc: desc})
+        }
+    }
+    for key, values := range query {
+        if ListParams[key] {
+            continue
+        }
+        match := filterParam.FindStringSubmatch(key)
+        if match == nil {
+            return opts, fmt.Errorf("invalid filter %q", key)
+        }
+        field, ok := fields[match[1]]
+        if !ok {
+            return opts, fmt.Errorf("cannot filter by %q", match[1])
+        }
+        op := match[2]
+        if op == "" {
+            op = database.OpEq
+        }
+        for _, raw := range values {
+            filter, err := field.Filter(op, raw)
+            if err != nil {
+                return opts, fmt.Errorf("%s: %v", match[1], err)
+            }
+            opts.Filters = append(opts.Filters, filter)
+        }
+    }
+    if value := query.Get("filter"); value != "" {
+        where, err := database.ParseFilter(value, fields)
+        if err != nil {
+            return opts, err
+        }
+        opts.Where = where
+    }
+    if value := query.Get("include_deleted"); value != "" {
+        include, err := strconv.ParseBool(value)
+        if err != nil {
+            return opts, fmt.Errorf("invalid include_deleted %q", value)
+        }
+        opts.IncludeDeleted = include
+    }
+    if token := query.Get("cursor"); token != "" {
+        cursor, err := decodeCursor(app.auth.Secret, token, opts.OrderBy("id"), fields)
+        if err != nil {
+            return opts, err
+        }
+        opts.Cursor = cursor
+        opts.Offset = 0
+    }
+    return opts, opts.Validate()
+}
+
+// Paginate responds with a page of results and the total count in the envelope
+// and the X-Total-Count header. The envelope also carries next_cursor and
+// prev_cursor, and the Link header points at the neighbouring pages.
+func (app *App) Paginate(res *Response, r *http.Request, message string, data interface{}, opts database.ListOptions, total int64) {
+    app.paginate(res, r, message, data, opts, total, true)
+}
+
+// PaginateOffset responds like Paginate but without cursors, for results such
+// as search matches whose order no cursor can point into
+func (app *App) PaginateOffset(res *Response, r *http.Request, message string, data interface{}, opts database.ListOptions, total int64) {
+    app.paginate(res, r, message, data, opts, total, false)
+}
+
+func (app *App) paginate(res *Response, r *http.Request, message string, data interface{}, opts database.ListOptions, total int64, cursors bool) {
+    limit := opts.Limit
+    if limit < 1 {
+        limit = DefaultPageLimit
+    }
+    meta := utils.Pagination{Total: total, Limit: limit}
+    rows := reflect.ValueOf(data)
+    count := 0
+    if rows.Kind() == reflect.Slice {
+        count = rows.Len()
+    }
+    var hasNext, hasPrev bool
+    switch {
+    case opts.Cursor == nil:
+        meta.Page = opts.Offset/limit + 1
+        meta.Pages = int((total + int64(limit) - 1) / int64(limit))
+        if meta.Pages < 1 {
+            meta.Pages = 1
+        }
+        hasNext, hasPrev = meta.Page < meta.Pages, meta.Page > 1
+    case opts.Cursor.Backward:
+        hasNext, hasPrev = count > 0, count == limit
+    default:
+        hasNext, hasPrev = count == limit, count > 0
+    }
+    order := opts.OrderBy("id")
+    if cursors && hasNext && count > 0 {
+        meta.NextCursor = rowCursor(app.auth.Secret, rows.Index(count-1), order, false)
+    }
+    if cursors && hasPrev && count > 0 {
+        meta.PrevCursor = rowCursor(app.auth.Secret, rows.Index(0), order, true)
+    }
+
+    links := []string{listLink(r, limit, "first", "page", "1")}
+    if opts.Cursor == nil {
+        if hasPrev {
+            links = append(links, listLink(r, limit, "prev", "page", strconv.Itoa(meta.Page-1)))
+        }
+        if hasNext {
+            links = append(links, listLink(r, limit, "next", "page", strconv.Itoa(meta.Page+1)))
+        }
+        links = append(links, listLink(r, limit, "last", "page", strconv.Itoa(meta.Pages)))
+    } else {
+        if meta.PrevCursor != "" {
+            links = append(links, listLink(r, limit, "prev", "cursor", meta.PrevCursor))
+        }
+        if meta.NextCursor != "" {
+            links = append(links, listLink(r, limit, "next", "cursor", meta.NextCursor))
+        }
+    }
+    res.Header().Set("Link", strings.Join(links, ", "))
+    res.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+    res.JSON(utils.SuccessResponse{Message: message, Data: data, Meta: meta})
+}
+
+func listLink(r *http.Request, limit int, rel, param, value string) string {
+    query := r.URL.Query()
+    query.Del("page")
+    query.Del("cursor")
+    query.Set(param, value)
+    query.Set("limit", strconv.Itoa(limit))
+    return fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, query.Encode(), rel)
+}
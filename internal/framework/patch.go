@@ -0,0 +1,383 @@
+package framework
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "mime"
+    "net/http"
+    "reflect"
+    "strconv"
+    "strings"
+)
+
+const (
+    MergePatchType = "application/merge-patch+json"
+    JSONPatchType  = "application/json-patch+json"
+)
+
+var (
+    // ErrPatchType is returned for a PATCH body that is neither a merge
+    // patch nor a JSON patch
+    ErrPatchType = errors.New("unsupported patch media type")
+    // ErrPatchTest is returned when a JSON patch test operation fails
+    ErrPatchTest = errors.New("patch test failed")
+)
+
+// PatchError reports a patch that is malformed or cannot be applied
+type PatchError struct {
+    Op   int
+    Path string
+    Err  string
+}
+
+func (e *PatchError) Error() string {
+    if e.Path == "" {
+        return fmt.Sprintf("patch operation %d: %s", e.Op, e.Err)
+    }
+    return fmt.Sprintf("patch operation %d on %s: %s", e.Op, e.Path, e.Err)
+}
+
+// ApplyPatch reads the body of a PATCH request and applies it to the JSON
+// document target. The Content-Type picks the format: JSONPatchType for a
+// JSON patch (RFC 6902), MergePatchType or application/json for a merge
+// patch (RFC 7396).
+func ApplyPatch(r *http.Request, target []byte) ([]byte, error) {
+    mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+    body, err := io.ReadAll(r.Body)
+    if err != nil {
+        return nil, err
+    }
+    switch mediaType {
+    case JSONPatchType:
+        return JSONPatch(target, body)
+    case MergePatchType, "application/json":
+        return MergePatch(target, body)
+    }
+    return nil, ErrPatchType
+}
+
+// PatchFailed responds to an error from ApplyPatch: 415 for an unknown media
+// type, 409 for a failed test operation and 400 for invalid patches
+func (res *Response) PatchFailed(err error) {
+    var patchErr *PatchError
+    switch {
+    case errors.Is(err, ErrPatchType):
+        res.Header().Set("Accept-Patch", JSONPatchType+", "+MergePatchType)
+        res.Error(http.StatusUnsupportedMediaType, "PATCH needs a JSON patch ("+JSONPatchType+") or a JSON merge patch ("+MergePatchType+")")
+    case errors.Is(err, ErrPatchTest):
+        res.Error(http.StatusConflict, err.Error())
+    case errors.As(err, &patchErr):
+        res.Error(http.StatusBadRequest, "Invalid patch: "+err.Error())
+    default:
+        res.Error(http.StatusBadRequest, "Invalid request payload")
+    }
+}
+
+// MergePatch applies a JSON merge patch (RFC 7396) to the JSON document
+// target: objects are merged recursively, null removes a member and any
+// other value replaces the target's.
+func MergePatch(target, patch []byte) ([]byte, error) {
+    var doc, changes interface{}
+    if err := json.Unmarshal(target, &doc); err != nil {
+        return nil, err
+    }
+    if err := json.Unmarshal(patch, &changes); err != nil {
+        return nil, err
+    }
+    return json.Marshal(mergePatch(doc, changes))
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+    changes, ok := patch.(map[string]interface{})
+    if !ok {
+        return patch
+    }
+    doc, ok := target.(map[string]interface{})
+    if !ok {
+        doc = map[string]interface{}{}
+    }
+    for key, value := range changes {
+        if value == nil {
+            delete(doc, key)
+        } else {
+            doc[key] = mergePatch(doc[key], value)
+        }
+    }
+    return doc
+}
+
+type patchOperation struct {
+    Op    string           `json:"op"`
+    Path  *string          `json:"path"`
+    From  *string          `json:"from"`
+    Value *json.RawMessage `json:"value"`
+}
+
+// JSONPatch applies a JSON patch (RFC 6902) to the JSON document target. The
+// operations are applied in order and the patch fails as a whole if any of
+// them does.
+func JSONPatch(target, patch []byte) ([]byte, error) {
+    var doc interface{}
+    if err := json.Unmarshal(target, &doc); err != nil {
+        return nil, err
+    }
+    var ops []patchOperation
+    if err := json.Unmarshal(patch, &ops); err != nil {
+        return nil, &PatchError{Err: "a JSON patch is an array of operations"}
+    }
+    for i, op := range ops {
+        var err error
+        doc, err = applyOperation(doc, op)
+        if err != nil {
+            path := ""
+            if op.Path != nil {
+                path = *op.Path
+            }
+            if errors.Is(err, ErrPatchTest) {
+                return nil, fmt.Errorf("%w: operation %d on %s", ErrPatchTest, i, path)
+            }
+            return nil, &PatchError{Op: i, Path: path, Err: err.Error()}
+        }
+    }
+    return json.Marshal(doc)
+}
+
+func applyOperation(doc interface{}, op patchOperation) (interface{}, error) {
+    if op.Path == nil {
+        return nil, errors.New("missing path")
+    }
+    path, err := parsePointer(*op.Path)
+    if err != nil {
+        return nil, err
+    }
+    var value interface{}
+    switch op.Op {
+    case "add", "replace", "test":
+        if op.Value == nil {
+            return nil, errors.New("missing value")
+        }
+        if err := json.Unmarshal(*op.Value, &value); err != nil {
+            return nil, err
+        }
+    case "move", "copy":
+        if op.From == nil {
+            return nil, errors.New("missing from")
+        }
+        from, err := parsePointer(*op.From)
+        if err != nil {
+            return nil, err
+        }
+        if value, err = pointerGet(doc, from); err != nil {
+            return nil, err
+        }
+        if op.Op == "move" {
+            if isPrefix(from, path) && len(from) < len(path) {
+                return nil, errors.New("cannot move a value into itself")
+            }
+            if doc, err = pointerRemove(doc, from); err != nil {
+                return nil, err
+            }
+        } else {
+            value = deepCopy(value)
+        }
+    case "remove":
+    default:
+        return nil, fmt.Errorf("unknown op %q", op.Op)
+    }
+    switch op.Op {
+    case "remove":
+        return pointerRemove(doc, path)
+    case "replace":
+        if _, err := pointerGet(doc, path); err != nil {
+            return nil, err
+        }
+        if len(path) == 0 {
+            return value, nil
+        }
+        if doc, err = pointerRemove(doc, path); err != nil {
+            return nil, err
+        }
+        return pointerAdd(doc, path, value)
+    case "test":
+        current, err := pointerGet(doc, path)
+        if err != nil {
+            return nil, err
+        }
+        if !reflect.DeepEqual(current, value) {
+            return nil, ErrPatchTest
+        }
+        return doc, nil
+    }
+    return pointerAdd(doc, path, value)
+}
+
+// parsePointer splits a JSON pointer (RFC 6901) into its unescaped tokens
+func parsePointer(pointer string) ([]string, error) {
+    if pointer == "" {
+        return nil, nil
+    }
+    if !strings.HasPrefix(pointer, "/") {
+        return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+    }
+    tokens := strings.Split(pointer[1:], "/")
+    for i, token := range tokens {
+        tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+    }
+    return tokens, nil
+}
+
+func isPrefix(prefix, path []string) bool {
+    if len(prefix) > len(path) {
+        return false
+    }
+    for i := range prefix {
+        if prefix[i] != path[i] {
+            return false
+        }
+    }
+    return true
+}
+
+func arrayIndex(token string, length int, appending bool) (int, error) {
+    if appending && token == "-" {
+        return length, nil
+    }
+    index, err := strconv.Atoi(token)
+    if err != nil || index < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+        return 0, fmt.Errorf("invalid array index %q", token)
+    }
+    max := length - 1
+    if appending {
+        max = length
+    }
+    if index > max {
+        return 0, fmt.Errorf("array index %d out of range", index)
+    }
+    return index, nil
+}
+
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+    for _, token := range path {
+        switch node := doc.(type) {
+        case map[string]interface{}:
+            value, ok := node[token]
+            if !ok {
+                return nil, fmt.Errorf("%q does not exist", token)
+            }
+            doc = value
+        case []interface{}:
+            index, err := arrayIndex(token, len(node), false)
+            if err != nil {
+                return nil, err
+            }
+            doc = node[index]
+        default:
+            return nil, fmt.Errorf("%q does not exist", token)
+        }
+    }
+    return doc, nil
+}
+
+// pointerAdd returns doc with value added at path. Containers are modified
+// in place, but adding to an array makes a new slice, so parents are updated
+// on the way back up.
+func pointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+    if len(path) == 0 {
+        return value, nil
+    }
+    token := path[0]
+    switch node := doc.(type) {
+    case map[string]interface{}:
+        if len(path) == 1 {
+            node[token] = value
+            return node, nil
+        }
+        child, ok := node[token]
+        if !ok {
+            return nil, fmt.Errorf("%q does not exist", token)
+        }
+        updated, err := pointerAdd(child, path[1:], value)
+        if err != nil {
+            return nil, err
+        }
+        node[token] = updated
+        return node, nil
+    case []interface{}:
+        index, err := arrayIndex(token, len(node), len(path) == 1)
+        if err != nil {
+            return nil, err
+        }
+        if len(path) == 1 {
+            node = append(node, nil)
+            copy(node[index+1:], node[index:])
+            node[index] = value
+            return node, nil
+        }
+        updated, err := pointerAdd(node[index], path[1:], value)
+        if err != nil {
+            return nil, err
+        }
+        node[index] = updated
+        return node, nil
+    }
+    return nil, fmt.Errorf("%q does not exist", token)
+}
+
+func pointerRemove(doc interface{}, path []string) (interface{}, error) {
+    if len(path) == 0 {
+        return nil, errors.New("cannot remove the whole document")
+    }
+    token := path[0]
+    switch node := doc.(type) {
+    case map[string]interface{}:
+        child, ok := node[token]
+        if !ok {
+            return nil, fmt.Errorf("%q does not exist", token)
+        }
+        if len(path) == 1 {
+            delete(node, token)
+            return node, nil
+        }
+        updated, err := pointerRemove(child, path[1:])
+        if err != nil {
+            return nil, err
+        }
+        node[token] = updated
+        return node, nil
+    case []interface{}:
+        index, err := arrayIndex(token, len(node), false)
+        if err != nil {
+            return nil, err
+        }
+        if len(path) == 1 {
+            return append(node[:index:index], node[index+1:]...), nil
+        }
+        updated, err := pointerRemove(node[index], path[1:])
+        if err != nil {
+            return nil, err
+        }
+        node[index] = updated
+        return node, nil
+    }
+    return nil, fmt.Errorf("%q does not exist", token)
+}
+
+func deepCopy(value interface{}) interface{} {
+    switch v := value.(type) {
+    case map[string]interface{}:
+        copied := make(map[string]interface{}, len(v))
+        for key, item := range v {
+            copied[key] = deepCopy(item)
+        }
+        return copied
+    case []interface{}:
+        copied := make([]interface{}, len(v))
+        for i, item := range v {
+            copied[i] = deepCopy(item)
+        }
+        return copied
+    }
+    return value
+}
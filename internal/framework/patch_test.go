@@ -0,0 +1,150 @@
+package framework
+
+import (
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+const patchTarget = `{"name":"Ann","tags":["a","b"],"address":{"city":"Oslo","zip":"0150"},"a/b":1,"m~n":2}`
+
+// sameJSON reports whether two JSON documents are equal ignoring member order
+func sameJSON(t *testing.T, a, b string) bool {
+    t.Helper()
+    var x, y interface{}
+    if err := json.Unmarshal([]byte(a), &x); err != nil {
+        t.Fatalf("%s: %v", a, err)
+    }
+    if err := json.Unmarshal([]byte(b), &y); err != nil {
+        t.Fatalf("%s: %v", b, err)
+    }
+    xs, _ := json.Marshal(x)
+    ys, _ := json.Marshal(y)
+    return string(xs) == string(ys)
+}
+
+func TestJSONPatch(t *testing.T) {
+    tests := []struct {
+        name, patch, want string
+    }{
+        {"append with -", `[{"op":"add","path":"/tags/-","value":"c"}]`,
+            `{"name":"Ann","tags":["a","b","c"],"address":{"city":"Oslo","zip":"0150"},"a/b":1,"m~n":2}`},
+        {"insert before an index", `[{"op":"add","path":"/tags/0","value":"z"}]`,
+            `{"name":"Ann","tags":["z","a","b"],"address":{"city":"Oslo","zip":"0150"},"a/b":1,"m~n":2}`},
+        {"add at the end index", `[{"op":"add","path":"/tags/2","value":"c"}]`,
+            `{"name":"Ann","tags":["a","b","c"],"address":{"city":"Oslo","zip":"0150"},"a/b":1,"m~n":2}`},
+        {"escaped tokens", `[{"op":"replace","path":"/a~1b","value":3},{"op":"remove","path":"/m~0n"}]`,
+            `{"name":"Ann","tags":["a","b"],"address":{"city":"Oslo","zip":"0150"},"a/b":3}`},
+        {"move between members", `[{"op":"move","from":"/address/city","path":"/city"}]`,
+            `{"name":"Ann","tags":["a","b"],"address":{"zip":"0150"},"city":"Oslo","a/b":1,"m~n":2}`},
+        {"move onto itself", `[{"op":"move","from":"/address","path":"/address"}]`, patchTarget},
+        {"move within an array", `[{"op":"move","from":"/tags/0","path":"/tags/-"}]`,
+            `{"name":"Ann","tags":["b","a"],"address":{"city":"Oslo","zip":"0150"},"a/b":1,"m~n":2}`},
+        {"copy is independent", `[{"op":"copy","from":"/address","path":"/billing"},{"op":"replace","path":"/billing/city","value":"Bergen"}]`,
+            `{"name":"Ann","tags":["a","b"],"address":{"city":"Oslo","zip":"0150"},"billing":{"city":"Bergen","zip":"0150"},"a/b":1,"m~n":2}`},
+        {"test then replace", `[{"op":"test","path":"/tags","value":["a","b"]},{"op":"replace","path":"/name","value":"Bob"}]`,
+            `{"name":"Bob","tags":["a","b"],"address":{"city":"Oslo","zip":"0150"},"a/b":1,"m~n":2}`},
+        {"replace the document", `[{"op":"replace","path":"","value":{"name":"Bob"}}]`, `{"name":"Bob"}`},
+    }
+    for _, test := range tests {
+        got, err := JSONPatch([]byte(patchTarget), []byte(test.patch))
+        if err != nil {
+            t.Errorf("%s: JSONPatch: %v", test.name, err)
+            continue
+        }
+        if !sameJSON(t, string(got), test.want) {
+            t.Errorf("%s: JSONPatch = %s, want %s", test.name, got, test.want)
+        }
+    }
+}
+
+func TestJSONPatchErrors(t *testing.T) {
+    tests := map[string]string{
+        "not an array":              `{"op":"add","path":"/x","value":1}`,
+        "unknown op":                `[{"op":"merge","path":"/x","value":1}]`,
+        "missing path":              `[{"op":"add","value":1}]`,
+        "missing value":             `[{"op":"add","path":"/x"}]`,
+        "missing from":              `[{"op":"move","path":"/x"}]`,
+        "relative pointer":          `[{"op":"add","path":"x","value":1}]`,
+        "missing parent":            `[{"op":"add","path":"/nope/x","value":1}]`,
+        "index past the end":        `[{"op":"add","path":"/tags/3","value":"c"}]`,
+        "leading zero index":        `[{"op":"add","path":"/tags/01","value":"c"}]`,
+        "remove with -":             `[{"op":"remove","path":"/tags/-"}]`,
+        "replace with -":            `[{"op":"replace","path":"/tags/-","value":"c"}]`,
+        "remove a missing member":   `[{"op":"remove","path":"/nope"}]`,
+        "replace a missing member":  `[{"op":"replace","path":"/nope","value":1}]`,
+        "remove the document":       `[{"op":"remove","path":""}]`,
+        "move into its own child":   `[{"op":"move","from":"/address","path":"/address/home"}]`,
+        "move into a nested child":  `[{"op":"move","from":"/tags","path":"/tags/0/x"}]`,
+        "move from a missing value": `[{"op":"move","from":"/nope","path":"/x"}]`,
+    }
+    for name, patch := range tests {
+        _, err := JSONPatch([]byte(patchTarget), []byte(patch))
+        var patchErr *PatchError
+        if !errors.As(err, &patchErr) {
+            t.Errorf("%s: JSONPatch error = %v, want a PatchError", name, err)
+        }
+    }
+}
+
+func TestJSONPatchTestFailure(t *testing.T) {
+    // The test fails after an earlier operation would have applied, so the
+    // patch must fail as a whole
+    patch := `[{"op":"replace","path":"/name","value":"Bob"},{"op":"test","path":"/address/city","value":"Bergen"}]`
+    got, err := JSONPatch([]byte(patchTarget), []byte(patch))
+    if !errors.Is(err, ErrPatchTest) || got != nil {
+        t.Fatalf("JSONPatch = %s, %v, want ErrPatchTest", got, err)
+    }
+    for name, patch := range map[string]string{
+        "number type": `[{"op":"test","path":"/a~1b","value":"1"}]`,
+        "array order": `[{"op":"test","path":"/tags","value":["b","a"]}]`,
+    } {
+        if _, err := JSONPatch([]byte(patchTarget), []byte(patch)); !errors.Is(err, ErrPatchTest) {
+            t.Errorf("%s: JSONPatch error = %v, want ErrPatchTest", name, err)
+        }
+    }
+}
+
+func TestMergePatch(t *testing.T) {
+    got, err := MergePatch([]byte(patchTarget), []byte(`{"name":"Bob","address":{"zip":null},"tags":["c"],"a/b":null}`))
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := `{"name":"Bob","tags":["c"],"address":{"city":"Oslo"},"m~n":2}`
+    if !sameJSON(t, string(got), want) {
+        t.Errorf("MergePatch = %s, want %s", got, want)
+    }
+}
+
+func TestPatchFailed(t *testing.T) {
+    tests := []struct {
+        contentType, patch string
+        status             int
+    }{
+        {JSONPatchType, `[{"op":"test","path":"/name","value":"Bob"}]`, http.StatusConflict},
+        {JSONPatchType, `[{"op":"add","path":"/tags/9","value":"c"}]`, http.StatusBadRequest},
+        {JSONPatchType, `not json`, http.StatusBadRequest},
+        {MergePatchType, `not json`, http.StatusBadRequest},
+        {"text/plain", `{}`, http.StatusUnsupportedMediaType},
+    }
+    for _, test := range tests {
+        request := httptest.NewRequest(http.MethodPatch, "/users/1", strings.NewReader(test.patch))
+        request.Header.Set("Content-Type", test.contentType)
+        _, err := ApplyPatch(request, []byte(patchTarget))
+        if err == nil {
+            t.Errorf("%s %s: ApplyPatch succeeded", test.contentType, test.patch)
+            continue
+        }
+        recorder := httptest.NewRecorder()
+        NewResponse(recorder).PatchFailed(err)
+        if recorder.Code != test.status {
+            t.Errorf("%s %s: status = %d, want %d", test.contentType, test.patch, recorder.Code, test.status)
+        }
+        if test.status == http.StatusUnsupportedMediaType && recorder.Header().Get("Accept-Patch") == "" {
+            t.Error("415 response lacks Accept-Patch")
+        }
+    }
+}
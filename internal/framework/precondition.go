@@ -0,0 +1,58 @@
+package framework
+
+import (
+    "net/http"
+    "strconv"
+    "strings"
+)
+
+// ETag is the entity tag of a record at version
+func ETag(version uint64) string {
+    return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// ETag sets the ETag header to the entity tag of version
+func (res *Response) ETag(version uint64) {
+    res.Header().Set("ETag", ETag(version))
+}
+
+// SetStrictPreconditions makes writes checked with CheckPrecondition fail
+// with 428 Precondition Required when they come without an If-Match header
+func (app *App) SetStrictPreconditions(strict bool) {
+    app.strictPreconditions = strict
+}
+
+func (app *App) StrictPreconditions() bool {
+    return app.strictPreconditions
+}
+
+// CheckPrecondition checks the If-Match header of a write to a record that
+// is at version. It responds with 412 Precondition Failed when no entity tag
+// matches, or with 428 Precondition Required when the header is missing in
+// strict mode, and returns false if it did.
+//
+// The check only covers the version read by the handler; pass that version
+// to the write as well (see database.Changes) so that a concurrent change
+// still fails, with database.ErrStale.
+func (app *App) CheckPrecondition(r *http.Request, res *Response, version uint64) bool {
+    header := r.Header.Values("If-Match")
+    if len(header) == 0 {
+        if app.strictPreconditions {
+            res.Error(http.StatusPreconditionRequired, "This request requires an If-Match header")
+            return false
+        }
+        return true
+    }
+    current := ETag(version)
+    for _, value := range header {
+        for _, tag := range strings.Split(value, ",") {
+            // If-Match uses the strong comparison, so weak tags never match
+            if tag = strings.TrimSpace(tag); tag == "*" || tag == current {
+                return true
+            }
+        }
+    }
+    res.ETag(version)
+    res.Error(http.StatusPreconditionFailed, "The record was changed since it was read")
+    return false
+}
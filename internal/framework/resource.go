@@ -0,0 +1,453 @@
+package framework
+
+import (
+    "encoding/json"
+    "errors"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "github.com/go-playground/validator/v10"
+    "github.com/gorilla/mux"
+    "net/http"
+    "reflect"
+    "strconv"
+    "strings"
+)
+
+// ResourceAction names one of the routes Resource registers
+type ResourceAction string
+
+const (
+    ActionList   ResourceAction = "list"   // GET /
+    ActionGet    ResourceAction = "get"    // GET /{id}
+    ActionCreate ResourceAction = "create" // POST /
+    ActionUpdate ResourceAction = "update" // PUT /{id}
+    ActionPatch  ResourceAction = "patch"  // PATCH /{id}, see ApplyPatch
+    ActionDelete ResourceAction = "delete" // DELETE /{id}
+)
+
+// ResourceOptions configures Resource. The zero value serves every action.
+type ResourceOptions[T any] struct {
+    // Name is the singular name used in messages, T's type name by default,
+    // and Plural the name used for lists, Name with an s by default
+    Name   string
+    Plural string
+    // Fields can be sorted and filtered on, database.FieldsOf(T) by default
+    Fields map[string]database.Field
+    // IDField is the JSON name of the primary key, id by default. IDs in the
+    // path are parsed as the Go type of that field.
+    IDField string
+    // Immutable are the JSON fields clients cannot set: create leaves them
+    // empty, update and patch keep the stored values. Fields hidden from JSON
+    // are treated the same, and so is the ID, except that clients pick it on
+    // create unless it is a number. Defaults to created_at, updated_at,
+    // deleted_at and version.
+    Immutable []string
+    // Disable leaves actions out
+    Disable []ResourceAction
+    // Handlers replace the generated handlers of actions
+    Handlers map[ResourceAction]func(r *http.Request, res *Response)
+    // Middleware runs for every action, ActionMiddleware for the given
+    // actions only, e.g. to require an admin for ActionDelete
+    Middleware       []func(http.HandlerFunc) http.HandlerFunc
+    ActionMiddleware map[ResourceAction][]func(http.HandlerFunc) http.HandlerFunc
+    // Validate checks an entity before it is saved. It defaults to the
+    // entity's Validate method if it has one and its validate tags otherwise.
+    Validate func(entity *T) error
+    // BeforeSave runs after validation on create, update and patch, with the
+    // stored entity or nil on create. Returning an *HTTPError answers with its
+    // status, any other error with a 400.
+    BeforeSave func(r *http.Request, entity, existing *T) error
+    // AllowIncludeDeleted decides who may list soft deleted entities with
+    // include_deleted; nobody may when it is nil
+    AllowIncludeDeleted func(r *http.Request) bool
+    // Created, if set, returns what the create response carries instead of
+    // the entity, e.g. to show a generated secret once
+    Created func(entity *T) interface{}
+}
+
+var validate = validator.New()
+
+// Resource registers the CRUD routes for the entities in repo under prefix
+// and returns the router. It is a function rather than an App method because
+// Go methods cannot have type parameters:
+//
+//	framework.Resource(app, "/products", products, framework.ResourceOptions[Product]{})
+//
+// Handlers use the request's transaction (see middleware.Transaction) when
+// there is one. For a versioned model (see database.Repository) responses
+// carry an ETag and PUT, PATCH and DELETE check If-Match, see
+// CheckPrecondition.
+func Resource[T any](app *App, prefix string, repo database.Repository[T], opts ResourceOptions[T]) *Router {
+    rs := newResource(app, repo, opts)
+    router := app.Route(prefix)
+    router.middlewares = append(router.middlewares, opts.Middleware...)
+    routes := []struct {
+        action  ResourceAction
+        method  string
+        path    string
+        handler func(r *http.Request, res *Response)
+    }{
+        {ActionList, http.MethodGet, "/", rs.list},
+        {ActionGet, http.MethodGet, "/{id}", rs.get},
+        {ActionCreate, http.MethodPost, "/", rs.create},
+        {ActionUpdate, http.MethodPut, "/{id}", rs.update},
+        {ActionPatch, http.MethodPatch, "/{id}", rs.patch},
+        {ActionDelete, http.MethodDelete, "/{id}", rs.delete},
+    }
+    disabled := map[ResourceAction]bool{}
+    for _, action := range opts.Disable {
+        disabled[action] = true
+    }
+    for _, route := range routes {
+        if disabled[route.action] {
+            continue
+        }
+        handler := route.handler
+        if custom, ok := opts.Handlers[route.action]; ok {
+            handler = custom
+        }
+        router.With(opts.ActionMiddleware[route.action]...).registerRoute(route.path, route.method, handler)
+    }
+    return router
+}
+
+type resource[T any] struct {
+    app       *App
+    repo      database.Repository[T]
+    opts      ResourceOptions[T]
+    idKind    reflect.Kind
+    immutable map[string]bool
+}
+
+func newResource[T any](app *App, repo database.Repository[T], opts ResourceOptions[T]) *resource[T] {
+    var model T
+    modelType := reflect.TypeOf(model)
+    if opts.Name == "" {
+        opts.Name = modelType.Name()
+    }
+    if opts.Plural == "" {
+        opts.Plural = opts.Name + "s"
+    }
+    if opts.Fields == nil {
+        opts.Fields = database.FieldsOf(model)
+    }
+    if opts.IDField == "" {
+        opts.IDField = "id"
+    }
+    if opts.Immutable == nil {
+        opts.Immutable = []string{"created_at", "updated_at", "deleted_at", "version"}
+    }
+    rs := &resource[T]{app: app, repo: repo, opts: opts, idKind: reflect.String, immutable: map[string]bool{}}
+    for _, name := range opts.Immutable {
+        rs.immutable[name] = true
+    }
+    jsonFields(modelType, func(name string, field reflect.StructField) {
+        if name == opts.IDField {
+            rs.idKind = field.Type.Kind()
+        }
+    })
+    return rs
+}
+
+// repository returns the repository bound to the request's transaction, if
+// there is one, and the resource's repository otherwise
+func (rs *resource[T]) repository(r *http.Request) database.Repository[T] {
+    if tx, ok := requestTx(r); ok {
+        if repo, err := database.NewRepository[T](tx); err == nil {
+            return repo
+        }
+    }
+    return rs.repo
+}
+
+// parseID converts the {id} path variable to the type of the ID field
+func (rs *resource[T]) parseID(r *http.Request) (interface{}, error) {
+    raw := mux.Vars(r)["id"]
+    switch rs.idKind {
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        return strconv.ParseUint(raw, 10, 64)
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        return strconv.ParseInt(raw, 10, 64)
+    }
+    return raw, nil
+}
+
+func (rs *resource[T]) validate(entity *T) error {
+    if rs.opts.Validate != nil {
+        return rs.opts.Validate(entity)
+    }
+    if v, ok := interface{}(entity).(interface{ Validate() error }); ok {
+        return v.Validate()
+    }
+    return validate.Struct(entity)
+}
+
+// save validates entity and runs BeforeSave, responding and returning false
+// if either rejects it
+func (rs *resource[T]) save(r *http.Request, res *Response, entity, existing *T) bool {
+    if err := rs.validate(entity); err != nil {
+        res.Error(http.StatusBadRequest, "Validation failed: "+err.Error())
+        return false
+    }
+    if rs.opts.BeforeSave != nil {
+        if err := rs.opts.BeforeSave(r, entity, existing); err != nil {
+            var httpErr *HTTPError
+            if errors.As(err, &httpErr) {
+                res.Error(httpErr.Status, httpErr.Message)
+            } else {
+                res.Error(http.StatusBadRequest, err.Error())
+            }
+            return false
+        }
+    }
+    return true
+}
+
+// etag sets the ETag header if T is versioned
+func (rs *resource[T]) etag(res *Response, entity *T) {
+    if version, ok := database.VersionOf(entity); ok {
+        res.ETag(version)
+    }
+}
+
+// precondition checks If-Match against the stored entity if T is versioned,
+// responding and returning false if it fails
+func (rs *resource[T]) precondition(r *http.Request, res *Response, existing *T) bool {
+    version, ok := database.VersionOf(existing)
+    return !ok || rs.app.CheckPrecondition(r, res, version)
+}
+
+func (rs *resource[T]) list(r *http.Request, res *Response) {
+    opts, err := rs.app.ParseListOptions(r, rs.opts.Fields)
+    if err != nil {
+        res.Error(http.StatusBadRequest, err.Error())
+        return
+    }
+    if opts.IncludeDeleted && (rs.opts.AllowIncludeDeleted == nil || !rs.opts.AllowIncludeDeleted(r)) {
+        res.Error(http.StatusForbidden, "Not allowed to list deleted "+strings.ToLower(rs.opts.Plural))
+        return
+    }
+    // Cursors carry the id column, so other keys only get offset pagination
+    if opts.Cursor != nil && rs.opts.IDField != "id" {
+        res.Error(http.StatusBadRequest, rs.opts.Plural+" cannot be paged with cursors")
+        return
+    }
+    entities, total, err := rs.repository(r).List(r.Context(), opts)
+    if err != nil {
+        res.DBError(err, rs.opts.Name, "Failed to fetch "+strings.ToLower(rs.opts.Plural))
+        return
+    }
+    if rs.opts.IDField != "id" {
+        rs.app.PaginateOffset(res, r, rs.opts.Plural+" fetched successfully", entities, opts, total)
+        return
+    }
+    rs.app.Paginate(res, r, rs.opts.Plural+" fetched successfully", entities, opts, total)
+}
+
+func (rs *resource[T]) get(r *http.Request, res *Response) {
+    id, err := rs.parseID(r)
+    if err != nil {
+        res.Error(http.StatusBadRequest, "Invalid "+strings.ToLower(rs.opts.Name)+" ID")
+        return
+    }
+    entity, err := rs.repository(r).Get(r.Context(), id)
+    if err != nil {
+        res.DBError(err, rs.opts.Name, "Failed to fetch "+strings.ToLower(rs.opts.Name))
+        return
+    }
+    rs.etag(res, entity)
+    res.Success(rs.opts.Name+" fetched successfully", entity)
+}
+
+func (rs *resource[T]) create(r *http.Request, res *Response) {
+    var entity T
+    if err := rs.app.ParseBody(r, &entity); err != nil {
+        res.Error(http.StatusBadRequest, "Invalid request payload")
+        return
+    }
+    rs.keep(&entity, new(T), !rs.clientID())
+    if !rs.save(r, res, &entity, nil) {
+        return
+    }
+    if err := rs.repository(r).Create(r.Context(), &entity); err != nil {
+        res.DBError(err, rs.opts.Name, "Failed to create "+strings.ToLower(rs.opts.Name))
+        return
+    }
+    rs.etag(res, &entity)
+    var data interface{} = entity
+    if rs.opts.Created != nil {
+        data = rs.opts.Created(&entity)
+    }
+    res.Status(http.StatusCreated).Success(rs.opts.Name+" created successfully", data)
+}
+
+func (rs *resource[T]) update(r *http.Request, res *Response) {
+    id, err := rs.parseID(r)
+    if err != nil {
+        res.Error(http.StatusBadRequest, "Invalid "+strings.ToLower(rs.opts.Name)+" ID")
+        return
+    }
+    var entity T
+    if err := rs.app.ParseBody(r, &entity); err != nil {
+        res.Error(http.StatusBadRequest, "Invalid request payload")
+        return
+    }
+    repo := rs.repository(r)
+    existing, err := repo.Get(r.Context(), id)
+    if err != nil {
+        res.DBError(err, rs.opts.Name, "Failed to fetch "+strings.ToLower(rs.opts.Name))
+        return
+    }
+    if !rs.precondition(r, res, existing) {
+        return
+    }
+    rs.keep(&entity, existing, true)
+    rs.store(r, res, repo, id, &entity, existing)
+}
+
+func (rs *resource[T]) patch(r *http.Request, res *Response) {
+    id, err := rs.parseID(r)
+    if err != nil {
+        res.Error(http.StatusBadRequest, "Invalid "+strings.ToLower(rs.opts.Name)+" ID")
+        return
+    }
+    repo := rs.repository(r)
+    existing, err := repo.Get(r.Context(), id)
+    if err != nil {
+        res.DBError(err, rs.opts.Name, "Failed to fetch "+strings.ToLower(rs.opts.Name))
+        return
+    }
+    if !rs.precondition(r, res, existing) {
+        return
+    }
+    doc, err := json.Marshal(existing)
+    if err != nil {
+        res.Error(http.StatusInternalServerError, "Failed to encode "+strings.ToLower(rs.opts.Name))
+        return
+    }
+    patched, err := ApplyPatch(r, doc)
+    if err != nil {
+        res.PatchFailed(err)
+        return
+    }
+    var entity T
+    if err := json.Unmarshal(patched, &entity); err != nil {
+        res.Error(http.StatusBadRequest, "Invalid patch: "+err.Error())
+        return
+    }
+    rs.keep(&entity, existing, true)
+    rs.store(r, res, repo, id, &entity, existing)
+}
+
+// store writes the columns an update or a patch changed
+func (rs *resource[T]) store(r *http.Request, res *Response, repo database.Repository[T], id interface{}, entity, existing *T) {
+    if !rs.save(r, res, entity, existing) {
+        return
+    }
+    changes, err := database.Changes(existing, entity)
+    if err != nil {
+        res.Error(http.StatusInternalServerError, "Failed to update "+strings.ToLower(rs.opts.Name))
+        return
+    }
+    if len(changes) > 0 {
+        if err := repo.Patch(r.Context(), id, changes); err != nil {
+            res.DBError(err, rs.opts.Name, "Failed to update "+strings.ToLower(rs.opts.Name))
+            return
+        }
+    }
+    updated, err := repo.Get(r.Context(), id)
+    if err != nil {
+        res.DBError(err, rs.opts.Name, "Failed to fetch "+strings.ToLower(rs.opts.Name))
+        return
+    }
+    rs.etag(res, updated)
+    res.Success(rs.opts.Name+" updated successfully", updated)
+}
+
+func (rs *resource[T]) delete(r *http.Request, res *Response) {
+    id, err := rs.parseID(r)
+    if err != nil {
+        res.Error(http.StatusBadRequest, "Invalid "+strings.ToLower(rs.opts.Name)+" ID")
+        return
+    }
+    repo := rs.repository(r)
+    if _, versioned := database.VersionOf(new(T)); versioned {
+        existing, err := repo.Get(r.Context(), id)
+        if err != nil {
+            res.DBError(err, rs.opts.Name, "Failed to fetch "+strings.ToLower(rs.opts.Name))
+            return
+        }
+        if !rs.precondition(r, res, existing) {
+            return
+        }
+    }
+    if err := repo.Delete(r.Context(), id); err != nil {
+        res.DBError(err, rs.opts.Name, "Failed to delete "+strings.ToLower(rs.opts.Name))
+        return
+    }
+    res.Success(rs.opts.Name+" deleted successfully", nil)
+}
+
+// clientID reports whether clients choose the IDs, which is the case unless
+// they are numbers the database assigns
+func (rs *resource[T]) clientID() bool {
+    switch rs.idKind {
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+        reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        return false
+    }
+    return true
+}
+
+// keep copies the fields clients may not change from src to dst: the
+// immutable fields, the fields hidden from JSON and, if withID is set, the ID
+func (rs *resource[T]) keep(dst, src *T, withID bool) {
+    from := reflect.ValueOf(src).Elem()
+    to := reflect.ValueOf(dst).Elem()
+    var copyFields func(to, from reflect.Value)
+    copyFields = func(to, from reflect.Value) {
+        for i := 0; i < to.NumField(); i++ {
+            field := to.Type().Field(i)
+            if !field.IsExported() {
+                continue
+            }
+            name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+            if field.Anonymous && field.Type.Kind() == reflect.Struct && name == "" {
+                copyFields(to.Field(i), from.Field(i))
+                continue
+            }
+            if name == "" {
+                name = field.Name
+            }
+            if name == "-" || rs.immutable[name] || withID && name == rs.opts.IDField {
+                to.Field(i).Set(from.Field(i))
+            }
+        }
+    }
+    copyFields(to, from)
+}
+
+// jsonFields calls fn for each field of a struct type by JSON name, looking
+// into embedded structs
+func jsonFields(t reflect.Type, fn func(name string, field reflect.StructField)) {
+    if t.Kind() == reflect.Ptr {
+        t = t.Elem()
+    }
+    if t.Kind() != reflect.Struct {
+        return
+    }
+    for i := 0; i < t.NumField(); i++ {
+        field := t.Field(i)
+        name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+        if field.Anonymous && field.Type.Kind() == reflect.Struct && name == "" {
+            jsonFields(field.Type, fn)
+            continue
+        }
+        if !field.IsExported() || name == "-" {
+            continue
+        }
+        if name == "" {
+            name = field.Name
+        }
+        fn(name, field)
+    }
+}
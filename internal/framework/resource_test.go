@@ -0,0 +1,49 @@
+package framework
+
+import (
+    "context"
+    "errors"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "net/http"
+    "net/http/httptest"
+    "path/filepath"
+    "testing"
+)
+
+func TestResourceRepository(t *testing.T) {
+    app, err := NewApp(database.Config{Type: "sqlite-pure", FilePath: filepath.Join(t.TempDir(), "test.db")})
+    if err != nil {
+        t.Fatalf("NewApp: %v", err)
+    }
+    defer app.DB().Close()
+    repo, err := database.NewRepository[models.Webhook](app.DB())
+    if err != nil {
+        t.Fatal(err)
+    }
+    rs := newResource(app, repo, ResourceOptions[models.Webhook]{})
+    request := httptest.NewRequest(http.MethodGet, "/webhooks/", nil)
+    if rs.repository(request) != repo {
+        t.Error("a request without a transaction got a repository of its own")
+    }
+
+    // A request in a transaction writes through it
+    ctx := context.Background()
+    rollback := errors.New("rollback")
+    err = app.DB().WithTx(ctx, func(tx database.Database) error {
+        txRepo := rs.repository(WithRequestDB(request, tx))
+        if txRepo == repo {
+            t.Error("a request in a transaction got the resource's repository")
+        }
+        if err := txRepo.Create(ctx, &models.Webhook{URL: "http://a.test/"}); err != nil {
+            t.Fatal(err)
+        }
+        return rollback
+    })
+    if !errors.Is(err, rollback) {
+        t.Fatalf("WithTx error = %v", err)
+    }
+    if count, err := repo.Count(ctx, database.ListOptions{}); err != nil || count != 0 {
+        t.Errorf("%d webhooks after the rollback, %v, want the write rolled back", count, err)
+    }
+}
@@ -0,0 +1,37 @@
+package jobs
+
+import (
+    "context"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "log"
+    "time"
+)
+
+// IdempotencyExpiry removes expired idempotency records every Interval
+type IdempotencyExpiry struct {
+    DB       database.Database
+    Interval time.Duration
+}
+
+// Run removes expired records until ctx is done
+func (e IdempotencyExpiry) Run(ctx context.Context) {
+    interval := e.Interval
+    if interval <= 0 {
+        interval = time.Hour
+    }
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        purged, err := e.DB.PurgeIdempotencyRecords(ctx, time.Now())
+        if err != nil {
+            log.Printf("Idempotency: failed to purge expired records: %v", err)
+        } else if purged > 0 {
+            log.Printf("Idempotency: purged %d expired record(s)", purged)
+        }
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
@@ -0,0 +1,51 @@
+package jobs
+
+import (
+    "context"
+    "errors"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/framework"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestIdempotencyExpiry(t *testing.T) {
+    app, err := framework.NewApp(database.Config{Type: "sqlite-pure", FilePath: filepath.Join(t.TempDir(), "test.db")})
+    if err != nil {
+        t.Fatalf("NewApp: %v", err)
+    }
+    defer app.DB().Close()
+    ctx := context.Background()
+    now := time.Now()
+    for key, expiresAt := range map[string]time.Time{"expired": now.Add(-time.Minute), "live": now.Add(time.Hour)} {
+        record := &models.IdempotencyRecord{Scope: "user:1", Key: key, Status: 201, ExpiresAt: expiresAt}
+        if err := app.DB().CreateIdempotencyRecord(ctx, record); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    runCtx, cancel := context.WithCancel(ctx)
+    done := make(chan struct{})
+    go func() {
+        IdempotencyExpiry{DB: app.DB(), Interval: 10 * time.Millisecond}.Run(runCtx)
+        close(done)
+    }()
+    deadline := time.Now().Add(5 * time.Second)
+    for {
+        _, err := app.DB().GetIdempotencyRecord(ctx, "user:1", "expired")
+        if errors.Is(err, database.ErrNotFound) {
+            break
+        }
+        if time.Now().After(deadline) {
+            t.Fatalf("expired record still stored: %v", err)
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+    cancel()
+    <-done
+    if _, err := app.DB().GetIdempotencyRecord(ctx, "user:1", "live"); err != nil {
+        t.Errorf("live record: %v, want it kept", err)
+    }
+}
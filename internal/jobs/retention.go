@@ -0,0 +1,46 @@
+package jobs
+
+import (
+    "context"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "log"
+    "time"
+)
+
+// Retention purges users that have been soft deleted for longer than After,
+// checking every Interval
+type Retention struct {
+    DB       database.Database
+    After    time.Duration
+    Interval time.Duration
+}
+
+// Run purges expired users until ctx is done
+func (r Retention) Run(ctx context.Context) {
+    interval := r.Interval
+    if interval <= 0 {
+        interval = time.Hour
+    }
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        if _, err := r.Purge(ctx); err != nil {
+            log.Printf("Retention: failed to purge deleted users: %v", err)
+        }
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// Purge removes the users deleted more than After ago and returns how many
+// were removed
+func (r Retention) Purge(ctx context.Context) (int64, error) {
+    purged, err := r.DB.PurgeDeletedUsers(ctx, time.Now().Add(-r.After))
+    if purged > 0 {
+        log.Printf("Retention: purged %d user(s) deleted more than %s ago", purged, r.After)
+    }
+    return purged, err
+}
@@ -0,0 +1,367 @@
+package jobs
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "io"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+const (
+    DefaultWebhookMaxAttempts = 10
+    DefaultWebhookBackoff     = 30 * time.Second
+    DefaultWebhookMaxBackoff  = 6 * time.Hour
+    DefaultWebhookConcurrency = 10
+
+    // webhookBatch is the number of events and deliveries handled per round
+    webhookBatch = 100
+    // webhookLease is how long a claimed delivery is left to its dispatcher
+    // before another may send it, should the first one stop midway. It must
+    // exceed webhookTimeout, since a delivery is claimed right before it is
+    // sent.
+    webhookLease = 2 * time.Minute
+    // webhookTimeout bounds a single attempt, whatever the Client
+    webhookTimeout = 10 * time.Second
+)
+
+// WebhookDispatcher delivers the events in the outbox to the webhooks that
+// subscribe to them. Every Interval it queues a WebhookDelivery per webhook for
+// new events, then sends the deliveries that are due. A failed delivery is
+// retried after Backoff, doubled after every further failure up to
+// MaxBackoff, and is dead after MaxAttempts attempts. Up to Concurrency
+// webhooks are sent to at a time. Several dispatchers may run against the same
+// database.
+type WebhookDispatcher struct {
+    DB          database.Database
+    Client      *http.Client
+    Interval    time.Duration
+    MaxAttempts int
+    Backoff     time.Duration
+    MaxBackoff  time.Duration
+    Concurrency int
+}
+
+// Run dispatches until ctx is done
+func (d WebhookDispatcher) Run(ctx context.Context) {
+    interval := d.Interval
+    if interval <= 0 {
+        interval = 5 * time.Second
+    }
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        if err := d.Dispatch(ctx); err != nil {
+            log.Printf("Webhooks: failed to dispatch events: %v", err)
+        }
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// Dispatch queues the deliveries of new events and sends those that are due
+func (d WebhookDispatcher) Dispatch(ctx context.Context) error {
+    if err := d.queue(ctx); err != nil {
+        return err
+    }
+    return d.send(ctx)
+}
+
+// queue creates the deliveries of undispatched events and marks the events
+// dispatched, in one transaction per event
+func (d WebhookDispatcher) queue(ctx context.Context) error {
+    outbox, err := database.NewRepository[models.OutboxEvent](d.DB)
+    if err != nil {
+        return err
+    }
+    events, _, err := outbox.List(ctx, database.ListOptions{
+        Limit: webhookBatch,
+        Where: database.NotExpr{Expr: database.Filter{Field: "dispatched_at", Op: database.OpPresent}},
+    })
+    if err != nil || len(events) == 0 {
+        return err
+    }
+    webhooks, err := database.NewRepository[models.Webhook](d.DB)
+    if err != nil {
+        return err
+    }
+    hooks, _, err := webhooks.List(ctx, database.ListOptions{})
+    if err != nil {
+        return err
+    }
+    inTx := d.DB.WithTx
+    if !database.SupportsTx(d.DB) {
+        // Without transactions an event is marked first, so that a failure
+        // loses its deliveries rather than sending them twice
+        inTx = func(ctx context.Context, fn func(tx database.Database) error) error {
+            return fn(d.DB)
+        }
+    }
+    for _, event := range events {
+        err := inTx(ctx, func(tx database.Database) error {
+            outbox, err := database.NewRepository[models.OutboxEvent](tx)
+            if err != nil {
+                return err
+            }
+            // A stale version means another dispatcher queued the event
+            if err := outbox.Patch(ctx, event.ID, map[string]interface{}{"dispatched_at": time.Now(), "version": event.Version}); err != nil {
+                return err
+            }
+            var queued []*models.WebhookDelivery
+            for _, hook := range hooks {
+                if !hook.Paused && hook.Subscribes(event.Type) {
+                    queued = append(queued, &models.WebhookDelivery{
+                        WebhookID:     hook.ID,
+                        EventID:       event.ID,
+                        EventType:     event.Type,
+                        Status:        models.DeliveryPending,
+                        NextAttemptAt: time.Now(),
+                    })
+                }
+            }
+            if len(queued) == 0 {
+                return nil
+            }
+            deliveries, err := database.NewRepository[models.WebhookDelivery](tx)
+            if err != nil {
+                return err
+            }
+            for _, err := range deliveries.CreateMany(ctx, queued) {
+                if err != nil {
+                    return err
+                }
+            }
+            return nil
+        })
+        if err != nil && !errors.Is(err, database.ErrStale) {
+            return err
+        }
+    }
+    return nil
+}
+
+// send attempts the pending deliveries that are due, those of different
+// webhooks concurrently
+func (d WebhookDispatcher) send(ctx context.Context) error {
+    deliveries, err := database.NewRepository[models.WebhookDelivery](d.DB)
+    if err != nil {
+        return err
+    }
+    due, _, err := deliveries.List(ctx, database.ListOptions{
+        Limit: webhookBatch,
+        Sort:  []database.SortField{{Field: "next_attempt_at"}},
+        Filters: []database.Filter{
+            {Field: "status", Op: database.OpEq, Value: models.DeliveryPending},
+            {Field: "next_attempt_at", Op: database.OpLte, Value: time.Now()},
+        },
+    })
+    if err != nil {
+        return err
+    }
+    var webhookIDs []uint
+    queues := map[uint][]*models.WebhookDelivery{}
+    for i := range due {
+        id := due[i].WebhookID
+        if _, ok := queues[id]; !ok {
+            webhookIDs = append(webhookIDs, id)
+        }
+        queues[id] = append(queues[id], &due[i])
+    }
+    var wg sync.WaitGroup
+    var mu sync.Mutex
+    var firstErr error
+    slots := make(chan struct{}, d.concurrency())
+    for _, id := range webhookIDs {
+        slots <- struct{}{}
+        wg.Add(1)
+        go func(id uint, queue []*models.WebhookDelivery) {
+            defer func() {
+                <-slots
+                wg.Done()
+            }()
+            if err := d.sendQueue(ctx, deliveries, id, queue); err != nil {
+                mu.Lock()
+                if firstErr == nil {
+                    firstErr = err
+                }
+                mu.Unlock()
+            }
+        }(id, queues[id])
+    }
+    wg.Wait()
+    return firstErr
+}
+
+// sendQueue attempts the due deliveries of one webhook in order. After a
+// failed attempt the others wait for the next round, so that a slow endpoint
+// costs at most one timeout per round.
+func (d WebhookDispatcher) sendQueue(ctx context.Context, deliveries database.Repository[models.WebhookDelivery], webhookID uint, queue []*models.WebhookDelivery) error {
+    hook, err := d.webhook(ctx, webhookID)
+    if err != nil {
+        return err
+    }
+    for _, delivery := range queue {
+        // Claiming the delivery keeps other dispatchers off it for the lease
+        claim := map[string]interface{}{"next_attempt_at": time.Now().Add(webhookLease), "version": delivery.Version}
+        if err := deliveries.Patch(ctx, delivery.ID, claim); errors.Is(err, database.ErrStale) {
+            continue
+        } else if err != nil {
+            return err
+        }
+        delivery.Version++
+        // Deliveries of paused webhooks wait for the lease to run out
+        if hook != nil && hook.Paused {
+            continue
+        }
+        result := d.attempt(ctx, hook, delivery)
+        if err := deliveries.Patch(ctx, delivery.ID, result); err != nil && !errors.Is(err, database.ErrStale) {
+            return err
+        }
+        if hook != nil && result["status"] != models.DeliveryDelivered {
+            return nil
+        }
+    }
+    return nil
+}
+
+// webhook returns the webhook with the given ID, nil if it was deleted
+func (d WebhookDispatcher) webhook(ctx context.Context, id uint) (*models.Webhook, error) {
+    webhooks, err := database.NewRepository[models.Webhook](d.DB)
+    if err != nil {
+        return nil, err
+    }
+    hook, err := webhooks.Get(ctx, id)
+    if errors.Is(err, database.ErrNotFound) {
+        return nil, nil
+    }
+    return hook, err
+}
+
+// attempt sends a claimed delivery and returns the columns recording how it
+// went
+func (d WebhookDispatcher) attempt(ctx context.Context, hook *models.Webhook, delivery *models.WebhookDelivery) map[string]interface{} {
+    result := map[string]interface{}{"attempts": delivery.Attempts + 1, "version": delivery.Version}
+    fail := func(status int, message string) map[string]interface{} {
+        result["response_status"] = status
+        result["last_error"] = message
+        if delivery.Attempts+1 >= d.maxAttempts() || hook == nil {
+            result["status"] = models.DeliveryDead
+        } else {
+            result["next_attempt_at"] = time.Now().Add(d.backoff(delivery.Attempts + 1))
+        }
+        return result
+    }
+    if hook == nil {
+        return fail(0, "webhook was deleted")
+    }
+    outbox, err := database.NewRepository[models.OutboxEvent](d.DB)
+    if err != nil {
+        return fail(0, err.Error())
+    }
+    event, err := outbox.Get(ctx, delivery.EventID)
+    if err != nil {
+        return fail(0, "failed to read event: "+err.Error())
+    }
+    body, err := event.Body()
+    if err != nil {
+        return fail(0, "failed to encode event: "+err.Error())
+    }
+    ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+    defer cancel()
+    request, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+    if err != nil {
+        return fail(0, err.Error())
+    }
+    request.Header.Set("Content-Type", "application/json")
+    request.Header.Set("X-Webhook-ID", strconv.FormatUint(uint64(event.ID), 10))
+    request.Header.Set("X-Webhook-Event", event.Type)
+    request.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+    request.Header.Set("X-Webhook-Signature", SignWebhook(hook.Secret, time.Now(), body))
+    response, err := d.client().Do(request)
+    if err != nil {
+        return fail(0, err.Error())
+    }
+    defer response.Body.Close()
+    excerpt, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+    if response.StatusCode < 200 || response.StatusCode > 299 {
+        return fail(response.StatusCode, strings.TrimSpace(fmt.Sprintf("HTTP %d: %s", response.StatusCode, excerpt)))
+    }
+    result["status"] = models.DeliveryDelivered
+    result["response_status"] = response.StatusCode
+    result["last_error"] = ""
+    result["delivered_at"] = time.Now()
+    return result
+}
+
+func (d WebhookDispatcher) client() *http.Client {
+    if d.Client != nil {
+        return d.Client
+    }
+    return defaultWebhookClient
+}
+
+// defaultWebhookClient does not follow redirects, which count as failures
+var defaultWebhookClient = &http.Client{
+    Timeout: webhookTimeout,
+    CheckRedirect: func(*http.Request, []*http.Request) error {
+        return http.ErrUseLastResponse
+    },
+}
+
+func (d WebhookDispatcher) concurrency() int {
+    if d.Concurrency <= 0 {
+        return DefaultWebhookConcurrency
+    }
+    return d.Concurrency
+}
+
+func (d WebhookDispatcher) maxAttempts() int {
+    if d.MaxAttempts <= 0 {
+        return DefaultWebhookMaxAttempts
+    }
+    return d.MaxAttempts
+}
+
+// backoff returns the wait after the given number of failed attempts
+func (d WebhookDispatcher) backoff(attempts int) time.Duration {
+    wait, limit := d.Backoff, d.MaxBackoff
+    if wait <= 0 {
+        wait = DefaultWebhookBackoff
+    }
+    if limit <= 0 {
+        limit = DefaultWebhookMaxBackoff
+    }
+    for i := 1; i < attempts && wait < limit; i++ {
+        wait *= 2
+    }
+    if wait > limit {
+        wait = limit
+    }
+    return wait
+}
+
+// SignWebhook returns the X-Webhook-Signature of a body sent at the given
+// time: t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>" keyed with the
+// webhook secret>. Receivers recompute v1 to check the body came from us, and
+// reject old t to stop replays.
+func SignWebhook(secret string, at time.Time, body []byte) string {
+    timestamp := strconv.FormatInt(at.Unix(), 10)
+    mac := hmac.New(sha256.New, []byte(secret))
+    io.WriteString(mac, timestamp+".")
+    mac.Write(body)
+    return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,122 @@
+package jobs
+
+import (
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/framework"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+)
+
+// verifySignature checks a signature header the way the README tells
+// receivers to
+func verifySignature(secret, header string, body []byte) (time.Time, bool) {
+    var t, v1 string
+    for _, part := range strings.Split(header, ",") {
+        key, value, _ := strings.Cut(part, "=")
+        switch key {
+        case "t":
+            t = value
+        case "v1":
+            v1 = value
+        }
+    }
+    unix, err := strconv.ParseInt(t, 10, 64)
+    if err != nil {
+        return time.Time{}, false
+    }
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write([]byte(t + "." + string(body)))
+    return time.Unix(unix, 0), hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(v1))
+}
+
+func TestSignWebhook(t *testing.T) {
+    at := time.Unix(1700000000, 0)
+    body := []byte(`{"type":"user.created"}`)
+    want := "t=1700000000,v1=2309b3241c934edd598182cd8af8663e23a4ed93bae9e076fbd3e8df8202253b"
+    if got := SignWebhook("whsec_test", at, body); got != want {
+        t.Fatalf("SignWebhook = %s, want %s", got, want)
+    }
+    if signedAt, ok := verifySignature("whsec_test", want, body); !ok || !signedAt.Equal(at) {
+        t.Errorf("signature does not verify: %v, %v", signedAt, ok)
+    }
+
+    tests := map[string]struct {
+        secret string
+        at     time.Time
+        body   string
+    }{
+        "other secret":    {"whsec_other", at, `{"type":"user.created"}`},
+        "other time":      {"whsec_test", at.Add(time.Second), `{"type":"user.created"}`},
+        "other body":      {"whsec_test", at, `{"type":"user.deleted"}`},
+        "whitespace only": {"whsec_test", at, `{"type": "user.created"}`},
+    }
+    for name, test := range tests {
+        if SignWebhook(test.secret, test.at, []byte(test.body)) == want {
+            t.Errorf("%s: signature did not change", name)
+        }
+    }
+}
+
+func TestDispatchSignsDeliveries(t *testing.T) {
+    type received struct {
+        header http.Header
+        body   []byte
+    }
+    requests := make(chan received, 10)
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := io.ReadAll(r.Body)
+        requests <- received{r.Header, body}
+    }))
+    defer server.Close()
+
+    app, err := framework.NewApp(database.Config{Type: "sqlite-pure", FilePath: filepath.Join(t.TempDir(), "test.db")})
+    if err != nil {
+        t.Fatalf("NewApp: %v", err)
+    }
+    defer app.DB().Close()
+    ctx := context.Background()
+    webhooks, err := database.NewRepository[models.Webhook](app.DB())
+    if err != nil {
+        t.Fatal(err)
+    }
+    hook := &models.Webhook{URL: server.URL, Secret: "whsec_0123456789abcdef"}
+    if err := webhooks.Create(ctx, hook); err != nil {
+        t.Fatal(err)
+    }
+    if err := app.DB().CreateUser(ctx, models.NewUser("Ann", "ann@example.com")); err != nil {
+        t.Fatal(err)
+    }
+
+    start := time.Now().Truncate(time.Second)
+    if err := (WebhookDispatcher{DB: app.DB()}).Dispatch(ctx); err != nil {
+        t.Fatalf("Dispatch: %v", err)
+    }
+    var request received
+    select {
+    case request = <-requests:
+    default:
+        t.Fatal("no delivery was sent")
+    }
+    if request.header.Get("X-Webhook-Event") != models.EventUserCreated {
+        t.Errorf("X-Webhook-Event = %q", request.header.Get("X-Webhook-Event"))
+    }
+    signature := request.header.Get("X-Webhook-Signature")
+    signedAt, ok := verifySignature(hook.Secret, signature, request.body)
+    if !ok {
+        t.Fatalf("X-Webhook-Signature %q does not verify over %s", signature, request.body)
+    }
+    if signedAt.Before(start) || signedAt.After(time.Now()) {
+        t.Errorf("signed at %v, want the time of sending", signedAt)
+    }
+}
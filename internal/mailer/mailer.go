@@ -0,0 +1,33 @@
+package mailer
+
+import (
+    "context"
+    "log"
+)
+
+type Message struct {
+    To      string
+    Subject string
+    Body    string
+}
+
+// Mailer is the hook the API uses to notify users by email. Plug in an SMTP or
+// provider-backed implementation with App.SetMailer.
+type Mailer interface {
+    Send(ctx context.Context, msg Message) error
+}
+
+// Func adapts a plain function to the Mailer interface
+type Func func(ctx context.Context, msg Message) error
+
+func (f Func) Send(ctx context.Context, msg Message) error {
+    return f(ctx, msg)
+}
+
+// LogMailer writes messages to the log instead of sending them
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+    log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+    return nil
+}
@@ -0,0 +1,167 @@
+package middleware
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/auth"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/framework"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/utils"
+    "io"
+    "log"
+    "net/http"
+    "time"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// Idempotency makes unsafe requests sent with an Idempotency-Key header safe
+// to retry. The first request with a key runs as usual and its response is
+// stored for app.IdempotencyTTL(); later requests with the key get that
+// response replayed, marked with Idempotent-Replayed: true. Reusing a key for a
+// different method, URL or body answers 422, and a retry that arrives while
+// the first request is still running answers 409. Server errors are not
+// stored, so a request that failed with one can be retried.
+//
+// Keys are scoped to the authenticated user, so Idempotency must run after
+// Auth or OptionalAuth, or to the client for anonymous requests.
+func Idempotency(app *framework.App) func(http.HandlerFunc) http.HandlerFunc {
+    return func(next http.HandlerFunc) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+            key := r.Header.Get("Idempotency-Key")
+            switch {
+            case key == "", r.Method == http.MethodGet, r.Method == http.MethodHead, r.Method == http.MethodOptions:
+                next(w, r)
+                return
+            case len(key) > maxIdempotencyKeyLength:
+                framework.NewResponse(w).Error(http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+                return
+            }
+            body, err := io.ReadAll(r.Body)
+            if err != nil {
+                framework.NewResponse(w).Error(http.StatusBadRequest, "Failed to read request body")
+                return
+            }
+            r.Body = io.NopCloser(bytes.NewReader(body))
+
+            record := &models.IdempotencyRecord{
+                Scope:       idempotencyScope(r),
+                Key:         key,
+                Fingerprint: requestFingerprint(r, body),
+                ExpiresAt:   time.Now().Add(app.IdempotencyTTL()),
+            }
+            stored, err := claimIdempotencyKey(app, record)
+            switch {
+            case err != nil:
+                log.Printf("Error storing idempotency key: %v", err)
+                framework.NewResponse(w).DBError(err, "Idempotency key", "Failed to store idempotency key")
+            case stored == nil:
+                runIdempotent(app, record, next, w, r)
+            case stored.Fingerprint != record.Fingerprint:
+                framework.NewResponse(w).Error(http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+            case stored.Status == 0:
+                w.Header().Set("Retry-After", "1")
+                framework.NewResponse(w).Error(http.StatusConflict, "A request with this Idempotency-Key is still being processed")
+            default:
+                replayIdempotent(w, stored)
+            }
+        }
+    }
+}
+
+// idempotencyScope keeps the keys of different users apart. Anonymous
+// requests are scoped to the client IP and the X-Client-ID header, a random
+// ID the client keeps per installation, hashed to fit the scope column.
+func idempotencyScope(r *http.Request) string {
+    claims, ok := auth.ClaimsFromContext(r.Context())
+    switch {
+    case !ok:
+        client := sha256.Sum256([]byte(utils.ClientIP(r) + "\n" + r.Header.Get("X-Client-ID")))
+        return "anonymous:" + hex.EncodeToString(client[:])
+    case claims.Impersonating():
+        return "user:" + claims.Subject + ":" + claims.Act.Subject
+    }
+    return "user:" + claims.Subject
+}
+
+// requestFingerprint identifies a request by its method, URL and body
+func requestFingerprint(r *http.Request, body []byte) string {
+    hash := sha256.New()
+    io.WriteString(hash, r.Method+" "+r.URL.RequestURI()+"\n")
+    hash.Write(body)
+    return hex.EncodeToString(hash.Sum(nil))
+}
+
+// claimIdempotencyKey stores record as in progress if its key is new or its
+// stored record expired. It returns the stored record instead when the key is
+// in use.
+func claimIdempotencyKey(app *framework.App, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+    var err error
+    for attempt := 0; attempt < 3; attempt++ {
+        err = app.DB().CreateIdempotencyRecord(app.Context(), record)
+        if !errors.Is(err, database.ErrConflict) {
+            return nil, err
+        }
+        stored, getErr := app.DB().GetIdempotencyRecord(app.Context(), record.Scope, record.Key)
+        switch {
+        case errors.Is(getErr, database.ErrNotFound):
+            continue
+        case getErr != nil:
+            return nil, getErr
+        case stored.ExpiresAt.After(time.Now()):
+            return stored, nil
+        }
+        if _, err := app.DB().PurgeIdempotencyRecords(app.Context(), time.Now()); err != nil {
+            return nil, err
+        }
+    }
+    return nil, err
+}
+
+// runIdempotent runs the request for a claimed key and stores its response.
+// The key is released instead when the handler fails with a server error or
+// panics, or the response cannot be stored, so that the client can retry.
+func runIdempotent(app *framework.App, record *models.IdempotencyRecord, next http.HandlerFunc, w http.ResponseWriter, r *http.Request) {
+    saved := false
+    defer func() {
+        if saved {
+            return
+        }
+        if err := app.DB().DeleteIdempotencyRecord(app.Context(), record.Scope, record.Key); err != nil {
+            log.Printf("Error releasing idempotency key: %v", err)
+        }
+    }()
+    buffer := &bufferedWriter{header: http.Header{}}
+    next(buffer, r)
+    if buffer.status == 0 {
+        buffer.status = http.StatusOK
+    }
+    if buffer.status < http.StatusInternalServerError {
+        headers, _ := json.Marshal(buffer.header)
+        record.Status = buffer.status
+        record.Headers = string(headers)
+        record.Body = buffer.body.String()
+        if err := app.DB().SaveIdempotencyRecord(app.Context(), record); err != nil {
+            log.Printf("Error storing response for idempotency key: %v", err)
+        } else {
+            saved = true
+        }
+    }
+    buffer.flush(w)
+}
+
+// replayIdempotent writes a stored response
+func replayIdempotent(w http.ResponseWriter, record *models.IdempotencyRecord) {
+    var headers http.Header
+    json.Unmarshal([]byte(record.Headers), &headers)
+    for key, values := range headers {
+        w.Header()[key] = values
+    }
+    w.Header().Set("Idempotent-Replayed", "true")
+    w.WriteHeader(record.Status)
+    io.WriteString(w, record.Body)
+}
@@ -0,0 +1,201 @@
+package middleware
+
+import (
+    "github.com/Mohammad007/GoExpressRestAPI/internal/auth"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/framework"
+    "net/http"
+    "net/http/httptest"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+func newTestApp(t *testing.T) *framework.App {
+    t.Helper()
+    app, err := framework.NewApp(database.Config{Type: "sqlite-pure", FilePath: filepath.Join(t.TempDir(), "test.db")})
+    if err != nil {
+        t.Fatalf("NewApp: %v", err)
+    }
+    t.Cleanup(func() { app.DB().Close() })
+    return app
+}
+
+// idempotencyTest wraps a handler that answers 201 with the number of times
+// it ran, or status when that is set
+type idempotencyTest struct {
+    handler http.HandlerFunc
+    calls   int32
+    status  int32
+}
+
+func newIdempotencyTest(app *framework.App) *idempotencyTest {
+    test := &idempotencyTest{}
+    test.handler = Idempotency(app)(func(w http.ResponseWriter, r *http.Request) {
+        calls := atomic.AddInt32(&test.calls, 1)
+        status := int(atomic.LoadInt32(&test.status))
+        if status == 0 {
+            status = http.StatusCreated
+        }
+        w.Header().Set("X-Call", strconv.Itoa(int(calls)))
+        w.WriteHeader(status)
+        w.Write([]byte(`{"call":` + strconv.Itoa(int(calls)) + `}`))
+    })
+    return test
+}
+
+// post sends body with an Idempotency-Key of key from the client at ip
+func (test *idempotencyTest) post(key, body, ip string, claims *auth.Claims) *httptest.ResponseRecorder {
+    request := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+    request.Header.Set("Idempotency-Key", key)
+    request.RemoteAddr = ip + ":40000"
+    if claims != nil {
+        request = request.WithContext(auth.WithClaims(request.Context(), claims))
+    }
+    recorder := httptest.NewRecorder()
+    test.handler(recorder, request)
+    return recorder
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+    test := newIdempotencyTest(newTestApp(t))
+    first := test.post("key-1", `{"name":"Ann"}`, "10.0.0.1", nil)
+    if first.Code != http.StatusCreated || first.Header().Get("Idempotent-Replayed") != "" {
+        t.Fatalf("first request: status %d, replayed %q", first.Code, first.Header().Get("Idempotent-Replayed"))
+    }
+    replay := test.post("key-1", `{"name":"Ann"}`, "10.0.0.1", nil)
+    if replay.Code != http.StatusCreated || replay.Body.String() != first.Body.String() || replay.Header().Get("X-Call") != "1" {
+        t.Errorf("replay: status %d, body %s, X-Call %q, want the first response", replay.Code, replay.Body, replay.Header().Get("X-Call"))
+    }
+    if replay.Header().Get("Idempotent-Replayed") != "true" {
+        t.Error("replay is not marked Idempotent-Replayed")
+    }
+    if test.calls != 1 {
+        t.Errorf("handler ran %d times, want once", test.calls)
+    }
+
+    // Another key runs the handler again
+    if code := test.post("key-2", `{"name":"Ann"}`, "10.0.0.1", nil).Code; code != http.StatusCreated || test.calls != 2 {
+        t.Errorf("other key: status %d after %d calls, want a second call", code, test.calls)
+    }
+
+    // Server errors are not stored, so a retry runs the handler
+    test.status = http.StatusInternalServerError
+    test.post("key-3", `{}`, "10.0.0.1", nil)
+    test.status = 0
+    if retry := test.post("key-3", `{}`, "10.0.0.1", nil); retry.Code != http.StatusCreated || retry.Header().Get("Idempotent-Replayed") != "" {
+        t.Errorf("retry after a server error: status %d, replayed %q, want the handler to run", retry.Code, retry.Header().Get("Idempotent-Replayed"))
+    }
+}
+
+func TestIdempotencyMismatch(t *testing.T) {
+    test := newIdempotencyTest(newTestApp(t))
+    test.post("key-1", `{"name":"Ann"}`, "10.0.0.1", nil)
+    if code := test.post("key-1", `{"name":"Bob"}`, "10.0.0.1", nil).Code; code != http.StatusUnprocessableEntity {
+        t.Errorf("other body: status %d, want 422", code)
+    }
+    request := httptest.NewRequest(http.MethodPut, "/users", strings.NewReader(`{"name":"Ann"}`))
+    request.Header.Set("Idempotency-Key", "key-1")
+    request.RemoteAddr = "10.0.0.1:40000"
+    recorder := httptest.NewRecorder()
+    test.handler(recorder, request)
+    if recorder.Code != http.StatusUnprocessableEntity {
+        t.Errorf("other method: status %d, want 422", recorder.Code)
+    }
+    if test.calls != 1 {
+        t.Errorf("handler ran %d times, want once", test.calls)
+    }
+    if code := test.post(strings.Repeat("k", maxIdempotencyKeyLength+1), `{}`, "10.0.0.1", nil).Code; code != http.StatusBadRequest {
+        t.Errorf("long key: status %d, want 400", code)
+    }
+}
+
+func TestIdempotencyInFlight(t *testing.T) {
+    app := newTestApp(t)
+    started := make(chan struct{})
+    release := make(chan struct{})
+    handler := Idempotency(app)(func(w http.ResponseWriter, r *http.Request) {
+        close(started)
+        <-release
+        w.WriteHeader(http.StatusCreated)
+    })
+    post := func() *httptest.ResponseRecorder {
+        request := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{}`))
+        request.Header.Set("Idempotency-Key", "key-1")
+        recorder := httptest.NewRecorder()
+        handler(recorder, request)
+        return recorder
+    }
+    done := make(chan *httptest.ResponseRecorder)
+    go func() { done <- post() }()
+    <-started
+    retry := post()
+    if retry.Code != http.StatusConflict || retry.Header().Get("Retry-After") != "1" {
+        t.Errorf("retry in flight: status %d, Retry-After %q, want 409 after 1 second", retry.Code, retry.Header().Get("Retry-After"))
+    }
+    close(release)
+    if first := <-done; first.Code != http.StatusCreated {
+        t.Errorf("first request: status %d", first.Code)
+    }
+    if replay := post(); replay.Code != http.StatusCreated || replay.Header().Get("Idempotent-Replayed") != "true" {
+        t.Errorf("after the first request: status %d, replayed %q, want a replay", replay.Code, replay.Header().Get("Idempotent-Replayed"))
+    }
+}
+
+func TestIdempotencyExpiry(t *testing.T) {
+    app := newTestApp(t)
+    app.SetIdempotencyTTL(-time.Second)
+    test := newIdempotencyTest(app)
+    test.post("key-1", `{"name":"Ann"}`, "10.0.0.1", nil)
+    // An expired key is claimed again, even for another request
+    second := test.post("key-1", `{"name":"Bob"}`, "10.0.0.1", nil)
+    if second.Code != http.StatusCreated || second.Header().Get("X-Call") != "2" {
+        t.Errorf("expired key: status %d, X-Call %q, want the handler to run again", second.Code, second.Header().Get("X-Call"))
+    }
+}
+
+func TestIdempotencyScope(t *testing.T) {
+    test := newIdempotencyTest(newTestApp(t))
+    ann := &auth.Claims{Subject: "1"}
+    bob := &auth.Claims{Subject: "2"}
+    impersonated := &auth.Claims{Subject: "1", Act: &auth.Actor{Subject: "1000"}}
+    test.post("key-1", `{"n":1}`, "10.0.0.1", ann)
+
+    // The same key from anyone else is a new request
+    for i, claims := range []*auth.Claims{bob, impersonated, nil} {
+        if recorder := test.post("key-1", `{"n":2}`, "10.0.0.1", claims); recorder.Code != http.StatusCreated || recorder.Header().Get("Idempotent-Replayed") != "" {
+            t.Errorf("client %d: status %d, replayed %q, want a request of its own", i, recorder.Code, recorder.Header().Get("Idempotent-Replayed"))
+        }
+    }
+    if code := test.post("key-1", `{"n":2}`, "10.0.0.1", ann).Code; code != http.StatusUnprocessableEntity {
+        t.Errorf("same user: status %d, want 422", code)
+    }
+
+    // Anonymous clients are told apart by IP and X-Client-ID
+    anonymous := func(ip, clientID string) *httptest.ResponseRecorder {
+        request := httptest.NewRequest(http.MethodPost, "/auth/register", strings.NewReader(`{"n":3}`))
+        request.Header.Set("Idempotency-Key", "key-2")
+        request.Header.Set("X-Client-ID", clientID)
+        request.RemoteAddr = ip + ":40000"
+        recorder := httptest.NewRecorder()
+        test.handler(recorder, request)
+        return recorder
+    }
+    anonymous("10.0.0.1", "install-a")
+    tests := []struct {
+        name, ip, clientID string
+        replayed           string
+    }{
+        {"same client", "10.0.0.1", "install-a", "true"},
+        {"other installation", "10.0.0.1", "install-b", ""},
+        {"other IP", "10.0.0.2", "install-a", ""},
+    }
+    for _, tt := range tests {
+        if got := anonymous(tt.ip, tt.clientID).Header().Get("Idempotent-Replayed"); got != tt.replayed {
+            t.Errorf("%s: Idempotent-Replayed = %q, want %q", tt.name, got, tt.replayed)
+        }
+    }
+}
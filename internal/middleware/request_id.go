@@ -0,0 +1,26 @@
+package middleware
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/utils"
+    "net/http"
+    "regexp"
+)
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID tags every request with an ID, reusing a well-formed X-Request-ID
+// sent by the client, and echoes it in the response
+func RequestID(next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        id := r.Header.Get("X-Request-ID")
+        if !validRequestID.MatchString(id) {
+            b := make([]byte, 16)
+            rand.Read(b)
+            id = hex.EncodeToString(b)
+        }
+        w.Header().Set("X-Request-ID", id)
+        next(w, r.WithContext(utils.WithRequestID(r.Context(), id)))
+    }
+}
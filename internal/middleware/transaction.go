@@ -0,0 +1,82 @@
+package middleware
+
+import (
+    "bytes"
+    "errors"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/framework"
+    "log"
+    "net/http"
+)
+
+var errRollback = errors.New("rollback requested by response status")
+
+// Transaction runs each unsafe request (POST, PUT, PATCH, DELETE) in a database
+// transaction that handlers reach through app.RequestDB(r). The transaction is
+// committed when the handler responds with a status below 400 and rolled back
+// otherwise. The response is buffered until the outcome is known, so clients
+// never see a success for writes that failed to commit.
+func Transaction(app *framework.App) func(http.HandlerFunc) http.HandlerFunc {
+    return func(next http.HandlerFunc) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+            switch r.Method {
+            case http.MethodGet, http.MethodHead, http.MethodOptions:
+                next(w, r)
+                return
+            }
+            buffer := &bufferedWriter{header: http.Header{}}
+            err := app.DB().WithTx(r.Context(), func(tx database.Database) error {
+                next(buffer, framework.WithRequestDB(r, tx))
+                if buffer.status >= http.StatusBadRequest {
+                    return errRollback
+                }
+                return nil
+            })
+            if errors.Is(err, database.ErrTxUnsupported) {
+                framework.NewResponse(w).DBError(err, "", "")
+                return
+            }
+            if err != nil && err != errRollback {
+                log.Printf("Error committing transaction: %v", err)
+                framework.NewResponse(w).Error(http.StatusInternalServerError, "Failed to commit transaction")
+                return
+            }
+            buffer.flush(w)
+        }
+    }
+}
+
+// bufferedWriter holds a response until the transaction has finished
+type bufferedWriter struct {
+    header http.Header
+    status int
+    body   bytes.Buffer
+}
+
+func (b *bufferedWriter) Header() http.Header {
+    return b.header
+}
+
+func (b *bufferedWriter) WriteHeader(status int) {
+    if b.status == 0 {
+        b.status = status
+    }
+}
+
+func (b *bufferedWriter) Write(p []byte) (int, error) {
+    if b.status == 0 {
+        b.status = http.StatusOK
+    }
+    return b.body.Write(p)
+}
+
+func (b *bufferedWriter) flush(w http.ResponseWriter) {
+    for key, values := range b.header {
+        w.Header()[key] = values
+    }
+    if b.status == 0 {
+        b.status = http.StatusOK
+    }
+    w.WriteHeader(b.status)
+    w.Write(b.body.Bytes())
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+    "context"
+    "errors"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "testing"
+)
+
+func TestTransaction(t *testing.T) {
+    app := newTestApp(t)
+    ctx := context.Background()
+    tests := []struct {
+        method    string
+        status    int
+        committed bool
+    }{
+        {http.MethodPost, http.StatusCreated, true},
+        {http.MethodDelete, 0, true},
+        {http.MethodPut, http.StatusBadRequest, false},
+        {http.MethodPatch, http.StatusConflict, false},
+        {http.MethodPost, http.StatusInternalServerError, false},
+    }
+    for i, test := range tests {
+        email := "user" + strconv.Itoa(i) + "@example.com"
+        handler := Transaction(app)(func(w http.ResponseWriter, r *http.Request) {
+            if err := app.RequestDB(r).CreateUser(r.Context(), models.NewUser("Ann", email)); err != nil {
+                t.Fatal(err)
+            }
+            // The write is visible inside the transaction
+            if _, err := app.RequestDB(r).GetUserByEmail(r.Context(), email); err != nil {
+                t.Errorf("%s %d: user not found in the transaction: %v", test.method, test.status, err)
+            }
+            if test.status != 0 {
+                w.WriteHeader(test.status)
+            }
+            w.Write([]byte("done"))
+        })
+        recorder := httptest.NewRecorder()
+        handler(recorder, httptest.NewRequest(test.method, "/users", nil))
+
+        want := test.status
+        if want == 0 {
+            want = http.StatusOK
+        }
+        if recorder.Code != want || recorder.Body.String() != "done" {
+            t.Errorf("%s %d: response %d %q, want the handler's", test.method, test.status, recorder.Code, recorder.Body)
+        }
+        _, err := app.DB().GetUserByEmail(ctx, email)
+        if test.committed && err != nil {
+            t.Errorf("%s %d: user not committed: %v", test.method, test.status, err)
+        }
+        if !test.committed && !errors.Is(err, database.ErrNotFound) {
+            t.Errorf("%s %d: user not rolled back: %v", test.method, test.status, err)
+        }
+    }
+
+    // Safe requests run without a transaction, so nothing is rolled back
+    handler := Transaction(app)(func(w http.ResponseWriter, r *http.Request) {
+        if err := app.RequestDB(r).CreateUser(r.Context(), models.NewUser("Ann", "get@example.com")); err != nil {
+            t.Fatal(err)
+        }
+        w.WriteHeader(http.StatusBadRequest)
+    })
+    handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+    if _, err := app.DB().GetUserByEmail(ctx, "get@example.com"); err != nil {
+        t.Errorf("GET: %v, want the write kept", err)
+    }
+}
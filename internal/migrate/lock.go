@@ -0,0 +1,107 @@
+package migrate
+
+import (
+    "context"
+    "errors"
+    "gorm.io/gorm"
+    "gorm.io/gorm/logger"
+    "time"
+)
+
+const (
+    lockName = "schema_migrations"
+    // lockKey is an arbitrary Postgres advisory lock key reserved for migrations
+    lockKey = 7283946012
+    // staleLockAfter is when a table lock left behind by a crashed process is broken
+    staleLockAfter   = 10 * time.Minute
+    lockPollInterval = 500 * time.Millisecond
+)
+
+var ErrLockTimeout = errors.New("timed out waiting for the migration lock")
+
+// migrationLock is the single-row lock table used by dialects without
+// advisory locks, such as SQLite
+type migrationLock struct {
+    ID       int    `gorm:"primaryKey;autoIncrement:false"`
+    Owner    string `gorm:"type:varchar(255)"`
+    LockedAt time.Time
+}
+
+func (migrationLock) TableName() string {
+    return "schema_migrations_lock"
+}
+
+type lock struct {
+    conn  *gorm.DB
+    owner string
+}
+
+func newLock(conn *gorm.DB, owner string) *lock {
+    return &lock{conn: conn, owner: owner}
+}
+
+func (l *lock) acquire(ctx context.Context, timeout time.Duration) error {
+    deadline := time.Now().Add(timeout)
+    if l.conn.Dialector.Name() == "mysql" {
+        var acquired int
+        err := l.conn.Raw("SELECT GET_LOCK(?, ?)", lockName, int(timeout.Seconds())).Scan(&acquired).Error
+        if err != nil {
+            return err
+        }
+        if acquired != 1 {
+            return ErrLockTimeout
+        }
+        return nil
+    }
+    if l.conn.Dialector.Name() != "postgres" {
+        if !l.conn.Migrator().HasTable(&migrationLock{}) {
+            if err := l.conn.Migrator().CreateTable(&migrationLock{}); err != nil && !l.conn.Migrator().HasTable(&migrationLock{}) {
+                return err
+            }
+        }
+    }
+    for {
+        acquired, err := l.try()
+        if err != nil {
+            return err
+        }
+        if acquired {
+            return nil
+        }
+        if time.Now().After(deadline) {
+            return ErrLockTimeout
+        }
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-time.After(lockPollInterval):
+        }
+    }
+}
+
+func (l *lock) try() (bool, error) {
+    if l.conn.Dialector.Name() == "postgres" {
+        var acquired bool
+        err := l.conn.Raw("SELECT pg_try_advisory_lock(?)", lockKey).Scan(&acquired).Error
+        return acquired, err
+    }
+    stale := time.Now().UTC().Add(-staleLockAfter)
+    if err := l.conn.Where("id = 1 AND locked_at < ?", stale).Delete(&migrationLock{}).Error; err != nil {
+        return false, err
+    }
+    // A held lock makes the insert fail with a constraint error, which is expected
+    quiet := l.conn.Session(&gorm.Session{Logger: l.conn.Logger.LogMode(logger.Silent)})
+    err := quiet.Create(&migrationLock{ID: 1, Owner: l.owner, LockedAt: time.Now().UTC()}).Error
+    return err == nil, nil
+}
+
+func (l *lock) release() {
+    switch l.conn.Dialector.Name() {
+    case "mysql":
+        l.conn.Exec("SELECT RELEASE_LOCK(?)", lockName)
+    case "postgres":
+        l.conn.Exec("SELECT pg_advisory_unlock(?)", lockKey)
+    default:
+        l.conn.Where("id = 1 AND owner = ?", l.owner).Delete(&migrationLock{})
+    }
+}
@@ -0,0 +1,303 @@
+package migrate
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "gorm.io/gorm"
+    "io/fs"
+    "os"
+    "sort"
+    "strconv"
+    "time"
+)
+
+// Migration is a single schema change. It is either a pair of SQL scripts or a
+// pair of Go functions; Go functions take precedence when both are set.
+type Migration struct {
+    Version int64
+    Name    string
+    UpSQL   string
+    DownSQL string
+    Up      func(tx *gorm.DB) error
+    Down    func(tx *gorm.DB) error
+    // Revision stands in for the content of a Go migration, whose code cannot
+    // be checksummed. Bump it whenever Up changes.
+    Revision int
+}
+
+// Checksum identifies the content of the up migration so that edits to an
+// already applied migration can be detected. Go migrations are identified by
+// their name and Revision only.
+func (m Migration) Checksum() string {
+    content := m.UpSQL
+    if m.Up != nil {
+        content = "go:" + m.Name
+        if m.Revision != 0 {
+            content += ":" + strconv.Itoa(m.Revision)
+        }
+    }
+    sum := sha256.Sum256([]byte(content))
+    return hex.EncodeToString(sum[:])
+}
+
+// schemaMigration is a row of the schema_migrations table
+type schemaMigration struct {
+    Version   int64  `gorm:"primaryKey;autoIncrement:false"`
+    Name      string `gorm:"type:varchar(255)"`
+    Checksum  string `gorm:"type:varchar(64)"`
+    AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+    return "schema_migrations"
+}
+
+type Status struct {
+    Version   int64
+    Name      string
+    Applied   bool
+    AppliedAt *time.Time
+    // Modified is set when an applied migration no longer matches its checksum
+    Modified bool
+    // Missing is set when an applied migration is no longer known to the source
+    Missing bool
+}
+
+var ErrChecksumMismatch = errors.New("migration has been modified after it was applied")
+
+// Migrator applies migrations loaded from one subdirectory per SQL dialect
+// (mysql, postgres, sqlite) of fsys plus any registered Go migrations
+type Migrator struct {
+    db          *gorm.DB
+    fsys        fs.FS
+    dir         string
+    registered  []Migration
+    LockTimeout time.Duration
+    Logf        func(format string, args ...interface{})
+}
+
+func New(db *gorm.DB, fsys fs.FS, dir string) *Migrator {
+    return &Migrator{
+        db:          db,
+        fsys:        fsys,
+        dir:         dir,
+        LockTimeout: time.Minute,
+        Logf:        func(string, ...interface{}) {},
+    }
+}
+
+// Register adds migrations written as Go functions
+func (m *Migrator) Register(migrations ...Migration) {
+    m.registered = append(m.registered, migrations...)
+}
+
+func (m *Migrator) Dialect() string {
+    return m.db.Dialector.Name()
+}
+
+// Migrations returns every known migration for the current dialect in version order
+func (m *Migrator) Migrations() ([]Migration, error) {
+    var migrations []Migration
+    if m.fsys != nil {
+        loaded, err := Load(m.fsys, m.dir+"/"+m.Dialect())
+        if err != nil && !errors.Is(err, fs.ErrNotExist) {
+            return nil, err
+        }
+        migrations = append(migrations, loaded...)
+    }
+    migrations = append(migrations, m.registered...)
+    sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+    for i := 1; i < len(migrations); i++ {
+        if migrations[i].Version == migrations[i-1].Version {
+            return nil, fmt.Errorf("duplicate migration version %d", migrations[i].Version)
+        }
+    }
+    return migrations, nil
+}
+
+// Up applies pending migrations, at most limit of them when limit > 0, and
+// returns how many were applied
+func (m *Migrator) Up(ctx context.Context, limit int) (int, error) {
+    count := 0
+    err := m.locked(ctx, func(tx *gorm.DB) error {
+        migrations, applied, err := m.load(tx)
+        if err != nil {
+            return err
+        }
+        for _, migration := range migrations {
+            if record, ok := applied[migration.Version]; ok {
+                if record.Checksum != migration.Checksum() {
+                    return fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, migration.Version, migration.Name)
+                }
+                continue
+            }
+            if limit > 0 && count >= limit {
+                break
+            }
+            m.Logf("Applying migration %d_%s", migration.Version, migration.Name)
+            if err := m.apply(tx, migration); err != nil {
+                return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+            }
+            count++
+        }
+        return nil
+    })
+    return count, err
+}
+
+// Down rolls back the most recently applied migrations, steps of them, and
+// returns how many were rolled back
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+    count := 0
+    err := m.locked(ctx, func(tx *gorm.DB) error {
+        migrations, applied, err := m.load(tx)
+        if err != nil {
+            return err
+        }
+        for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+            migration := migrations[i]
+            if _, ok := applied[migration.Version]; !ok {
+                continue
+            }
+            if migration.Down == nil && migration.DownSQL == "" {
+                return fmt.Errorf("migration %d_%s cannot be rolled back", migration.Version, migration.Name)
+            }
+            m.Logf("Rolling back migration %d_%s", migration.Version, migration.Name)
+            if err := m.revert(tx, migration); err != nil {
+                return fmt.Errorf("rollback of %d_%s failed: %w", migration.Version, migration.Name, err)
+            }
+            count++
+        }
+        return nil
+    })
+    return count, err
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+    tx := m.db.WithContext(ctx)
+    if err := ensureTable(tx); err != nil {
+        return nil, err
+    }
+    migrations, applied, err := m.load(tx)
+    if err != nil {
+        return nil, err
+    }
+    var statuses []Status
+    for _, migration := range migrations {
+        status := Status{Version: migration.Version, Name: migration.Name}
+        if record, ok := applied[migration.Version]; ok {
+            appliedAt := record.AppliedAt
+            status.Applied = true
+            status.AppliedAt = &appliedAt
+            status.Modified = record.Checksum != migration.Checksum()
+            delete(applied, migration.Version)
+        }
+        statuses = append(statuses, status)
+    }
+    for _, record := range applied {
+        appliedAt := record.AppliedAt
+        statuses = append(statuses, Status{Version: record.Version, Name: record.Name, Applied: true, AppliedAt: &appliedAt, Missing: true})
+    }
+    sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+    return statuses, nil
+}
+
+func (m *Migrator) load(tx *gorm.DB) ([]Migration, map[int64]schemaMigration, error) {
+    migrations, err := m.Migrations()
+    if err != nil {
+        return nil, nil, err
+    }
+    var records []schemaMigration
+    if err := tx.Find(&records).Error; err != nil {
+        return nil, nil, err
+    }
+    applied := make(map[int64]schemaMigration, len(records))
+    for _, record := range records {
+        applied[record.Version] = record
+    }
+    return migrations, applied, nil
+}
+
+func (m *Migrator) apply(db *gorm.DB, migration Migration) error {
+    return db.Transaction(func(tx *gorm.DB) error {
+        var err error
+        if migration.Up != nil {
+            err = migration.Up(tx)
+        } else if migration.UpSQL != "" {
+            err = m.exec(tx, migration.UpSQL)
+        }
+        if err != nil {
+            return err
+        }
+        return tx.Create(&schemaMigration{
+            Version:   migration.Version,
+            Name:      migration.Name,
+            Checksum:  migration.Checksum(),
+            AppliedAt: time.Now().UTC(),
+        }).Error
+    })
+}
+
+func (m *Migrator) revert(db *gorm.DB, migration Migration) error {
+    return db.Transaction(func(tx *gorm.DB) error {
+        var err error
+        if migration.Down != nil {
+            err = migration.Down(tx)
+        } else {
+            err = m.exec(tx, migration.DownSQL)
+        }
+        if err != nil {
+            return err
+        }
+        return tx.Where("version = ?", migration.Version).Delete(&schemaMigration{}).Error
+    })
+}
+
+// exec runs a SQL script. MySQL only takes several statements at once on
+// connections with multiStatements, which the application's connections do
+// not enable, so scripts are run there one statement at a time.
+func (m *Migrator) exec(tx *gorm.DB, script string) error {
+    if m.Dialect() != "mysql" {
+        return tx.Exec(script).Error
+    }
+    for _, statement := range splitStatements(script) {
+        if err := tx.Exec(statement).Error; err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func ensureTable(tx *gorm.DB) error {
+    if tx.Migrator().HasTable(&schemaMigration{}) {
+        return nil
+    }
+    return tx.Migrator().CreateTable(&schemaMigration{})
+}
+
+// locked runs fn on a single connection while holding the migration lock, so
+// that concurrently starting instances do not migrate at the same time
+func (m *Migrator) locked(ctx context.Context, fn func(tx *gorm.DB) error) error {
+    return m.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+        // Start a fresh session on the pinned connection so that chained
+        // queries do not share conditions
+        conn = conn.Session(&gorm.Session{})
+        lock := newLock(conn, lockOwner())
+        if err := lock.acquire(ctx, m.LockTimeout); err != nil {
+            return err
+        }
+        defer lock.release()
+        if err := ensureTable(conn); err != nil {
+            return err
+        }
+        return fn(conn)
+    })
+}
+
+func lockOwner() string {
+    host, _ := os.Hostname()
+    return fmt.Sprintf("%s:%d:%d", host, os.Getpid(), time.Now().UnixNano())
+}
@@ -0,0 +1,240 @@
+package migrate
+
+import (
+    "context"
+    "errors"
+    "github.com/glebarez/sqlite"
+    "gorm.io/gorm"
+    "gorm.io/gorm/logger"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+    "testing/fstest"
+    "time"
+)
+
+func testMigrator(t *testing.T, fsys fstest.MapFS) *Migrator {
+    t.Helper()
+    db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() {
+        if sqlDB, err := db.DB(); err == nil {
+            sqlDB.Close()
+        }
+    })
+    migrator := New(db, fsys, "migrations")
+    migrator.LockTimeout = 100 * time.Millisecond
+    return migrator
+}
+
+func testMigrations() fstest.MapFS {
+    return fstest.MapFS{
+        "migrations/sqlite/1_create_items.up.sql":   {Data: []byte("CREATE TABLE items (id INTEGER PRIMARY KEY)")},
+        "migrations/sqlite/1_create_items.down.sql": {Data: []byte("DROP TABLE items")},
+        "migrations/sqlite/2_add_name.up.sql":       {Data: []byte("ALTER TABLE items ADD COLUMN name TEXT")},
+        "migrations/sqlite/2_add_name.down.sql":     {Data: []byte("ALTER TABLE items DROP COLUMN name")},
+        "migrations/sqlite/README.md":               {Data: []byte("not a migration")},
+    }
+}
+
+func TestUpAndDown(t *testing.T) {
+    ctx := context.Background()
+    migrator := testMigrator(t, testMigrations())
+    if applied, err := migrator.Up(ctx, 1); err != nil || applied != 1 {
+        t.Fatalf("Up(1) = %d, %v, want 1 migration", applied, err)
+    }
+    if applied, err := migrator.Up(ctx, 0); err != nil || applied != 1 {
+        t.Fatalf("Up(0) = %d, %v, want the remaining migration", applied, err)
+    }
+    if applied, err := migrator.Up(ctx, 0); err != nil || applied != 0 {
+        t.Fatalf("Up(0) again = %d, %v, want nothing to apply", applied, err)
+    }
+    if !migrator.db.Migrator().HasColumn("items", "name") {
+        t.Fatal("items.name was not added")
+    }
+    if rolledBack, err := migrator.Down(ctx, 1); err != nil || rolledBack != 1 {
+        t.Fatalf("Down(1) = %d, %v", rolledBack, err)
+    }
+    statuses, err := migrator.Status(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(statuses) != 2 || !statuses[0].Applied || statuses[1].Applied {
+        t.Errorf("statuses = %+v, want only the first migration applied", statuses)
+    }
+}
+
+func TestChecksumMismatch(t *testing.T) {
+    ctx := context.Background()
+    fsys := testMigrations()
+    migrator := testMigrator(t, fsys)
+    if _, err := migrator.Up(ctx, 1); err != nil {
+        t.Fatal(err)
+    }
+    fsys["migrations/sqlite/1_create_items.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT)")}
+
+    applied, err := migrator.Up(ctx, 0)
+    if !errors.Is(err, ErrChecksumMismatch) {
+        t.Fatalf("Up error = %v, want ErrChecksumMismatch", err)
+    }
+    if applied != 0 || migrator.db.Migrator().HasColumn("items", "name") {
+        t.Error("Up applied migrations after a checksum mismatch")
+    }
+    statuses, err := migrator.Status(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !statuses[0].Modified || statuses[1].Modified {
+        t.Errorf("statuses = %+v, want the first migration modified", statuses)
+    }
+
+    // A migration dropped from the source is reported as missing
+    delete(fsys, "migrations/sqlite/1_create_items.up.sql")
+    delete(fsys, "migrations/sqlite/1_create_items.down.sql")
+    if statuses, err = migrator.Status(ctx); err != nil {
+        t.Fatal(err)
+    }
+    if len(statuses) != 2 || !statuses[0].Missing {
+        t.Errorf("statuses = %+v, want the first migration missing", statuses)
+    }
+}
+
+func TestGoMigrationChecksum(t *testing.T) {
+    ctx := context.Background()
+    migrator := testMigrator(t, nil)
+    backfill := Migration{Version: 1, Name: "backfill", Up: func(tx *gorm.DB) error {
+        return tx.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY)").Error
+    }}
+    migrator.Register(backfill)
+    if _, err := migrator.Up(ctx, 0); err != nil {
+        t.Fatal(err)
+    }
+
+    // The code of a Go migration is not checksummed, so a change to Up alone
+    // goes unnoticed
+    edited := backfill
+    edited.Up = func(tx *gorm.DB) error { return errors.New("never runs") }
+    migrator.registered = []Migration{edited}
+    if applied, err := migrator.Up(ctx, 0); err != nil || applied != 0 {
+        t.Fatalf("Up with an edited Go migration = %d, %v, want nothing applied", applied, err)
+    }
+
+    // Bumping the revision marks it as modified
+    edited.Revision = 2
+    migrator.registered = []Migration{edited}
+    if _, err := migrator.Up(ctx, 0); !errors.Is(err, ErrChecksumMismatch) {
+        t.Fatalf("Up error = %v, want ErrChecksumMismatch after a new revision", err)
+    }
+    statuses, err := migrator.Status(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(statuses) != 1 || !statuses[0].Modified {
+        t.Errorf("statuses = %+v, want the Go migration modified", statuses)
+    }
+}
+
+func TestLock(t *testing.T) {
+    ctx := context.Background()
+    migrator := testMigrator(t, testMigrations())
+    if err := migrator.db.Migrator().CreateTable(&migrationLock{}); err != nil {
+        t.Fatal(err)
+    }
+    held := &migrationLock{ID: 1, Owner: "other", LockedAt: time.Now().UTC()}
+    if err := migrator.db.Create(held).Error; err != nil {
+        t.Fatal(err)
+    }
+    if _, err := migrator.Up(ctx, 0); !errors.Is(err, ErrLockTimeout) {
+        t.Fatalf("Up error = %v, want ErrLockTimeout while another owner holds the lock", err)
+    }
+    if _, err := migrator.Down(ctx, 1); !errors.Is(err, ErrLockTimeout) {
+        t.Fatalf("Down error = %v, want ErrLockTimeout while another owner holds the lock", err)
+    }
+
+    // A lock left behind by a crashed process is broken once it is stale
+    stale := time.Now().UTC().Add(-2 * staleLockAfter)
+    if err := migrator.db.Model(held).Update("locked_at", stale).Error; err != nil {
+        t.Fatal(err)
+    }
+    if applied, err := migrator.Up(ctx, 0); err != nil || applied != 2 {
+        t.Fatalf("Up = %d, %v, want the stale lock broken", applied, err)
+    }
+    var count int64
+    if err := migrator.db.Model(&migrationLock{}).Count(&count).Error; err != nil || count != 0 {
+        t.Errorf("%d locks left after Up, %v, want the lock released", count, err)
+    }
+}
+
+func TestSplitStatements(t *testing.T) {
+    tests := []struct {
+        script string
+        want   []string
+    }{
+        {"CREATE TABLE a (id INT);\nCREATE TABLE b (id INT);\n", []string{"CREATE TABLE a (id INT)", "CREATE TABLE b (id INT)"}},
+        {"ALTER TABLE users DROP COLUMN version", []string{"ALTER TABLE users DROP COLUMN version"}},
+        {"INSERT INTO a VALUES ('x;y', 'it''s;', \"q;\", 'back\\';slash');", []string{"INSERT INTO a VALUES ('x;y', 'it''s;', \"q;\", 'back\\';slash')"}},
+        {"CREATE TABLE `a;b` (id INT);", []string{"CREATE TABLE `a;b` (id INT)"}},
+        {"-- drop; it\nDROP TABLE a; # done; really\n/* a; b */ DROP TABLE b;", []string{"-- drop; it\nDROP TABLE a", "# done; really\n/* a; b */ DROP TABLE b"}},
+        {"DROP TABLE a;\n-- trailing comment;\n", []string{"DROP TABLE a"}},
+        {" ; ;\n", nil},
+    }
+    for _, test := range tests {
+        if got := splitStatements(test.script); !reflect.DeepEqual(got, test.want) {
+            t.Errorf("splitStatements(%q) = %q, want %q", test.script, got, test.want)
+        }
+    }
+
+    // Every embedded MySQL migration splits into statements without a
+    // leftover empty one
+    migrations, err := Load(os.DirFS("../database"), "migrations/mysql")
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, migration := range migrations {
+        for _, script := range []string{migration.UpSQL, migration.DownSQL} {
+            for _, statement := range splitStatements(script) {
+                if statement == "" || strings.HasSuffix(statement, ";") {
+                    t.Errorf("%d_%s: bad statement %q", migration.Version, migration.Name, statement)
+                }
+            }
+        }
+    }
+}
+
+func TestLoad(t *testing.T) {
+    tests := map[string]struct {
+        files fstest.MapFS
+        valid bool
+    }{
+        "pairs": {testMigrations(), true},
+        "up only": {fstest.MapFS{
+            "migrations/sqlite/1_create_items.up.sql": {Data: []byte("CREATE TABLE items (id INTEGER)")},
+        }, true},
+        "down only": {fstest.MapFS{
+            "migrations/sqlite/1_create_items.down.sql": {Data: []byte("DROP TABLE items")},
+        }, false},
+        "conflicting names": {fstest.MapFS{
+            "migrations/sqlite/1_create_items.up.sql":    {Data: []byte("CREATE TABLE items (id INTEGER)")},
+            "migrations/sqlite/1_create_things.down.sql": {Data: []byte("DROP TABLE things")},
+        }, false},
+    }
+    for name, test := range tests {
+        _, err := Load(test.files, "migrations/sqlite")
+        if test.valid && err != nil {
+            t.Errorf("%s: Load: %v", name, err)
+        }
+        if !test.valid && err == nil {
+            t.Errorf("%s: Load succeeded, want an error", name)
+        }
+    }
+
+    migrator := testMigrator(t, testMigrations())
+    migrator.Register(Migration{Version: 2, Name: "duplicate", Up: func(*gorm.DB) error { return nil }})
+    if _, err := migrator.Migrations(); err == nil {
+        t.Error("Migrations accepted two migrations with the same version")
+    }
+}
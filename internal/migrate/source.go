@@ -0,0 +1,127 @@
+package migrate
+
+import (
+    "fmt"
+    "io/fs"
+    "os"
+    "path"
+    "path/filepath"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// fileName matches {version}_{name}.up.sql and {version}_{name}.down.sql
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Load reads the SQL migrations in dir. Files without a matching name are ignored.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+    entries, err := fs.ReadDir(fsys, dir)
+    if err != nil {
+        return nil, err
+    }
+    byVersion := map[int64]*Migration{}
+    for _, entry := range entries {
+        match := fileName.FindStringSubmatch(entry.Name())
+        if entry.IsDir() || match == nil {
+            continue
+        }
+        version, err := strconv.ParseInt(match[1], 10, 64)
+        if err != nil {
+            return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+        }
+        content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+        if err != nil {
+            return nil, err
+        }
+        migration, ok := byVersion[version]
+        if !ok {
+            migration = &Migration{Version: version, Name: match[2]}
+            byVersion[version] = migration
+        }
+        if migration.Name != match[2] {
+            return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, migration.Name, match[2])
+        }
+        if match[3] == "up" {
+            migration.UpSQL = string(content)
+        } else {
+            migration.DownSQL = string(content)
+        }
+    }
+    var migrations []Migration
+    for _, migration := range byVersion {
+        if migration.UpSQL == "" {
+            return nil, fmt.Errorf("migration %d_%s has no up script", migration.Version, migration.Name)
+        }
+        migrations = append(migrations, *migration)
+    }
+    return migrations, nil
+}
+
+// Create writes an empty up/down script pair for a new migration in every
+// dialect subdirectory of dir and returns the created file paths
+func Create(dir, name string, dialects []string) ([]string, error) {
+    name = strings.Trim(regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(strings.ToLower(name), "_"), "_")
+    if name == "" {
+        return nil, fmt.Errorf("migration name is required")
+    }
+    version := time.Now().UTC().Format("20060102150405")
+    var created []string
+    for _, dialect := range dialects {
+        if err := os.MkdirAll(filepath.Join(dir, dialect), 0755); err != nil {
+            return nil, err
+        }
+        for _, direction := range []string{"up", "down"} {
+            file := filepath.Join(dir, dialect, fmt.Sprintf("%s_%s.%s.sql", version, name, direction))
+            content := fmt.Sprintf("-- %s migration %s_%s (%s)\n", direction, version, name, dialect)
+            if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+                return nil, err
+            }
+            created = append(created, file)
+        }
+    }
+    return created, nil
+}
+
+// splitStatements splits a SQL script at the semicolons that end its
+// statements, skipping those in quotes and comments. Statements holding only
+// comments are dropped. Compound statements such as MySQL triggers cannot be
+// split this way and belong in Go migrations.
+func splitStatements(script string) []string {
+    var statements []string
+    start, code := 0, false
+    for i := 0; i < len(script); i++ {
+        switch c := script[i]; {
+        case c == '\'' || c == '"' || c == '`':
+            for i++; i < len(script) && script[i] != c; i++ {
+                if script[i] == '\\' && c != '`' {
+                    i++
+                }
+            }
+            code = true
+        case c == '#' || strings.HasPrefix(script[i:], "-- "):
+            for i < len(script) && script[i] != '\n' {
+                i++
+            }
+        case strings.HasPrefix(script[i:], "/*"):
+            end := strings.Index(script[i+2:], "*/")
+            if end < 0 {
+                i = len(script)
+            } else {
+                i += end + 3
+            }
+        case c == ';':
+            if code {
+                statements = append(statements, strings.TrimSpace(script[start:i]))
+            }
+            start, code = i+1, false
+        case c != ' ' && c != '\t' && c != '\n' && c != '\r':
+            code = true
+        }
+    }
+    if code {
+        statements = append(statements, strings.TrimSpace(script[start:]))
+    }
+    return statements
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+    "database/sql/driver"
+    "encoding/json"
+    "fmt"
+    "time"
+)
+
+const (
+    AuditImpersonationStart   = "impersonation.start"
+    AuditImpersonationRequest = "impersonation.request"
+    AuditUserCreate           = "user.create"
+    AuditUserUpdate           = "user.update"
+    AuditUserDelete           = "user.delete"
+    AuditUserRestore          = "user.restore"
+    AuditUserPurge            = "user.purge"
+)
+
+// Actors recorded for writes that were not made by an authenticated user
+const (
+    AuditActorSystem    = "system"
+    AuditActorAnonymous = "anonymous"
+)
+
+// AuditEntry records a security relevant action. ActorID is the user the
+// action was performed as; ImpersonatorID is set when an admin acted on
+// behalf of that user. Changes holds the fields a user.* action changed.
+type AuditEntry struct {
+    ID             uint         `json:"id" gorm:"primaryKey" bson:"id"`
+    Action         string       `json:"action" gorm:"type:varchar(50);index" bson:"action"`
+    ActorID        string       `json:"actor_id" gorm:"type:varchar(50);index" bson:"actor_id"`
+    ImpersonatorID string       `json:"impersonator_id,omitempty" gorm:"type:varchar(50);index" bson:"impersonator_id,omitempty"`
+    Resource       string       `json:"resource" gorm:"type:varchar(50)" bson:"resource"`
+    ResourceID     string       `json:"resource_id" gorm:"type:varchar(50);index" bson:"resource_id"`
+    RequestID      string       `json:"request_id" gorm:"type:varchar(64)" bson:"request_id"`
+    Details        string       `json:"details" gorm:"type:text" bson:"details"`
+    Changes        AuditChanges `json:"changes,omitempty" gorm:"type:text" bson:"changes,omitempty"`
+    CreatedAt      time.Time    `json:"created_at" gorm:"autoCreateTime;index" bson:"created_at"`
+}
+
+// AuditChange is the value of a field before and after a write. Before is
+// nil for a created record and After for a removed one.
+type AuditChange struct {
+    Before interface{} `json:"before" bson:"before"`
+    After  interface{} `json:"after" bson:"after"`
+}
+
+// AuditChanges maps the fields a write changed to their values. SQL backends
+// store it as JSON text.
+type AuditChanges map[string]AuditChange
+
+func (c AuditChanges) Value() (driver.Value, error) {
+    if c == nil {
+        return nil, nil
+    }
+    data, err := json.Marshal(c)
+    return string(data), err
+}
+
+func (c *AuditChanges) Scan(value interface{}) error {
+    switch v := value.(type) {
+    case nil:
+        *c = nil
+        return nil
+    case string:
+        return json.Unmarshal([]byte(v), c)
+    case []byte:
+        return json.Unmarshal(v, c)
+    }
+    return fmt.Errorf("cannot scan %T into AuditChanges", value)
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+    "time"
+)
+
+// IdempotencyRecord stores the response to a request sent with an
+// Idempotency-Key, so that retries of the request get the same response.
+// Status is 0 while the first request is still being handled.
+type IdempotencyRecord struct {
+    ID          uint      `json:"-" gorm:"primaryKey" bson:"-"`
+    Scope       string    `json:"scope" gorm:"uniqueIndex:idx_idempotency_records_scope_key;type:varchar(100)" bson:"scope"`
+    Key         string    `json:"key" gorm:"column:idempotency_key;uniqueIndex:idx_idempotency_records_scope_key;type:varchar(255)" bson:"key"`
+    Fingerprint string    `json:"fingerprint" gorm:"type:varchar(64)" bson:"fingerprint"`
+    Status      int       `json:"status" bson:"status"`
+    Headers     string    `json:"headers" bson:"headers"`
+    Body        string    `json:"body" bson:"body"`
+    CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime" bson:"created_at"`
+    ExpiresAt   time.Time `json:"expires_at" gorm:"index" bson:"expires_at"`
+}
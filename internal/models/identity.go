@@ -0,0 +1,15 @@
+package models
+
+import (
+    "time"
+)
+
+// Identity links a user to an account at an external OpenID Connect provider
+type Identity struct {
+    ID        uint      `json:"id" gorm:"primaryKey" bson:"id"`
+    UserID    uint      `json:"user_id" gorm:"index" bson:"user_id"`
+    Provider  string    `json:"provider" gorm:"uniqueIndex:idx_identities_provider_subject;type:varchar(50)" bson:"provider"`
+    Subject   string    `json:"subject" gorm:"uniqueIndex:idx_identities_provider_subject;type:varchar(255)" bson:"subject"`
+    Email     string    `json:"email" gorm:"type:varchar(100)" bson:"email"`
+    CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime" bson:"created_at"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+    "time"
+)
+
+const (
+    LoginScopeAccount = "account"
+    LoginScopeIP      = "ip"
+)
+
+// LoginAttempt tracks consecutive failed logins for an account (keyed by
+// email) or a client IP
+type LoginAttempt struct {
+    ID            uint       `json:"-" gorm:"primaryKey" bson:"-"`
+    Scope         string     `json:"scope" gorm:"uniqueIndex:idx_login_attempts_scope_identifier;type:varchar(20)" bson:"scope"`
+    Identifier    string     `json:"identifier" gorm:"uniqueIndex:idx_login_attempts_scope_identifier;type:varchar(255)" bson:"identifier"`
+    Failures      int        `json:"failures" bson:"failures"`
+    LastFailureAt time.Time  `json:"last_failure_at" bson:"last_failure_at"`
+    LockedUntil   *time.Time `json:"locked_until" bson:"locked_until"`
+    UpdatedAt     time.Time  `json:"updated_at" gorm:"autoUpdateTime" bson:"updated_at"`
+}
+
+// RetryAfter returns how long the identifier is still blocked at the given time
+func (a *LoginAttempt) RetryAfter(now time.Time) time.Duration {
+    if a.LockedUntil == nil || !now.Before(*a.LockedUntil) {
+        return 0
+    }
+    return a.LockedUntil.Sub(now)
+}
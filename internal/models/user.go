@@ -6,25 +6,42 @@ import (
     "time"
 )
 
+const (
+    RoleUser  = "user"
+    RoleAdmin = "admin"
+)
+
 type UserSchema struct {
-    ID        uint       `json:"id" gorm:"primaryKey" bson:"id"`
-    Name      string     `json:"name" validate:"required,min=2" gorm:"type:varchar(100)" bson:"name"`
-    Email     string     `json:"email" validate:"required,email" gorm:"unique;type:varchar(100)" bson:"email"`
-    CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime" bson:"created_at"`
-    UpdatedAt time.Time  `json:"updated_at" gorm:"autoUpdateTime" bson:"updated_at"`
-    DeletedAt *time.Time `json:"deleted_at" gorm:"index" bson:"deleted_at"`
+    ID           uint       `json:"id" gorm:"primaryKey" bson:"id"`
+    Name         string     `json:"name" validate:"required,min=2" gorm:"type:varchar(100)" bson:"name"`
+    Email        string     `json:"email" validate:"required,email" gorm:"unique;type:varchar(100)" bson:"email"`
+    Role         string     `json:"role" validate:"omitempty,oneof=user admin" gorm:"type:varchar(20);default:user" bson:"role"`
+    Password     string     `json:"password,omitempty" validate:"omitempty,min=8" gorm:"-" bson:"-"`
+    PasswordHash string     `json:"-" gorm:"type:varchar(255)" bson:"password_hash"`
+    CreatedAt    time.Time  `json:"created_at" gorm:"autoCreateTime" bson:"created_at"`
+    UpdatedAt    time.Time  `json:"updated_at" gorm:"autoUpdateTime" bson:"updated_at"`
+    DeletedAt    *time.Time `json:"deleted_at" gorm:"index" bson:"deleted_at"`
+    // Version counts the writes to the user, see database.Repository
+    Version uint `json:"version" gorm:"not null;default:1" bson:"version"`
+    // CurrentPassword must accompany a new Password on updates
+    CurrentPassword string `json:"current_password,omitempty" gorm:"-" bson:"-"`
 }
 
 type User struct {
-    UserSchema
-    validator *validator.Validate
+    UserSchema `bson:",inline"`
+    validator  *validator.Validate
 }
 
+// validate is used for users that were decoded from a request or loaded from
+// the database rather than built with NewUser
+var validate = validator.New()
+
 func NewUser(name, email string) *User {
     user := &User{
         UserSchema: UserSchema{
             Name:      name,
             Email:     email,
+            Role:      RoleUser,
             CreatedAt: time.Now(),
             UpdatedAt: time.Now(),
         },
@@ -34,9 +51,12 @@ func NewUser(name, email string) *User {
 }
 
 func (u *User) Validate() error {
+    if u.validator == nil {
+        return validate.Struct(u)
+    }
     return u.validator.Struct(u)
 }
 
 func (u *User) BeforeCreate(tx *gorm.DB) error {
     return u.Validate()
-}
\ No newline at end of file
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+    "database/sql/driver"
+    "encoding/json"
+    "fmt"
+    "strings"
+    "time"
+)
+
+// Event types announced to webhooks
+const (
+    EventUserCreated = "user.created"
+    EventUserUpdated = "user.updated"
+    EventUserDeleted = "user.deleted"
+)
+
+// Delivery states. A pending delivery is retried until it succeeds or runs
+// out of attempts and becomes dead.
+const (
+    DeliveryPending   = "pending"
+    DeliveryDelivered = "delivered"
+    DeliveryDead      = "dead"
+)
+
+// OutboxEvent is a domain event, written in the transaction of the change it
+// announces. DispatchedAt is set once a delivery was queued for every webhook
+// that subscribes to it.
+type OutboxEvent struct {
+    ID           uint       `json:"id" gorm:"primaryKey" bson:"id"`
+    Type         string     `json:"type" gorm:"type:varchar(50)" bson:"type"`
+    ResourceID   string     `json:"resource_id" gorm:"type:varchar(50)" bson:"resource_id"`
+    Data         string     `json:"-" gorm:"type:text" bson:"data"`
+    CreatedAt    time.Time  `json:"created_at" gorm:"autoCreateTime" bson:"created_at"`
+    DispatchedAt *time.Time `json:"dispatched_at" gorm:"index" bson:"dispatched_at"`
+    Version      uint       `json:"version" gorm:"not null;default:1" bson:"version"`
+}
+
+// Body is the JSON document delivered for the event
+func (e *OutboxEvent) Body() ([]byte, error) {
+    return json.Marshal(struct {
+        ID        uint            `json:"id"`
+        Type      string          `json:"type"`
+        CreatedAt time.Time       `json:"created_at"`
+        Data      json.RawMessage `json:"data"`
+    }{e.ID, e.Type, e.CreatedAt, json.RawMessage(e.Data)})
+}
+
+// Webhook is an endpoint events are delivered to, signed with Secret. Events
+// are the types it subscribes to, all of them when empty. A paused webhook
+// gets no new deliveries and its pending ones wait until it is resumed. The
+// secret is left out of its JSON, see WebhookWithSecret.
+type Webhook struct {
+    ID        uint          `json:"id" gorm:"primaryKey" bson:"id"`
+    URL       string        `json:"url" validate:"required,url,startswith=http" gorm:"type:varchar(2048)" bson:"url"`
+    Secret    string        `json:"secret,omitempty" validate:"omitempty,min=16" gorm:"type:varchar(255)" bson:"secret" filter:"-"`
+    Events    WebhookEvents `json:"events" validate:"dive,oneof=user.created user.updated user.deleted" gorm:"type:varchar(255)" bson:"events" filter:"-"`
+    Paused    bool          `json:"paused" bson:"paused"`
+    CreatedAt time.Time     `json:"created_at" gorm:"autoCreateTime" bson:"created_at"`
+    UpdatedAt time.Time     `json:"updated_at" gorm:"autoUpdateTime" bson:"updated_at"`
+}
+
+// WebhookWithSecret is a webhook in the responses that show its secret, the
+// ones that created or rotated it
+type WebhookWithSecret Webhook
+
+func (w Webhook) MarshalJSON() ([]byte, error) {
+    shown := WebhookWithSecret(w)
+    shown.Secret = ""
+    return json.Marshal(shown)
+}
+
+// Subscribes tells whether the webhook gets events of the given type
+func (w *Webhook) Subscribes(eventType string) bool {
+    if len(w.Events) == 0 {
+        return true
+    }
+    for _, subscribed := range w.Events {
+        if subscribed == eventType {
+            return true
+        }
+    }
+    return false
+}
+
+// WebhookEvents lists event types. SQL backends store it comma separated.
+type WebhookEvents []string
+
+func (e WebhookEvents) Value() (driver.Value, error) {
+    return strings.Join(e, ","), nil
+}
+
+func (e *WebhookEvents) Scan(value interface{}) error {
+    var joined string
+    switch v := value.(type) {
+    case nil:
+    case string:
+        joined = v
+    case []byte:
+        joined = string(v)
+    default:
+        return fmt.Errorf("cannot scan %T into WebhookEvents", value)
+    }
+    *e = nil
+    if joined != "" {
+        *e = strings.Split(joined, ",")
+    }
+    return nil
+}
+
+// WebhookDelivery is one event to be sent to one webhook. The version guards
+// against two dispatchers sending it at the same time.
+type WebhookDelivery struct {
+    ID             uint       `json:"id" gorm:"primaryKey" bson:"id"`
+    WebhookID      uint       `json:"webhook_id" gorm:"index" bson:"webhook_id"`
+    EventID        uint       `json:"event_id" gorm:"index" bson:"event_id"`
+    EventType      string     `json:"event_type" gorm:"type:varchar(50)" bson:"event_type"`
+    Status         string     `json:"status" gorm:"type:varchar(20);index:idx_webhook_deliveries_status_next_attempt_at" bson:"status"`
+    Attempts       int        `json:"attempts" bson:"attempts"`
+    NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"index:idx_webhook_deliveries_status_next_attempt_at" bson:"next_attempt_at"`
+    ResponseStatus int        `json:"response_status,omitempty" bson:"response_status"`
+    LastError      string     `json:"last_error,omitempty" gorm:"type:text" bson:"last_error"`
+    DeliveredAt    *time.Time `json:"delivered_at" bson:"delivered_at"`
+    CreatedAt      time.Time  `json:"created_at" gorm:"autoCreateTime" bson:"created_at"`
+    UpdatedAt      time.Time  `json:"updated_at" gorm:"autoUpdateTime" bson:"updated_at"`
+    Version        uint       `json:"version" gorm:"not null;default:1" bson:"version"`
+}
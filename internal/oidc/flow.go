@@ -0,0 +1,69 @@
+package oidc
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "strings"
+    "time"
+)
+
+var ErrInvalidFlow = errors.New("oidc: invalid or expired login flow")
+
+// Flow holds the per-login secrets that must survive the round trip to the
+// provider. It is kept client-side in a signed cookie so no server state is needed.
+type Flow struct {
+    Provider  string `json:"p"`
+    State     string `json:"s"`
+    Nonce     string `json:"n"`
+    Verifier  string `json:"v"`
+    ExpiresAt int64  `json:"e"`
+}
+
+func NewFlow(provider string, ttl time.Duration) (*Flow, error) {
+    flow := &Flow{Provider: provider, ExpiresAt: time.Now().Add(ttl).Unix()}
+    for _, field := range []*string{&flow.State, &flow.Nonce, &flow.Verifier} {
+        value, err := RandomString()
+        if err != nil {
+            return nil, err
+        }
+        *field = value
+    }
+    return flow, nil
+}
+
+func (f *Flow) Encode(secret []byte) (string, error) {
+    payload, err := json.Marshal(f)
+    if err != nil {
+        return "", err
+    }
+    encoded := base64.RawURLEncoding.EncodeToString(payload)
+    return encoded + "." + flowSignature(secret, encoded), nil
+}
+
+func DecodeFlow(secret []byte, value string) (*Flow, error) {
+    parts := strings.Split(value, ".")
+    if len(parts) != 2 || !hmac.Equal([]byte(flowSignature(secret, parts[0])), []byte(parts[1])) {
+        return nil, ErrInvalidFlow
+    }
+    payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+    if err != nil {
+        return nil, ErrInvalidFlow
+    }
+    var flow Flow
+    if err := json.Unmarshal(payload, &flow); err != nil {
+        return nil, ErrInvalidFlow
+    }
+    if time.Now().Unix() >= flow.ExpiresAt {
+        return nil, ErrInvalidFlow
+    }
+    return &flow, nil
+}
+
+func flowSignature(secret []byte, encoded string) string {
+    mac := hmac.New(sha256.New, secret)
+    mac.Write([]byte("oidc-flow:" + encoded))
+    return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
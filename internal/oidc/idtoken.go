@@ -0,0 +1,244 @@
+package oidc
+
+import (
+    "context"
+    "crypto"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/hmac"
+    "crypto/rsa"
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math/big"
+    "strings"
+    "time"
+)
+
+// clockSkew is the leeway allowed when checking token timestamps
+const clockSkew = time.Minute
+
+// keyRefreshInterval limits how often an unknown key ID triggers a JWKS refetch
+const keyRefreshInterval = time.Minute
+
+var ErrInvalidIDToken = errors.New("oidc: invalid id token")
+
+type IDTokenClaims struct {
+    Issuer          string   `json:"iss"`
+    Subject         string   `json:"sub"`
+    Audience        audience `json:"aud"`
+    AuthorizedParty string   `json:"azp"`
+    ExpiresAt       int64    `json:"exp"`
+    IssuedAt        int64    `json:"iat"`
+    Nonce           string   `json:"nonce"`
+    Email           string   `json:"email"`
+    EmailVerified   bool     `json:"email_verified"`
+    Name            string   `json:"name"`
+}
+
+// audience accepts both the single string and the array form of "aud"
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+    var single string
+    if err := json.Unmarshal(data, &single); err == nil {
+        *a = audience{single}
+        return nil
+    }
+    var many []string
+    if err := json.Unmarshal(data, &many); err != nil {
+        return err
+    }
+    *a = many
+    return nil
+}
+
+type jwk struct {
+    Kty string `json:"kty"`
+    Kid string `json:"kid"`
+    Use string `json:"use"`
+    N   string `json:"n"`
+    E   string `json:"e"`
+    Crv string `json:"crv"`
+    X   string `json:"x"`
+    Y   string `json:"y"`
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of an
+// ID token and returns its claims
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (*IDTokenClaims, error) {
+    parts := strings.Split(raw, ".")
+    if len(parts) != 3 {
+        return nil, ErrInvalidIDToken
+    }
+    headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+    if err != nil {
+        return nil, ErrInvalidIDToken
+    }
+    var header struct {
+        Alg string `json:"alg"`
+        Kid string `json:"kid"`
+    }
+    if err := json.Unmarshal(headerJSON, &header); err != nil {
+        return nil, ErrInvalidIDToken
+    }
+    signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+    if err != nil {
+        return nil, ErrInvalidIDToken
+    }
+    if err := p.verifySignature(ctx, header.Alg, header.Kid, parts[0]+"."+parts[1], signature); err != nil {
+        return nil, err
+    }
+
+    payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+    if err != nil {
+        return nil, ErrInvalidIDToken
+    }
+    var claims IDTokenClaims
+    if err := json.Unmarshal(payload, &claims); err != nil {
+        return nil, ErrInvalidIDToken
+    }
+    now := time.Now()
+    switch {
+    case claims.Issuer != p.config.Issuer:
+        return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, claims.Issuer)
+    case !claims.Audience.contains(p.config.ClientID):
+        return nil, fmt.Errorf("%w: token was not issued for this client", ErrInvalidIDToken)
+    case len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID:
+        return nil, fmt.Errorf("%w: unexpected authorized party %q", ErrInvalidIDToken, claims.AuthorizedParty)
+    case now.After(time.Unix(claims.ExpiresAt, 0).Add(clockSkew)):
+        return nil, fmt.Errorf("%w: token has expired", ErrInvalidIDToken)
+    case now.Add(clockSkew).Before(time.Unix(claims.IssuedAt, 0)):
+        return nil, fmt.Errorf("%w: token was issued in the future", ErrInvalidIDToken)
+    case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+        return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+    case claims.Subject == "":
+        return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+    }
+    return &claims, nil
+}
+
+func (a audience) contains(clientID string) bool {
+    for _, aud := range a {
+        if aud == clientID {
+            return true
+        }
+    }
+    return false
+}
+
+func (p *Provider) verifySignature(ctx context.Context, alg, kid, signed string, signature []byte) error {
+    if alg == "HS256" {
+        if p.config.ClientSecret == "" {
+            return fmt.Errorf("%w: HS256 requires a client secret", ErrInvalidIDToken)
+        }
+        mac := hmac.New(sha256.New, []byte(p.config.ClientSecret))
+        mac.Write([]byte(signed))
+        if !hmac.Equal(mac.Sum(nil), signature) {
+            return fmt.Errorf("%w: bad signature", ErrInvalidIDToken)
+        }
+        return nil
+    }
+    key, err := p.key(ctx, kid)
+    if err != nil {
+        return err
+    }
+    digest := sha256.Sum256([]byte(signed))
+    switch alg {
+    case "RS256":
+        pub, ok := key.(*rsa.PublicKey)
+        if !ok || rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) != nil {
+            return fmt.Errorf("%w: bad signature", ErrInvalidIDToken)
+        }
+    case "ES256":
+        pub, ok := key.(*ecdsa.PublicKey)
+        if !ok || len(signature) != 64 {
+            return fmt.Errorf("%w: bad signature", ErrInvalidIDToken)
+        }
+        r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+        if !ecdsa.Verify(pub, digest[:], r, s) {
+            return fmt.Errorf("%w: bad signature", ErrInvalidIDToken)
+        }
+    default:
+        return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidIDToken, alg)
+    }
+    return nil
+}
+
+// key returns the signing key with the given ID, refetching the JWKS when the
+// key is unknown so provider key rotation is picked up
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    if key, ok := p.lookup(kid); ok {
+        return key, nil
+    }
+    if time.Since(p.fetchedAt) < keyRefreshInterval {
+        return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidIDToken, kid)
+    }
+    var set struct {
+        Keys []jwk `json:"keys"`
+    }
+    if err := p.getJSON(ctx, p.config.JWKSURL, &set); err != nil {
+        return nil, fmt.Errorf("oidc: fetching signing keys: %w", err)
+    }
+    p.fetchedAt = time.Now()
+    p.keys = make(map[string]interface{})
+    for _, k := range set.Keys {
+        if k.Use != "" && k.Use != "sig" {
+            continue
+        }
+        if key, err := k.publicKey(); err == nil {
+            p.keys[k.Kid] = key
+        }
+    }
+    if key, ok := p.lookup(kid); ok {
+        return key, nil
+    }
+    return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidIDToken, kid)
+}
+
+// lookup finds a key by ID; tokens without a kid match when the set has a single key
+func (p *Provider) lookup(kid string) (interface{}, bool) {
+    if key, ok := p.keys[kid]; ok {
+        return key, true
+    }
+    if kid == "" && len(p.keys) == 1 {
+        for _, key := range p.keys {
+            return key, true
+        }
+    }
+    return nil, false
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+    switch k.Kty {
+    case "RSA":
+        n, err := base64.RawURLEncoding.DecodeString(k.N)
+        if err != nil {
+            return nil, err
+        }
+        e, err := base64.RawURLEncoding.DecodeString(k.E)
+        if err != nil {
+            return nil, err
+        }
+        return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+    case "EC":
+        if k.Crv != "P-256" {
+            return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+        }
+        x, err := base64.RawURLEncoding.DecodeString(k.X)
+        if err != nil {
+            return nil, err
+        }
+        y, err := base64.RawURLEncoding.DecodeString(k.Y)
+        if err != nil {
+            return nil, err
+        }
+        return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+    }
+    return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
@@ -0,0 +1,198 @@
+// Package oidctest runs a mock OpenID Connect provider for tests. It serves
+// discovery, JWKS, an authorization endpoint that logs in User right away and
+// a token endpoint that checks the PKCE verifier, and signs ID tokens with
+// RS256.
+package oidctest
+
+import (
+    "crypto"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "math/big"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "sync"
+    "testing"
+    "time"
+)
+
+const (
+    ClientID = "test-client"
+    keyID    = "test-key"
+)
+
+// User is who the authorization endpoint logs in
+type User struct {
+    Subject       string
+    Email         string
+    EmailVerified bool
+    Name          string
+}
+
+type Server struct {
+    *httptest.Server
+    User User
+    // Tamper, if set, edits the claims of the ID tokens the token endpoint
+    // issues
+    Tamper func(claims map[string]interface{})
+
+    key   *rsa.PrivateKey
+    mu    sync.Mutex
+    codes map[string]grant
+}
+
+// grant is what an authorization code was issued for
+type grant struct {
+    redirectURI string
+    challenge   string
+    nonce       string
+    user        User
+}
+
+// NewServer starts a provider that is closed when the test ends
+func NewServer(t testing.TB) *Server {
+    t.Helper()
+    key, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        t.Fatal(err)
+    }
+    s := &Server{key: key, codes: map[string]grant{}}
+    mux := http.NewServeMux()
+    mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+    mux.HandleFunc("/jwks", s.jwks)
+    mux.HandleFunc("/authorize", s.authorize)
+    mux.HandleFunc("/token", s.token)
+    s.Server = httptest.NewServer(mux)
+    t.Cleanup(s.Close)
+    return s
+}
+
+// Claims returns the claims of a valid ID token for User
+func (s *Server) Claims(nonce string) map[string]interface{} {
+    return s.claims(s.User, nonce)
+}
+
+func (s *Server) claims(user User, nonce string) map[string]interface{} {
+    now := time.Now()
+    return map[string]interface{}{
+        "iss":            s.URL,
+        "sub":            user.Subject,
+        "aud":            ClientID,
+        "exp":            now.Add(time.Hour).Unix(),
+        "iat":            now.Unix(),
+        "nonce":          nonce,
+        "email":          user.Email,
+        "email_verified": user.EmailVerified,
+        "name":           user.Name,
+    }
+}
+
+// IDToken signs claims with the key published in the JWKS
+func (s *Server) IDToken(claims map[string]interface{}) string {
+    return Sign(s.key, keyID, claims)
+}
+
+// Sign returns an RS256 JWT of claims signed with key
+func Sign(key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+    header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+    payload, _ := json.Marshal(claims)
+    signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+    digest := sha256.Sum256([]byte(signed))
+    signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+    if err != nil {
+        panic(err)
+    }
+    return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+    writeJSON(w, http.StatusOK, map[string]string{
+        "issuer":                 s.URL,
+        "authorization_endpoint": s.URL + "/authorize",
+        "token_endpoint":         s.URL + "/token",
+        "jwks_uri":               s.URL + "/jwks",
+    })
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+    pub := s.key.PublicKey
+    writeJSON(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{{
+        "kty": "RSA",
+        "kid": keyID,
+        "use": "sig",
+        "n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+        "e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+    }}})
+}
+
+// authorize logs User in and redirects back with a code and the state
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+    if query.Get("client_id") != ClientID || query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" {
+        http.Error(w, "invalid authorization request", http.StatusBadRequest)
+        return
+    }
+    code := randomString()
+    s.mu.Lock()
+    s.codes[code] = grant{
+        redirectURI: query.Get("redirect_uri"),
+        challenge:   query.Get("code_challenge"),
+        nonce:       query.Get("nonce"),
+        user:        s.User,
+    }
+    s.mu.Unlock()
+    redirect, err := url.Parse(query.Get("redirect_uri"))
+    if err != nil {
+        http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+        return
+    }
+    params := redirect.Query()
+    params.Set("code", code)
+    params.Set("state", query.Get("state"))
+    redirect.RawQuery = params.Encode()
+    http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// token redeems a code once, if the verifier matches its challenge
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+    if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+        return
+    }
+    s.mu.Lock()
+    grant, ok := s.codes[r.PostForm.Get("code")]
+    delete(s.codes, r.PostForm.Get("code"))
+    s.mu.Unlock()
+    verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+    if !ok || r.PostForm.Get("client_id") != ClientID || r.PostForm.Get("redirect_uri") != grant.redirectURI ||
+        base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.challenge {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+        return
+    }
+    claims := s.claims(grant.user, grant.nonce)
+    if s.Tamper != nil {
+        s.Tamper(claims)
+    }
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "access_token": randomString(),
+        "token_type":   "Bearer",
+        "id_token":     s.IDToken(claims),
+        "expires_in":   3600,
+    })
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+    b := make([]byte, 16)
+    rand.Read(b)
+    return base64.RawURLEncoding.EncodeToString(b)
+}
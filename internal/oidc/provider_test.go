@@ -0,0 +1,216 @@
+package oidc_test
+
+import (
+    "context"
+    "crypto/rand"
+    "crypto/rsa"
+    "errors"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/oidc"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/oidc/oidctest"
+    "net/http"
+    "net/url"
+    "testing"
+    "time"
+)
+
+func newProvider(t *testing.T, server *oidctest.Server) *oidc.Provider {
+    t.Helper()
+    provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+        Name:        "mock",
+        Issuer:      server.URL,
+        ClientID:    oidctest.ClientID,
+        RedirectURL: "http://app.test/auth/oidc/mock/callback",
+    })
+    if err != nil {
+        t.Fatalf("NewProvider: %v", err)
+    }
+    return provider
+}
+
+func TestNewProviderDiscovers(t *testing.T) {
+    server := oidctest.NewServer(t)
+    provider := newProvider(t, server)
+    authURL, err := url.Parse(provider.AuthCodeURL("state", "nonce", "verifier"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := authURL.Scheme + "://" + authURL.Host + authURL.Path; got != server.URL+"/authorize" {
+        t.Errorf("auth URL = %s, want the discovered endpoint", got)
+    }
+    query := authURL.Query()
+    if query.Get("code_challenge") != oidc.CodeChallenge("verifier") || query.Get("code_challenge_method") != "S256" {
+        t.Errorf("auth URL lacks the PKCE challenge: %s", authURL)
+    }
+
+    _, err = oidc.NewProvider(context.Background(), oidc.Config{
+        Name:        "mock",
+        Issuer:      server.URL + "/other",
+        ClientID:    oidctest.ClientID,
+        RedirectURL: "http://app.test/callback",
+    })
+    if err == nil {
+        t.Error("NewProvider accepted a discovery document for another issuer")
+    }
+}
+
+// authorize runs the authorization request against the mock and returns the
+// code it redirects back with
+func authorize(t *testing.T, provider *oidc.Provider, state, nonce, verifier string) string {
+    t.Helper()
+    client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+        return http.ErrUseLastResponse
+    }}
+    response, err := client.Get(provider.AuthCodeURL(state, nonce, verifier))
+    if err != nil {
+        t.Fatal(err)
+    }
+    response.Body.Close()
+    location, err := response.Location()
+    if err != nil {
+        t.Fatalf("authorization did not redirect: %v", err)
+    }
+    if location.Query().Get("state") != state {
+        t.Fatalf("state = %q, want %q", location.Query().Get("state"), state)
+    }
+    return location.Query().Get("code")
+}
+
+func TestExchange(t *testing.T) {
+    server := oidctest.NewServer(t)
+    server.User = oidctest.User{Subject: "sub-1", Email: "ann@example.com", EmailVerified: true}
+    provider := newProvider(t, server)
+    ctx := context.Background()
+
+    code := authorize(t, provider, "state", "nonce", "verifier")
+    token, err := provider.Exchange(ctx, code, "verifier")
+    if err != nil {
+        t.Fatalf("Exchange: %v", err)
+    }
+    claims, err := provider.VerifyIDToken(ctx, token.IDToken, "nonce")
+    if err != nil {
+        t.Fatalf("VerifyIDToken: %v", err)
+    }
+    if claims.Subject != "sub-1" || claims.Email != "ann@example.com" || !claims.EmailVerified {
+        t.Errorf("claims = %+v", claims)
+    }
+
+    if _, err := provider.Exchange(ctx, code, "verifier"); err == nil {
+        t.Error("Exchange redeemed a code twice")
+    }
+    code = authorize(t, provider, "state", "nonce", "verifier")
+    if _, err := provider.Exchange(ctx, code, "another verifier"); err == nil {
+        t.Error("Exchange succeeded with the wrong PKCE verifier")
+    }
+}
+
+func TestVerifyIDToken(t *testing.T) {
+    server := oidctest.NewServer(t)
+    server.User = oidctest.User{Subject: "sub-1", Email: "ann@example.com", EmailVerified: true}
+    provider := newProvider(t, server)
+    otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        name  string
+        token func(claims map[string]interface{}) string
+        valid bool
+    }{
+        {"valid", func(claims map[string]interface{}) string {
+            return server.IDToken(claims)
+        }, true},
+        {"audience list with azp", func(claims map[string]interface{}) string {
+            claims["aud"] = []string{"other", oidctest.ClientID}
+            claims["azp"] = oidctest.ClientID
+            return server.IDToken(claims)
+        }, true},
+        {"bad issuer", func(claims map[string]interface{}) string {
+            claims["iss"] = "https://evil.example.com"
+            return server.IDToken(claims)
+        }, false},
+        {"bad audience", func(claims map[string]interface{}) string {
+            claims["aud"] = "other"
+            return server.IDToken(claims)
+        }, false},
+        {"audience list without azp", func(claims map[string]interface{}) string {
+            claims["aud"] = []string{"other", oidctest.ClientID}
+            return server.IDToken(claims)
+        }, false},
+        {"expired", func(claims map[string]interface{}) string {
+            claims["exp"] = time.Now().Add(-time.Hour).Unix()
+            return server.IDToken(claims)
+        }, false},
+        {"issued in the future", func(claims map[string]interface{}) string {
+            claims["iat"] = time.Now().Add(time.Hour).Unix()
+            return server.IDToken(claims)
+        }, false},
+        {"nonce mismatch", func(claims map[string]interface{}) string {
+            claims["nonce"] = "replayed"
+            return server.IDToken(claims)
+        }, false},
+        {"missing subject", func(claims map[string]interface{}) string {
+            delete(claims, "sub")
+            return server.IDToken(claims)
+        }, false},
+        {"signed with another key", func(claims map[string]interface{}) string {
+            return oidctest.Sign(otherKey, "test-key", claims)
+        }, false},
+        {"unknown key", func(claims map[string]interface{}) string {
+            return oidctest.Sign(otherKey, "rotated", claims)
+        }, false},
+        {"malformed", func(claims map[string]interface{}) string {
+            return "not.a-token"
+        }, false},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            raw := test.token(server.Claims("nonce"))
+            _, err := provider.VerifyIDToken(context.Background(), raw, "nonce")
+            if test.valid && err != nil {
+                t.Errorf("VerifyIDToken: %v", err)
+            }
+            if !test.valid && !errors.Is(err, oidc.ErrInvalidIDToken) {
+                t.Errorf("VerifyIDToken error = %v, want ErrInvalidIDToken", err)
+            }
+        })
+    }
+}
+
+func TestFlow(t *testing.T) {
+    secret := []byte("0123456789abcdef0123456789abcdef")
+    flow, err := oidc.NewFlow("mock", time.Minute)
+    if err != nil {
+        t.Fatal(err)
+    }
+    value, err := flow.Encode(secret)
+    if err != nil {
+        t.Fatal(err)
+    }
+    decoded, err := oidc.DecodeFlow(secret, value)
+    if err != nil || *decoded != *flow {
+        t.Fatalf("DecodeFlow = %+v, %v, want %+v", decoded, err, flow)
+    }
+
+    expired, err := oidc.NewFlow("mock", -time.Second)
+    if err != nil {
+        t.Fatal(err)
+    }
+    expiredValue, err := expired.Encode(secret)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for name, test := range map[string]struct {
+        secret []byte
+        value  string
+    }{
+        "wrong secret": {[]byte("another secret"), value},
+        "tampered":     {secret, "e30" + value[3:]},
+        "no signature": {secret, value[:len(value)-44]},
+        "expired":      {secret, expiredValue},
+    } {
+        if _, err := oidc.DecodeFlow(test.secret, test.value); !errors.Is(err, oidc.ErrInvalidFlow) {
+            t.Errorf("%s: DecodeFlow error = %v, want ErrInvalidFlow", name, err)
+        }
+    }
+}
@@ -0,0 +1,16 @@
+package routes
+
+import (
+    "github.com/Mohammad007/GoExpressRestAPI/internal/controllers"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/framework"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/middleware"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+)
+
+func RegisterAuditRoutes(app *framework.App) {
+    router := app.Route("/audit")
+    router.Use(middleware.Auth(app))
+    router.Use(middleware.RequireRole(models.RoleAdmin))
+    router.
+        GET("/", controllers.ListAuditEntries(app))
+}
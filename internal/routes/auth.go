@@ -0,0 +1,12 @@
+package routes
+
+import (
+    "github.com/Mohammad007/GoExpressRestAPI/internal/controllers"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/framework"
+)
+
+func RegisterAuthRoutes(app *framework.App) {
+    router := app.Route("/auth")
+    router.
+        POST("/login", controllers.Login(app))
+}
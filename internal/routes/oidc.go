@@ -0,0 +1,16 @@
+package routes
+
+import (
+    "github.com/Mohammad007/GoExpressRestAPI/internal/controllers"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/framework"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/oidc"
+)
+
+func RegisterOIDCRoutes(app *framework.App, providers ...*oidc.Provider) {
+    router := app.Route("/auth/oidc")
+    for _, provider := range providers {
+        router.
+            GET("/"+provider.Name()+"/login", controllers.OIDCLogin(app, provider)).
+            GET("/"+provider.Name()+"/callback", controllers.OIDCCallback(app, provider))
+    }
+}
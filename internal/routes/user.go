@@ -3,14 +3,38 @@ package routes
 import (
     "github.com/Mohammad007/GoExpressRestAPI/internal/controllers"
     "github.com/Mohammad007/GoExpressRestAPI/internal/framework"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/middleware"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
 )
 
 func RegisterUserRoutes(app *framework.App) {
     router := app.Route("/users")
+    router.Use(middleware.OptionalAuth(app))
+    router.Use(middleware.Idempotency(app))
+    admin := router.With(middleware.Auth(app), middleware.RequireRole(models.RoleAdmin), middleware.NoImpersonation)
+
+    // Registered before /{id} so that "bulk" is not taken for an ID
+    admin.
+        POST("/bulk", controllers.BulkCreateUsers(app)).
+        PATCH("/bulk", controllers.BulkPatchUsers(app)).
+        DELETE("/bulk", controllers.BulkDeleteUsers(app)).
+        PUT("/by-email/{email}", controllers.UpsertUserByEmail(app))
+
     router.
         GET("/", controllers.GetAllUsers(app)).
+        GET("/search", controllers.SearchUsers(app)).
         GET("/{id}", controllers.GetUserByID(app)).
-        POST("/", controllers.CreateUser(app)).
+        POST("/", controllers.CreateUser(app))
+
+    router.With(middleware.Auth(app)).
         PUT("/{id}", controllers.UpdateUser(app)).
-        DELETE("/{id}", controllers.DeleteUser(app))
+        PATCH("/{id}", controllers.PatchUser(app)).
+        DELETE("/{id}", controllers.DeleteUser(app)).
+        GET("/{id}/history", controllers.GetUserHistory(app)).
+        GET("/{id}/diff", controllers.GetUserDiff(app))
+
+    admin.
+        POST("/{id}/unlock", controllers.UnlockUser(app)).
+        POST("/{id}/restore", controllers.RestoreUser(app)).
+        POST("/{id}/impersonate", controllers.Impersonate(app))
 }
\ No newline at end of file
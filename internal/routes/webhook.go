@@ -0,0 +1,30 @@
+package routes
+
+import (
+    "github.com/Mohammad007/GoExpressRestAPI/internal/controllers"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/database"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/framework"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/middleware"
+    "github.com/Mohammad007/GoExpressRestAPI/internal/models"
+    "log"
+    "net/http"
+)
+
+func RegisterWebhookRoutes(app *framework.App) {
+    webhooks, err := database.NewRepository[models.Webhook](app.DB())
+    if err != nil {
+        log.Fatal("Failed to create webhook repository:", err)
+    }
+    router := framework.Resource(app, "/webhooks", webhooks, framework.ResourceOptions[models.Webhook]{
+        Middleware: []func(http.HandlerFunc) http.HandlerFunc{
+            middleware.Auth(app), middleware.RequireRole(models.RoleAdmin), middleware.NoImpersonation,
+        },
+        BeforeSave: controllers.PrepareWebhook,
+        Created:    controllers.ShowWebhookSecret,
+    })
+    router.
+        GET("/{id}/deliveries", controllers.ListWebhookDeliveries(app)).
+        POST("/{id}/deliveries/{delivery}/redeliver", controllers.RedeliverWebhook(app)).
+        POST("/{id}/redeliver", controllers.RedeliverDeadWebhooks(app)).
+        POST("/{id}/secret", controllers.RotateWebhookSecret(app))
+}
@@ -0,0 +1,16 @@
+package utils
+
+import (
+    "net"
+    "net/http"
+)
+
+// ClientIP returns the address of the peer that sent the request. Forwarding
+// headers are ignored because they are trivially spoofed.
+func ClientIP(r *http.Request) string {
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        return r.RemoteAddr
+    }
+    return host
+}
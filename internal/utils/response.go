@@ -3,8 +3,20 @@ package utils
 type SuccessResponse struct {
     Message string      `json:"message"`
     Data    interface{} `json:"data"`
+    Meta    interface{} `json:"meta,omitempty"`
 }
 
 type ErrorResponse struct {
     Error string `json:"error"`
+}
+
+// Pagination describes a page of a list. Page and Pages are only set for
+// offset pagination.
+type Pagination struct {
+    Total      int64  `json:"total"`
+    Page       int    `json:"page,omitempty"`
+    Limit      int    `json:"limit"`
+    Pages      int    `json:"pages,omitempty"`
+    NextCursor string `json:"next_cursor,omitempty"`
+    PrevCursor string `json:"prev_cursor,omitempty"`
 }
\ No newline at end of file